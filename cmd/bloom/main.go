@@ -0,0 +1,26 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/sappy5678/dcard/pkg/service"
+	"github.com/sappy5678/dcard/pkg/utl/config"
+)
+
+// rebuilds the short url bloom filter from the database and swaps it in
+func main() {
+
+	cfgPath := flag.String("p", "./cmd/api/conf.local.yaml", "Path to config file")
+	flag.Parse()
+
+	cfg, err := config.Load(*cfgPath)
+	checkErr(err)
+
+	checkErr(service.RebuildBloomFilter(cfg))
+}
+
+func checkErr(err error) {
+	if err != nil {
+		panic(err.Error())
+	}
+}
@@ -0,0 +1,3 @@
+BEGIN;
+DROP TABLE shortcode_counter;
+COMMIT;
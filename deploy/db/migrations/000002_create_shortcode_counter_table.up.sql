@@ -0,0 +1,7 @@
+BEGIN;
+CREATE TABLE shortcode_counter (
+    machine_id BIGINT PRIMARY KEY,
+    next_value BIGINT NOT NULL,
+    CONSTRAINT shortcode_counter_next_value_check CHECK (next_value > 0)
+);
+COMMIT;
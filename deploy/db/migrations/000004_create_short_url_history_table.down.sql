@@ -0,0 +1,3 @@
+BEGIN;
+DROP TABLE short_url_history;
+COMMIT;
@@ -0,0 +1,11 @@
+BEGIN;
+CREATE TABLE short_url_history (
+    id BIGSERIAL PRIMARY KEY,
+    short_code VARCHAR(20) NOT NULL,
+    original_url TEXT NOT NULL,
+    expire_time BIGINT NOT NULL,
+    changed_time BIGINT NOT NULL
+);
+
+CREATE INDEX idx_short_url_history_short_code ON short_url_history (short_code);
+COMMIT;
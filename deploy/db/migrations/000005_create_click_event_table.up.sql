@@ -0,0 +1,12 @@
+BEGIN;
+CREATE TABLE click_event (
+    id BIGSERIAL PRIMARY KEY,
+    short_code VARCHAR(20) NOT NULL,
+    click_time BIGINT NOT NULL,
+    referrer TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    ip VARCHAR(45) NOT NULL DEFAULT ''
+);
+
+CREATE INDEX idx_click_event_short_code_click_time ON click_event (short_code, click_time);
+COMMIT;
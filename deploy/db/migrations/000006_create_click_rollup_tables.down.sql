@@ -0,0 +1,5 @@
+BEGIN;
+DROP TABLE click_rollup_agent;
+DROP TABLE click_rollup_referrer;
+DROP TABLE click_rollup_hourly;
+COMMIT;
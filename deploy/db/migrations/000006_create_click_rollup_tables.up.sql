@@ -0,0 +1,22 @@
+BEGIN;
+CREATE TABLE click_rollup_hourly (
+    short_code VARCHAR(20) NOT NULL,
+    bucket_time BIGINT NOT NULL,
+    clicks BIGINT NOT NULL,
+    PRIMARY KEY (short_code, bucket_time)
+);
+
+CREATE TABLE click_rollup_referrer (
+    short_code VARCHAR(20) NOT NULL,
+    referrer TEXT NOT NULL,
+    clicks BIGINT NOT NULL,
+    PRIMARY KEY (short_code, referrer)
+);
+
+CREATE TABLE click_rollup_agent (
+    short_code VARCHAR(20) NOT NULL,
+    family VARCHAR(32) NOT NULL,
+    clicks BIGINT NOT NULL,
+    PRIMARY KEY (short_code, family)
+);
+COMMIT;
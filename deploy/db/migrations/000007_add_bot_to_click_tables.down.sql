@@ -0,0 +1,30 @@
+BEGIN;
+-- bot and human counts of the same key are merged back
+CREATE TEMPORARY TABLE click_rollup_hourly_merged AS
+SELECT short_code, bucket_time, SUM(clicks) AS clicks FROM click_rollup_hourly GROUP BY short_code, bucket_time;
+DELETE FROM click_rollup_hourly;
+ALTER TABLE click_rollup_hourly DROP CONSTRAINT click_rollup_hourly_pkey;
+ALTER TABLE click_rollup_hourly DROP COLUMN bot;
+INSERT INTO click_rollup_hourly (short_code, bucket_time, clicks) SELECT short_code, bucket_time, clicks FROM click_rollup_hourly_merged;
+ALTER TABLE click_rollup_hourly ADD PRIMARY KEY (short_code, bucket_time);
+
+CREATE TEMPORARY TABLE click_rollup_referrer_merged AS
+SELECT short_code, referrer, SUM(clicks) AS clicks FROM click_rollup_referrer GROUP BY short_code, referrer;
+DELETE FROM click_rollup_referrer;
+ALTER TABLE click_rollup_referrer DROP CONSTRAINT click_rollup_referrer_pkey;
+ALTER TABLE click_rollup_referrer DROP COLUMN bot;
+INSERT INTO click_rollup_referrer (short_code, referrer, clicks) SELECT short_code, referrer, clicks FROM click_rollup_referrer_merged;
+ALTER TABLE click_rollup_referrer ADD PRIMARY KEY (short_code, referrer);
+
+CREATE TEMPORARY TABLE click_rollup_agent_merged AS
+SELECT short_code, family, SUM(clicks) AS clicks FROM click_rollup_agent GROUP BY short_code, family;
+DELETE FROM click_rollup_agent;
+ALTER TABLE click_rollup_agent DROP CONSTRAINT click_rollup_agent_pkey;
+ALTER TABLE click_rollup_agent DROP COLUMN bot;
+INSERT INTO click_rollup_agent (short_code, family, clicks) SELECT short_code, family, clicks FROM click_rollup_agent_merged;
+ALTER TABLE click_rollup_agent ADD PRIMARY KEY (short_code, family);
+
+DROP TABLE click_rollup_hourly_merged, click_rollup_referrer_merged, click_rollup_agent_merged;
+
+ALTER TABLE click_event DROP COLUMN bot;
+COMMIT;
@@ -0,0 +1,16 @@
+BEGIN;
+ALTER TABLE click_event ADD COLUMN bot BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- rollups count bots apart, so stats can leave them out
+ALTER TABLE click_rollup_hourly ADD COLUMN bot BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE click_rollup_hourly DROP CONSTRAINT click_rollup_hourly_pkey;
+ALTER TABLE click_rollup_hourly ADD PRIMARY KEY (short_code, bucket_time, bot);
+
+ALTER TABLE click_rollup_referrer ADD COLUMN bot BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE click_rollup_referrer DROP CONSTRAINT click_rollup_referrer_pkey;
+ALTER TABLE click_rollup_referrer ADD PRIMARY KEY (short_code, referrer, bot);
+
+ALTER TABLE click_rollup_agent ADD COLUMN bot BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE click_rollup_agent DROP CONSTRAINT click_rollup_agent_pkey;
+ALTER TABLE click_rollup_agent ADD PRIMARY KEY (short_code, family, bot);
+COMMIT;
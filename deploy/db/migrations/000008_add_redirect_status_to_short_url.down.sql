@@ -0,0 +1,3 @@
+BEGIN;
+ALTER TABLE short_url DROP COLUMN redirect_status;
+COMMIT;
@@ -0,0 +1,5 @@
+BEGIN;
+-- 0 redirects with the configured default status
+ALTER TABLE short_url ADD COLUMN redirect_status SMALLINT NOT NULL DEFAULT 0
+    CHECK (redirect_status IN (0, 301, 302, 307, 308));
+COMMIT;
@@ -0,0 +1,3 @@
+BEGIN;
+ALTER TABLE short_url ADD COLUMN untrusted BOOLEAN NOT NULL DEFAULT false;
+COMMIT;
@@ -0,0 +1,4 @@
+BEGIN;
+DROP TABLE import_job_result;
+DROP TABLE import_job;
+COMMIT;
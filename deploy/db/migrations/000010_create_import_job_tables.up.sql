@@ -0,0 +1,27 @@
+BEGIN;
+CREATE TABLE import_job (
+    id VARCHAR(32) PRIMARY KEY,
+    format VARCHAR(10) NOT NULL,
+    status VARCHAR(10) NOT NULL,
+    input BYTEA NOT NULL,
+    total_rows INTEGER NOT NULL DEFAULT 0,
+    processed_rows INTEGER NOT NULL DEFAULT 0,
+    failed_rows INTEGER NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    created_time BIGINT NOT NULL,
+    updated_time BIGINT NOT NULL,
+    worker_id VARCHAR(32) NOT NULL DEFAULT '',
+    lease_until BIGINT NOT NULL DEFAULT 0,
+    attempts INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX idx_import_job_status_created_time ON import_job (status, created_time);
+
+CREATE TABLE import_job_result (
+    job_id VARCHAR(32) NOT NULL REFERENCES import_job (id) ON DELETE CASCADE,
+    row_number INTEGER NOT NULL,
+    short_code VARCHAR(20) NOT NULL DEFAULT '',
+    error TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (job_id, row_number)
+);
+COMMIT;
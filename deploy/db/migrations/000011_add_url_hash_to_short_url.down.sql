@@ -0,0 +1,3 @@
+BEGIN;
+ALTER TABLE short_url DROP COLUMN url_hash;
+COMMIT;
@@ -0,0 +1,3 @@
+BEGIN;
+ALTER TABLE short_url ADD COLUMN url_hash VARCHAR(64);
+COMMIT;
@@ -0,0 +1,2 @@
+-- a lone statement outside BEGIN/COMMIT, CONCURRENTLY cannot run in a transaction
+DROP INDEX CONCURRENTLY IF EXISTS idx_short_url_url_hash;
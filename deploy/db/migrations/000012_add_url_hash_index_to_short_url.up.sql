@@ -0,0 +1,2 @@
+-- a lone statement outside BEGIN/COMMIT, CONCURRENTLY cannot run in a transaction and keeps inserts going while the index builds
+CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_short_url_url_hash ON short_url (url_hash);
@@ -0,0 +1,81 @@
+package domain
+
+// Click is a single redirect through a short url
+type Click struct {
+	ShortCode string `json:"shortCode" db:"short_code"`
+	Time      uint64 `json:"time" db:"click_time"`
+	Referrer  string `json:"referrer" db:"referrer"`
+	UserAgent string `json:"userAgent" db:"user_agent"`
+	// IP is anonymized before the click leaves the service
+	IP string `json:"ip" db:"ip"`
+	// Bot is set by the click pipeline for crawlers, link unfurlers and scripts
+	Bot bool `json:"bot" db:"bot"`
+
+	// AcceptLanguage and Purpose are request headers the bot classifier looks at, they are not stored
+	AcceptLanguage string `json:"-" db:"-"`
+	Purpose        string `json:"-" db:"-"`
+	// Confirmed is set once the visitor went through the interstitial of an untrusted short url
+	Confirmed bool `json:"-" db:"-"`
+}
+
+// LinkStatsQuery selects the time range of the series in LinkStats
+type LinkStatsQuery struct {
+	From uint64
+	To   uint64
+	// Top is the number of referrers and user agent families to return
+	Top int
+	// ExcludeBots leaves the clicks of bots out of the counts, unique visitors never include bots
+	ExcludeBots bool
+}
+
+// LinkStats holds the click statistics of a short url
+type LinkStats struct {
+	ShortCode      string        `json:"shortCode"`
+	TotalClicks    uint64        `json:"totalClicks"`
+	UniqueVisitors uint64        `json:"uniqueVisitors"`
+	Hourly         []StatsBucket `json:"hourly"`
+	Daily          []StatsBucket `json:"daily"`
+	TopReferrers   []StatsCount  `json:"topReferrers"`
+	TopUserAgents  []StatsCount  `json:"topUserAgents"`
+}
+
+// StatsBucket is the number of clicks in the hour or day starting at Time
+type StatsBucket struct {
+	Time   uint64 `json:"time" db:"bucket_time"`
+	Clicks uint64 `json:"clicks" db:"clicks"`
+	// Visitors is the estimated number of distinct visitors, only counted per day
+	Visitors uint64 `json:"visitors,omitempty" db:"-"`
+}
+
+// StatsCount is the number of clicks sharing a referrer or user agent family
+type StatsCount struct {
+	Name   string `json:"name" db:"name"`
+	Clicks uint64 `json:"clicks" db:"clicks"`
+}
+
+// windows of the top short urls
+const (
+	TopWindowHour = "1h"
+	TopWindowDay  = "1d"
+	TopWindowWeek = "7d"
+)
+
+// TopShortURL is a short url with its clicks in a window of the top short urls
+type TopShortURL struct {
+	ShortURL
+	Clicks uint64 `json:"clicks"`
+}
+
+// kinds of click exports
+const (
+	ClickExportEvents = "events"
+	ClickExportDaily  = "daily"
+)
+
+// ClickExportQuery selects the clicks of an export
+type ClickExportQuery struct {
+	From uint64
+	To   uint64
+	// ExcludeBots leaves the clicks of bots out
+	ExcludeBots bool
+}
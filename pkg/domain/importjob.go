@@ -0,0 +1,60 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+)
+
+var (
+	ErrImportJobNotFound = fmt.Errorf("import job not found")
+	ErrImportInvalid     = fmt.Errorf("import file invalid")
+	ErrImportTooLarge    = fmt.Errorf("import file too large")
+)
+
+// formats of import files
+const (
+	ImportFormatCSV    = "csv"
+	ImportFormatNDJSON = "ndjson"
+)
+
+// states of an import job
+const (
+	ImportJobPending = "pending"
+	ImportJobRunning = "running"
+	ImportJobDone    = "done"
+	ImportJobFailed  = "failed"
+)
+
+// ImportJob creates the short urls of an uploaded file in the background
+type ImportJob struct {
+	ID            string `json:"id" db:"id"`
+	Format        string `json:"format" db:"format"`
+	Status        string `json:"status" db:"status"`
+	TotalRows     int    `json:"totalRows" db:"total_rows"`
+	ProcessedRows int    `json:"processedRows" db:"processed_rows"`
+	FailedRows    int    `json:"failedRows" db:"failed_rows"`
+	// Error is why a failed job stopped, errors of single rows are in its results
+	Error       string `json:"error,omitempty" db:"error"`
+	CreatedTime uint64 `json:"createdTime" db:"created_time"`
+	UpdatedTime uint64 `json:"updatedTime" db:"updated_time"`
+	// Input is the uploaded file, it is only loaded by the worker
+	Input []byte `json:"-" db:"input"`
+	// Attempts counts the claims of the job since it last saved progress, it is only loaded by the worker
+	Attempts int `json:"-" db:"attempts"`
+}
+
+// ImportJobResult maps a row of an import file to its short url or its error, rows count from 1 without the csv header
+type ImportJobResult struct {
+	Row       int    `json:"row" db:"row_number"`
+	ShortCode string `json:"id,omitempty" db:"short_code"`
+	ShortURL  string `json:"shortUrl,omitempty" db:"-"`
+	Error     string `json:"error,omitempty" db:"error"`
+}
+
+type ImportJobService interface {
+	// Create checks and stores an import file, its rows are created later by a worker
+	Create(ctx context.Context, format string, input []byte) (*ImportJob, error)
+	Get(ctx context.Context, id string) (*ImportJob, error)
+	// Results calls fn with the result of every processed row in row order
+	Results(ctx context.Context, id string, fn func(result *ImportJobResult) error) error
+}
@@ -3,12 +3,26 @@ package domain
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"net/url"
 )
 
 var (
-	ErrShortURLNotFound = fmt.Errorf("short url not found")
-	ErrShortURLInvalid  = fmt.Errorf("short url invalid")
+	ErrShortURLNotFound    = fmt.Errorf("short url not found")
+	ErrShortURLExpired     = fmt.Errorf("short url expired")
+	ErrShortURLUntrusted   = fmt.Errorf("short url needs confirmation")
+	ErrShortURLInvalid     = fmt.Errorf("short url invalid")
+	ErrShortURLUnavailable = fmt.Errorf("short url creation unavailable")
+	ErrShortURLConflict    = fmt.Errorf("short url already exists")
+	ErrAliasInvalid        = fmt.Errorf("alias invalid")
+	ErrStatsQueryInvalid   = fmt.Errorf("stats query invalid")
+	ErrTopQueryInvalid     = fmt.Errorf("top query invalid")
+	ErrExportQueryInvalid  = fmt.Errorf("export query invalid")
+	ErrBatchTooLarge       = fmt.Errorf("batch too large")
+
+	ErrIdempotencyKeyInvalid = fmt.Errorf("idempotency key invalid")
+	ErrIdempotencyKeyReused  = fmt.Errorf("idempotency key already used by a different request")
+	ErrIdempotencyInProgress = fmt.Errorf("request with the same idempotency key in progress")
 )
 
 type ShortURL struct {
@@ -17,6 +31,31 @@ type ShortURL struct {
 	ShortURL    string `json:"shortUrl" db:"-"`
 	ExpireTime  uint64 `json:"expireTime" db:"expire_time"`
 	CreatedTime uint64 `json:"createdTime" db:"created_time"`
+	Disabled    bool   `json:"disabled" db:"disabled"`
+	// RedirectStatus is the status a visit is redirected with, 0 uses the configured default
+	RedirectStatus int `json:"redirectStatus,omitempty" db:"redirect_status"`
+	// Untrusted links show an interstitial page before redirecting
+	Untrusted bool `json:"untrusted,omitempty" db:"untrusted"`
+	// Status is one of the ShortURLStatus constants, only filled by ShortURLService.Lookup
+	Status string `json:"status,omitempty" db:"-"`
+	// URLHash identifies the normalized OriginalURL, duplicates of a destination are found by it
+	URLHash string `json:"-" db:"url_hash"`
+}
+
+// states of a short url
+const (
+	ShortURLStatusActive   = "active"
+	ShortURLStatusExpired  = "expired"
+	ShortURLStatusDisabled = "disabled"
+)
+
+// ValidRedirectStatus reports whether a short url may redirect with status, 0 stands for the configured default
+func ValidRedirectStatus(status int) bool {
+	switch status {
+	case 0, http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
 }
 
 func (s *ShortURL) IsValid(nowUnix uint64) bool {
@@ -29,6 +68,9 @@ func (s *ShortURL) IsValid(nowUnix uint64) bool {
 	if s.ShortCode == "" {
 		return false
 	}
+	if !ValidRedirectStatus(s.RedirectStatus) {
+		return false
+	}
 	if s.OriginalURL == "" {
 		return false
 	}
@@ -39,7 +81,57 @@ func (s *ShortURL) IsValid(nowUnix uint64) bool {
 	return true
 }
 
+// ShortURLCreate holds the caller supplied fields of a new short url
+type ShortURLCreate struct {
+	OriginalURL string
+	ExpireTime  uint64
+	// Alias is a custom short code, a code is generated when it is empty
+	Alias          string
+	RedirectStatus int
+	Untrusted      bool
+	// IdempotencyKey makes retries of a create return the short url of the first attempt, it is optional
+	IdempotencyKey string
+	// Dedupe returns an existing short url of the same destination, redirect status and trust which lives at least
+	// until ExpireTime instead of creating one, the existing one keeps its expiry. It is ignored with an Alias.
+	Dedupe bool
+}
+
+// ShortURLUpdate holds the fields to change on a short url, nil fields are left as is
+type ShortURLUpdate struct {
+	OriginalURL    *string
+	ExpireTime     *uint64
+	RedirectStatus *int
+	Untrusted      *bool
+}
+
+// ShortURLBatchResult is the outcome of one short url of a batch, ShortURL is set when it was created and Err otherwise
+type ShortURLBatchResult struct {
+	ShortURL *ShortURL
+	Err      error
+}
+
 type ShortURLService interface {
-	Create(ctx context.Context, originalURL string, expireTime uint64) (*ShortURL, error)
+	Create(ctx context.Context, req *ShortURLCreate) (*ShortURL, error)
+	// CreateBatch creates many short urls at once, with a result for every request in the same order.
+	// The error is only set when the whole batch failed. Requests with an IdempotencyKey behave like in Create.
+	CreateBatch(ctx context.Context, reqs []*ShortURLCreate) ([]*ShortURLBatchResult, error)
+	// Get returns a short url which redirects, ErrShortURLExpired once it expired
 	Get(ctx context.Context, shortCode string) (*ShortURL, error)
+	// Lookup returns a short url whatever its state, its Status tells whether it redirects
+	Lookup(ctx context.Context, shortCode string) (*ShortURL, error)
+	// Visit resolves the short url of a redirect and records the click.
+	// An untrusted short url returns ErrShortURLUntrusted without recording, until the click is confirmed.
+	Visit(ctx context.Context, click *Click) (*ShortURL, error)
+	Stats(ctx context.Context, shortCode string, query *LinkStatsQuery) (*LinkStats, error)
+	// Top returns the most clicked short urls of a window, one of the TopWindow constants
+	Top(ctx context.Context, window string, limit int) ([]*TopShortURL, error)
+	// Subscribe streams the clicks of a short url until ctx is done, the channel is closed then
+	Subscribe(ctx context.Context, shortCode string) (<-chan *Click, error)
+	// ExportClicks calls fn with every click of a short url in time order, without holding them in memory
+	ExportClicks(ctx context.Context, shortCode string, query *ClickExportQuery, fn func(click *Click) error) error
+	// ExportDaily calls fn with the clicks of every day of a short url in time order
+	ExportDaily(ctx context.Context, shortCode string, query *ClickExportQuery, fn func(bucket *StatsBucket) error) error
+	Update(ctx context.Context, shortCode string, update *ShortURLUpdate) (*ShortURL, error)
+	Delete(ctx context.Context, shortCode string) error
+	Disable(ctx context.Context, shortCode string) error
 }
@@ -85,6 +85,30 @@ func TestShortURL_IsValid(t *testing.T) {
 			currTime: 100,
 			expected: false,
 		},
+		{
+			name: "permanent redirect",
+			shortURL: ShortURL{
+				ShortCode:      "abc123",
+				OriginalURL:    "https://example.com",
+				ExpireTime:     2000,
+				CreatedTime:    1000,
+				RedirectStatus: 308,
+			},
+			currTime: 1500,
+			expected: true,
+		},
+		{
+			name: "invalid redirect status",
+			shortURL: ShortURL{
+				ShortCode:      "abc123",
+				OriginalURL:    "https://example.com",
+				ExpireTime:     2000,
+				CreatedTime:    1000,
+				RedirectStatus: 200,
+			},
+			currTime: 1500,
+			expected: false,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -0,0 +1,26 @@
+package service
+
+import (
+	"context"
+	"os"
+
+	"github.com/sappy5678/dcard/pkg/utl/config"
+	"github.com/sappy5678/dcard/pkg/utl/postgres"
+)
+
+// RebuildBloomFilter rebuilds the short url bloom filter from the database
+func RebuildBloomFilter(cfg *config.Configuration) error {
+	db, err := postgres.New(os.Getenv("DATABASE_URL"))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	stores, err := newRedisStores(cfg)
+	if err != nil {
+		return err
+	}
+	defer stores.Close()
+
+	return newCacheRepository(cfg, db, stores).RebuildBloomFilter(context.Background())
+}
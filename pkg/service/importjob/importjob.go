@@ -0,0 +1,61 @@
+package importjob
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/sappy5678/dcard/pkg/domain"
+)
+
+func (s *importJobService) Create(ctx context.Context, format string, input []byte) (*domain.ImportJob, error) {
+	// the whole file is read once up front, so a broken one is refused before anything is created
+	rows, err := countRows(format, input)
+	if err != nil {
+		return nil, err
+	}
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	job := &domain.ImportJob{
+		ID:          id,
+		Format:      format,
+		Status:      domain.ImportJobPending,
+		TotalRows:   rows,
+		CreatedTime: now,
+		UpdatedTime: now,
+		Input:       input,
+	}
+	if err := s.repo.Create(ctx, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// newID returns a random id, so the ids of jobs cannot be guessed
+func newID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+func (s *importJobService) Get(ctx context.Context, id string) (*domain.ImportJob, error) {
+	return s.repo.Get(ctx, id)
+}
+
+func (s *importJobService) Results(ctx context.Context, id string, fn func(result *domain.ImportJobResult) error) error {
+	if _, err := s.repo.Get(ctx, id); err != nil {
+		return err
+	}
+	return s.repo.ScanResults(ctx, id, func(result *domain.ImportJobResult) error {
+		if result.ShortCode != "" {
+			result.ShortURL = s.host + "/" + result.ShortCode
+		}
+		return fn(result)
+	})
+}
@@ -0,0 +1,135 @@
+package importjob_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/sappy5678/dcard/pkg/domain"
+	"github.com/sappy5678/dcard/pkg/service/importjob"
+	"github.com/sappy5678/dcard/pkg/service/importjob/repository"
+)
+
+var (
+	mockHost = "http://test:test"
+	mockNow  = uint64(1735689600)
+)
+
+type TestSuite struct {
+	suite.Suite
+	impl domain.ImportJobService
+	repo *repository.MockImportJobRepository
+}
+
+func (ts *TestSuite) SetupTest() {
+	ts.repo = &repository.MockImportJobRepository{}
+	ts.impl = importjob.New(mockHost, func() uint64 { return mockNow }, ts.repo)
+}
+
+func TestServiceSuite(t *testing.T) {
+	suite.Run(t, new(TestSuite))
+}
+
+func (ts *TestSuite) TestCreate() {
+	testCases := []struct {
+		name      string
+		format    string
+		input     string
+		wantRows  int
+		wantErrIs error
+	}{
+		{
+			name:     "csv with a broken row",
+			format:   domain.ImportFormatCSV,
+			input:    "url,expireAt,alias\nhttps://a.example,2025-01-01T00:00:00Z,a\nnot a time\n\nhttps://c.example,2025-01-01T00:00:00Z\n",
+			wantRows: 3,
+		},
+		{
+			name:     "ndjson skips blank lines",
+			format:   domain.ImportFormatNDJSON,
+			input:    `{"url":"https://a.example","expireAt":"2025-01-01T00:00:00Z"}` + "\n\n" + `{"url":` + "\n",
+			wantRows: 2,
+		},
+		{
+			name:      "csv without the expireAt column",
+			format:    domain.ImportFormatCSV,
+			input:     "url\nhttps://a.example\n",
+			wantErrIs: domain.ErrImportInvalid,
+		},
+		{
+			name:      "no rows",
+			format:    domain.ImportFormatCSV,
+			input:     "url,expireAt\n",
+			wantErrIs: domain.ErrImportInvalid,
+		},
+		{
+			name:      "empty file",
+			format:    domain.ImportFormatNDJSON,
+			input:     "",
+			wantErrIs: domain.ErrImportInvalid,
+		},
+		{
+			name:      "unknown format",
+			format:    "xlsx",
+			input:     "url,expireAt\n",
+			wantErrIs: domain.ErrImportInvalid,
+		},
+	}
+
+	for _, tc := range testCases {
+		ts.Run(tc.name, func() {
+			var saved *domain.ImportJob
+			ts.repo.CreateFunc = func(ctx context.Context, job *domain.ImportJob) error {
+				saved = job
+				return nil
+			}
+
+			job, err := ts.impl.Create(context.Background(), tc.format, []byte(tc.input))
+			if tc.wantErrIs != nil {
+				ts.ErrorIs(err, tc.wantErrIs)
+				ts.Nil(saved)
+				return
+			}
+			ts.Require().NoError(err)
+			ts.Equal(saved, job)
+			ts.Len(job.ID, 32)
+			ts.Equal(tc.format, job.Format)
+			ts.Equal(domain.ImportJobPending, job.Status)
+			ts.Equal(tc.wantRows, job.TotalRows)
+			ts.Equal(mockNow, job.CreatedTime)
+			ts.Equal([]byte(tc.input), job.Input)
+		})
+	}
+}
+
+func (ts *TestSuite) TestResults() {
+	ts.repo.GetFunc = func(ctx context.Context, id string) (*domain.ImportJob, error) {
+		if id != "job" {
+			return nil, domain.ErrImportJobNotFound
+		}
+		return &domain.ImportJob{ID: id}, nil
+	}
+	ts.repo.ScanResultsFunc = func(ctx context.Context, id string, fn func(result *domain.ImportJobResult) error) error {
+		for _, result := range []*domain.ImportJobResult{{Row: 1, ShortCode: "abc"}, {Row: 2, Error: "short url invalid"}} {
+			if err := fn(result); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var results []*domain.ImportJobResult
+	err := ts.impl.Results(context.Background(), "job", func(result *domain.ImportJobResult) error {
+		results = append(results, result)
+		return nil
+	})
+	ts.Require().NoError(err)
+	ts.Equal([]*domain.ImportJobResult{
+		{Row: 1, ShortCode: "abc", ShortURL: mockHost + "/abc"},
+		{Row: 2, Error: "short url invalid"},
+	}, results)
+
+	err = ts.impl.Results(context.Background(), "not-exist", func(result *domain.ImportJobResult) error { return nil })
+	ts.ErrorIs(err, domain.ErrImportJobNotFound)
+}
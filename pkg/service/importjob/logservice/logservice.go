@@ -0,0 +1,70 @@
+package logservice
+
+import (
+	"context"
+	"time"
+
+	"github.com/sappy5678/dcard/pkg/domain"
+)
+
+func New(svc domain.ImportJobService, logger domain.Logger) *LogService {
+	return &LogService{
+		ImportJobService: svc,
+		logger:           logger,
+	}
+}
+
+// LogService represents import job logging service
+type LogService struct {
+	domain.ImportJobService
+	logger domain.Logger
+}
+
+const name = "importjob"
+
+func (ls *LogService) Create(ctx context.Context, format string, input []byte) (job *domain.ImportJob, err error) {
+	defer func(begin time.Time) {
+		params := map[string]interface{}{
+			"format": format,
+			"bytes":  len(input),
+			"took":   time.Since(begin),
+		}
+		if job != nil {
+			params["id"] = job.ID
+			params["totalRows"] = job.TotalRows
+		}
+		ls.logger.Log(ctx, name, "Create import job request", err, params)
+	}(time.Now())
+
+	return ls.ImportJobService.Create(ctx, format, input)
+}
+
+func (ls *LogService) Get(ctx context.Context, id string) (job *domain.ImportJob, err error) {
+	defer func(begin time.Time) {
+		ls.logger.Log(
+			ctx,
+			name, "Get import job request", err,
+			map[string]interface{}{
+				"id":   id,
+				"took": time.Since(begin),
+			},
+		)
+	}(time.Now())
+
+	return ls.ImportJobService.Get(ctx, id)
+}
+
+func (ls *LogService) Results(ctx context.Context, id string, fn func(result *domain.ImportJobResult) error) (err error) {
+	defer func(begin time.Time) {
+		ls.logger.Log(
+			ctx,
+			name, "Import job results request", err,
+			map[string]interface{}{
+				"id":   id,
+				"took": time.Since(begin),
+			},
+		)
+	}(time.Now())
+
+	return ls.ImportJobService.Results(ctx, id, fn)
+}
@@ -0,0 +1,69 @@
+package logservice_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sappy5678/dcard/pkg/domain"
+	"github.com/sappy5678/dcard/pkg/service/importjob"
+	il "github.com/sappy5678/dcard/pkg/service/importjob/logservice"
+	"github.com/sappy5678/dcard/pkg/utl/zlog"
+)
+
+var (
+	mockJobID = "test-job-id"
+	mockJob   = &domain.ImportJob{
+		ID:        mockJobID,
+		Format:    domain.ImportFormatCSV,
+		Status:    domain.ImportJobPending,
+		TotalRows: 2,
+	}
+)
+
+var mockImportJobService = &importjob.MockImportJobService{
+	CreateFunc: func(ctx context.Context, format string, input []byte) (*domain.ImportJob, error) {
+		return mockJob, nil
+	},
+	GetFunc: func(ctx context.Context, id string) (*domain.ImportJob, error) {
+		return nil, domain.ErrImportJobNotFound
+	},
+	ResultsFunc: func(ctx context.Context, id string, fn func(result *domain.ImportJobResult) error) error {
+		return fn(&domain.ImportJobResult{Row: 1, ShortCode: "abc"})
+	},
+}
+
+func TestCreate(t *testing.T) {
+	log := zlog.New()
+	svc := il.New(mockImportJobService, log)
+	input := []byte("url,expireAt\n")
+	r1, e1 := svc.Create(context.Background(), domain.ImportFormatCSV, input)
+	r2, e2 := mockImportJobService.Create(context.Background(), domain.ImportFormatCSV, input)
+
+	assert.Equal(t, r1, r2)
+	assert.Equal(t, e1, e2)
+}
+
+func TestGet(t *testing.T) {
+	log := zlog.New()
+	svc := il.New(mockImportJobService, log)
+	r1, e1 := svc.Get(context.Background(), mockJobID)
+	r2, e2 := mockImportJobService.Get(context.Background(), mockJobID)
+
+	assert.Equal(t, r1, r2)
+	assert.Equal(t, e1, e2)
+}
+
+func TestResults(t *testing.T) {
+	log := zlog.New()
+	svc := il.New(mockImportJobService, log)
+	var results []*domain.ImportJobResult
+	err := svc.Results(context.Background(), mockJobID, func(result *domain.ImportJobResult) error {
+		results = append(results, result)
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []*domain.ImportJobResult{{Row: 1, ShortCode: "abc"}}, results)
+}
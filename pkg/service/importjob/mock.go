@@ -0,0 +1,25 @@
+package importjob
+
+import (
+	"context"
+
+	"github.com/sappy5678/dcard/pkg/domain"
+)
+
+type MockImportJobService struct {
+	CreateFunc  func(ctx context.Context, format string, input []byte) (*domain.ImportJob, error)
+	GetFunc     func(ctx context.Context, id string) (*domain.ImportJob, error)
+	ResultsFunc func(ctx context.Context, id string, fn func(result *domain.ImportJobResult) error) error
+}
+
+func (m *MockImportJobService) Create(ctx context.Context, format string, input []byte) (*domain.ImportJob, error) {
+	return m.CreateFunc(ctx, format, input)
+}
+
+func (m *MockImportJobService) Get(ctx context.Context, id string) (*domain.ImportJob, error) {
+	return m.GetFunc(ctx, id)
+}
+
+func (m *MockImportJobService) Results(ctx context.Context, id string, fn func(result *domain.ImportJobResult) error) error {
+	return m.ResultsFunc(ctx, id, fn)
+}
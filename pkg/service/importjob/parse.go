@@ -0,0 +1,171 @@
+package importjob
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sappy5678/dcard/pkg/domain"
+)
+
+// importRow is a row of an import file, its fields are named like the ones of the create API
+type importRow struct {
+	OriginalURL    string `json:"url"`
+	ExpireTime     string `json:"expireAt"`
+	Alias          string `json:"alias,omitempty"`
+	RedirectStatus int    `json:"redirectStatus,omitempty"`
+	Untrusted      bool   `json:"untrusted,omitempty"`
+}
+
+func (row *importRow) create() (*domain.ShortURLCreate, error) {
+	expireTime, err := time.Parse(time.RFC3339, row.ExpireTime)
+	if err != nil || expireTime.IsZero() {
+		return nil, fmt.Errorf("%w: expireAt must be an RFC 3339 time", domain.ErrShortURLInvalid)
+	}
+	return &domain.ShortURLCreate{
+		OriginalURL:    row.OriginalURL,
+		ExpireTime:     uint64(expireTime.Unix()),
+		Alias:          row.Alias,
+		RedirectStatus: row.RedirectStatus,
+		Untrusted:      row.Untrusted,
+	}, nil
+}
+
+// rowReader reads the rows of an import file one at a time
+type rowReader interface {
+	// next returns the next row and io.EOF after the last one, any other error only invalidates the row
+	next() (*domain.ShortURLCreate, error)
+}
+
+// newRowReader returns the reader of a file in format, ErrImportInvalid when the format is unknown or the csv header lacks a column
+func newRowReader(format string, input []byte) (rowReader, error) {
+	switch format {
+	case domain.ImportFormatCSV:
+		return newCSVReader(input)
+	case domain.ImportFormatNDJSON:
+		return &ndjsonReader{r: bufio.NewReader(bytes.NewReader(input))}, nil
+	default:
+		return nil, fmt.Errorf("%w: format must be %s or %s", domain.ErrImportInvalid, domain.ImportFormatCSV, domain.ImportFormatNDJSON)
+	}
+}
+
+// countRows returns how many rows a file has, ErrImportInvalid when it cannot be read or has none
+func countRows(format string, input []byte) (int, error) {
+	reader, err := newRowReader(format, input)
+	if err != nil {
+		return 0, err
+	}
+	rows := 0
+	for {
+		if _, err := reader.next(); err == io.EOF {
+			break
+		}
+		rows++
+	}
+	if rows == 0 {
+		return 0, fmt.Errorf("%w: no rows", domain.ErrImportInvalid)
+	}
+	return rows, nil
+}
+
+// csv columns, url and expireAt are required
+const (
+	columnURL            = "url"
+	columnExpireAt       = "expireAt"
+	columnAlias          = "alias"
+	columnRedirectStatus = "redirectStatus"
+	columnUntrusted      = "untrusted"
+)
+
+// csvReader reads a csv file whose first line names the columns, unknown columns are ignored
+type csvReader struct {
+	r       *csv.Reader
+	columns map[string]int
+}
+
+func newCSVReader(input []byte) (*csvReader, error) {
+	r := csv.NewReader(bytes.NewReader(input))
+	// a short row is reported as a missing value rather than a broken file
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: csv header unreadable", domain.ErrImportInvalid)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	for _, name := range []string{columnURL, columnExpireAt} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("%w: csv header lacks the %s column", domain.ErrImportInvalid, name)
+		}
+	}
+	return &csvReader{r: r, columns: columns}, nil
+}
+
+func (cr *csvReader) next() (*domain.ShortURLCreate, error) {
+	record, err := cr.r.Read()
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", domain.ErrShortURLInvalid, err)
+	}
+
+	row := &importRow{
+		OriginalURL: cr.value(record, columnURL),
+		ExpireTime:  cr.value(record, columnExpireAt),
+		Alias:       cr.value(record, columnAlias),
+	}
+	if value := cr.value(record, columnRedirectStatus); value != "" {
+		if row.RedirectStatus, err = strconv.Atoi(value); err != nil {
+			return nil, fmt.Errorf("%w: redirectStatus must be a number", domain.ErrShortURLInvalid)
+		}
+	}
+	if value := cr.value(record, columnUntrusted); value != "" {
+		if row.Untrusted, err = strconv.ParseBool(value); err != nil {
+			return nil, fmt.Errorf("%w: untrusted must be true or false", domain.ErrShortURLInvalid)
+		}
+	}
+	return row.create()
+}
+
+func (cr *csvReader) value(record []string, column string) string {
+	i, ok := cr.columns[column]
+	if !ok || i >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[i])
+}
+
+// ndjsonReader reads a json object per line, blank lines are skipped
+type ndjsonReader struct {
+	r *bufio.Reader
+}
+
+func (nr *ndjsonReader) next() (*domain.ShortURLCreate, error) {
+	for {
+		// ReadBytes has no line length limit, unlike a bufio.Scanner
+		line, err := nr.r.ReadBytes('\n')
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			if err != nil {
+				return nil, io.EOF
+			}
+			continue
+		}
+
+		row := &importRow{}
+		if err := json.Unmarshal(line, row); err != nil {
+			return nil, fmt.Errorf("%w: %v", domain.ErrShortURLInvalid, err)
+		}
+		return row.create()
+	}
+}
@@ -0,0 +1,163 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/sappy5678/dcard/pkg/domain"
+)
+
+type impl struct {
+	db *sqlx.DB
+}
+
+func New(db *sqlx.DB) Repository {
+	return &impl{
+		db: db,
+	}
+}
+
+const createQuery = `INSERT INTO import_job (id, format, status, input, total_rows, created_time, updated_time) VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+func (im *impl) Create(ctx context.Context, job *domain.ImportJob) error {
+	_, err := im.db.ExecContext(ctx, createQuery, job.ID, job.Format, job.Status, job.Input, job.TotalRows, job.CreatedTime, job.UpdatedTime)
+	return err
+}
+
+const getQuery = `SELECT id, format, status, total_rows, processed_rows, failed_rows, error, created_time, updated_time FROM import_job WHERE id = $1`
+
+func (im *impl) Get(ctx context.Context, id string) (*domain.ImportJob, error) {
+	var job domain.ImportJob
+	if err := im.db.GetContext(ctx, &job, getQuery, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrImportJobNotFound
+		}
+		return nil, err
+	}
+	return &job, nil
+}
+
+// claimQuery skips jobs other workers are claiming, so they never wait on each other
+const claimQuery = `UPDATE import_job SET status = 'running', worker_id = $1, lease_until = $3, updated_time = $2, attempts = attempts + 1
+WHERE id = (
+	SELECT id FROM import_job
+	WHERE status = 'pending' OR (status = 'running' AND lease_until < $2)
+	ORDER BY created_time LIMIT 1
+	FOR UPDATE SKIP LOCKED
+)
+RETURNING id, format, status, input, total_rows, processed_rows, failed_rows, error, created_time, updated_time, attempts`
+
+func (im *impl) Claim(ctx context.Context, worker string, now, leaseUntil uint64) (*domain.ImportJob, error) {
+	var job domain.ImportJob
+	if err := im.db.GetContext(ctx, &job, claimQuery, worker, now, leaseUntil); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &job, nil
+}
+
+const extendLeaseQuery = `UPDATE import_job SET lease_until = $3, updated_time = $4 WHERE id = $1 AND worker_id = $2 AND status = 'running'`
+
+func (im *impl) ExtendLease(ctx context.Context, id, worker string, now, leaseUntil uint64) error {
+	result, err := im.db.ExecContext(ctx, extendLeaseQuery, id, worker, leaseUntil, now)
+	if err != nil {
+		return err
+	}
+	return expectLease(result)
+}
+
+const (
+	// a job which made progress starts counting its attempts again
+	progressQuery = `UPDATE import_job SET processed_rows = processed_rows + $3, failed_rows = failed_rows + $4, lease_until = $5, updated_time = $6, attempts = 0
+WHERE id = $1 AND worker_id = $2 AND status = 'running'`
+	insertResultsQuery = `INSERT INTO import_job_result (job_id, row_number, short_code, error) VALUES (:job_id, :row_number, :short_code, :error)`
+	// keeps a statement under the 65535 parameters postgres accepts
+	insertResultsRows = 10000
+)
+
+type resultRow struct {
+	JobID     string `db:"job_id"`
+	Row       int    `db:"row_number"`
+	ShortCode string `db:"short_code"`
+	Error     string `db:"error"`
+}
+
+func (im *impl) SaveProgress(ctx context.Context, id, worker string, results []*domain.ImportJobResult, now, leaseUntil uint64) error {
+	tx, err := im.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	failed := 0
+	rows := make([]resultRow, len(results))
+	for i, result := range results {
+		if result.Error != "" {
+			failed++
+		}
+		rows[i] = resultRow{JobID: id, Row: result.Row, ShortCode: result.ShortCode, Error: result.Error}
+	}
+	// the lease is checked first, a worker which lost it must not write results the new one writes too
+	result, err := tx.ExecContext(ctx, progressQuery, id, worker, len(results), failed, leaseUntil, now)
+	if err != nil {
+		return err
+	}
+	if err := expectLease(result); err != nil {
+		return err
+	}
+	for start := 0; start < len(rows); start += insertResultsRows {
+		end := min(start+insertResultsRows, len(rows))
+		if _, err := tx.NamedExecContext(ctx, insertResultsQuery, rows[start:end]); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+const finishQuery = `UPDATE import_job SET status = $3, error = $4, updated_time = $5, lease_until = 0 WHERE id = $1 AND worker_id = $2 AND status = 'running'`
+
+func (im *impl) Finish(ctx context.Context, id, worker, status, errMessage string, now uint64) error {
+	result, err := im.db.ExecContext(ctx, finishQuery, id, worker, status, errMessage, now)
+	if err != nil {
+		return err
+	}
+	return expectLease(result)
+}
+
+const scanResultsQuery = `SELECT row_number, short_code, error FROM import_job_result WHERE job_id = $1 ORDER BY row_number`
+
+func (im *impl) ScanResults(ctx context.Context, id string, fn func(result *domain.ImportJobResult) error) error {
+	rows, err := im.db.QueryxContext(ctx, scanResultsQuery, id)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		result := &domain.ImportJobResult{}
+		if err := rows.StructScan(result); err != nil {
+			return err
+		}
+		if err := fn(result); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// expectLease reports ErrLeaseLost when a statement matched no job leased to the worker
+func expectLease(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/sappy5678/dcard/pkg/domain"
+)
+
+type MockImportJobRepository struct {
+	CreateFunc       func(ctx context.Context, job *domain.ImportJob) error
+	GetFunc          func(ctx context.Context, id string) (*domain.ImportJob, error)
+	ClaimFunc        func(ctx context.Context, worker string, now, leaseUntil uint64) (*domain.ImportJob, error)
+	ExtendLeaseFunc  func(ctx context.Context, id, worker string, now, leaseUntil uint64) error
+	SaveProgressFunc func(ctx context.Context, id, worker string, results []*domain.ImportJobResult, now, leaseUntil uint64) error
+	FinishFunc       func(ctx context.Context, id, worker, status, errMessage string, now uint64) error
+	ScanResultsFunc  func(ctx context.Context, id string, fn func(result *domain.ImportJobResult) error) error
+}
+
+func (m *MockImportJobRepository) Create(ctx context.Context, job *domain.ImportJob) error {
+	return m.CreateFunc(ctx, job)
+}
+
+func (m *MockImportJobRepository) Get(ctx context.Context, id string) (*domain.ImportJob, error) {
+	return m.GetFunc(ctx, id)
+}
+
+func (m *MockImportJobRepository) Claim(ctx context.Context, worker string, now, leaseUntil uint64) (*domain.ImportJob, error) {
+	return m.ClaimFunc(ctx, worker, now, leaseUntil)
+}
+
+func (m *MockImportJobRepository) ExtendLease(ctx context.Context, id, worker string, now, leaseUntil uint64) error {
+	return m.ExtendLeaseFunc(ctx, id, worker, now, leaseUntil)
+}
+
+func (m *MockImportJobRepository) SaveProgress(ctx context.Context, id, worker string, results []*domain.ImportJobResult, now, leaseUntil uint64) error {
+	return m.SaveProgressFunc(ctx, id, worker, results, now, leaseUntil)
+}
+
+func (m *MockImportJobRepository) Finish(ctx context.Context, id, worker, status, errMessage string, now uint64) error {
+	return m.FinishFunc(ctx, id, worker, status, errMessage, now)
+}
+
+func (m *MockImportJobRepository) ScanResults(ctx context.Context, id string, fn func(result *domain.ImportJobResult) error) error {
+	return m.ScanResultsFunc(ctx, id, fn)
+}
@@ -0,0 +1,29 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/sappy5678/dcard/pkg/domain"
+)
+
+// ErrLeaseLost is returned to a worker whose lease on a job ran out and was taken by another worker
+var ErrLeaseLost = errors.New("import job lease lost")
+
+// Repository is a repository for import jobs
+type Repository interface {
+	Create(ctx context.Context, job *domain.ImportJob) error
+	// Get returns a job without its input
+	Get(ctx context.Context, id string) (*domain.ImportJob, error)
+	// Claim leases the oldest pending job, or a running one whose lease ran out, to worker until leaseUntil and counts the attempt.
+	// The job is returned with its input, nil when there is none.
+	Claim(ctx context.Context, worker string, now, leaseUntil uint64) (*domain.ImportJob, error)
+	// ExtendLease keeps a job leased to worker until leaseUntil, ErrLeaseLost when another worker took it
+	ExtendLease(ctx context.Context, id, worker string, now, leaseUntil uint64) error
+	// SaveProgress stores the results of the next rows of a job, extends the lease of worker and resets the attempts, in one transaction
+	SaveProgress(ctx context.Context, id, worker string, results []*domain.ImportJobResult, now, leaseUntil uint64) error
+	// Finish ends a job leased to worker with status, errMessage is why a failed job stopped
+	Finish(ctx context.Context, id, worker, status, errMessage string, now uint64) error
+	// ScanResults calls fn with every result of a job in row order
+	ScanResults(ctx context.Context, id string, fn func(result *domain.ImportJobResult) error) error
+}
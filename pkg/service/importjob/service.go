@@ -0,0 +1,34 @@
+package importjob
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/sappy5678/dcard/pkg/domain"
+	"github.com/sappy5678/dcard/pkg/service/importjob/repository"
+)
+
+type importJobService struct {
+	repo repository.Repository
+	host string // should get from central config service
+	now  func() uint64
+}
+
+func New(host string, now func() uint64, repo repository.Repository) domain.ImportJobService {
+	return &importJobService{
+		repo: repo,
+		host: host,
+		now:  now,
+	}
+}
+
+// Initialize returns the service of import jobs and the worker which processes them, the worker runs once started
+func Initialize(host string, db *sqlx.DB, shorturls domain.ShortURLService, cfg *WorkerConfig) (domain.ImportJobService, *Worker) {
+	repo := repository.New(db)
+	now := func() uint64 {
+		now := time.Now().Unix()
+		return uint64(now)
+	}
+	return New(host, now, repo), NewWorker(repo, shorturls, now, cfg)
+}
@@ -0,0 +1,211 @@
+package transport
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sappy5678/dcard/pkg/domain"
+
+	"github.com/labstack/echo"
+)
+
+type HTTP struct {
+	Service        domain.ImportJobService
+	maxImportBytes int64
+}
+
+// Config represents transport specific config
+type Config struct {
+	// MaxImportBytes caps the size of an uploaded import file
+	MaxImportBytes int64
+}
+
+const (
+	defaultMaxImportBytes = 32 << 20
+	// importReadTimeout replaces the server read timeout for uploads, which is too short for large files
+	importReadTimeout = 5 * time.Minute
+)
+
+func NewHTTP(svc domain.ImportJobService, r *echo.Group, cfg *Config) {
+	h := HTTP{
+		Service:        svc,
+		maxImportBytes: defaultMaxImportBytes,
+	}
+	if cfg != nil && cfg.MaxImportBytes > 0 {
+		h.maxImportBytes = cfg.MaxImportBytes
+	}
+
+	ur := r.Group("/api/v1")
+
+	// Upload a CSV or NDJSON file of short urls, they are created in the background
+	// POST /api/v1/jobs?format=csv
+	ur.POST("/jobs", h.create)
+
+	// Status and progress of an import job
+	// GET /api/v1/jobs/{id}
+	ur.GET("/jobs/:id", h.get)
+
+	// Short code or error of every processed row of an import job, as CSV or NDJSON
+	// GET /api/v1/jobs/{id}/results?format=csv
+	ur.GET("/jobs/:id/results", h.results)
+}
+
+func (h HTTP) create(c echo.Context) error {
+	req := c.Request()
+	format := importFormat(c)
+	if format == "" {
+		return c.JSON(http.StatusBadRequest, domain.ErrorRespond{Error: domain.ErrImportInvalid.Error()})
+	}
+
+	rc := http.NewResponseController(c.Response().Writer)
+	if err := rc.SetReadDeadline(time.Now().Add(importReadTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	input, err := io.ReadAll(http.MaxBytesReader(c.Response().Writer, req.Body, h.maxImportBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return c.JSON(http.StatusRequestEntityTooLarge, domain.ErrorRespond{Error: domain.ErrImportTooLarge.Error()})
+		}
+		return c.JSON(http.StatusBadRequest, domain.ErrorRespond{Error: domain.ErrImportInvalid.Error()})
+	}
+
+	job, err := h.Service.Create(req.Context(), format, input)
+	if err != nil {
+		if errors.Is(err, domain.ErrImportInvalid) {
+			return c.JSON(http.StatusBadRequest, domain.ErrorRespond{Error: err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, domain.ErrorRespond{Error: http.StatusText(http.StatusInternalServerError)})
+	}
+	c.Response().Header().Set(echo.HeaderLocation, "/api/v1/jobs/"+job.ID)
+	return c.JSON(http.StatusAccepted, job)
+}
+
+// importFormat returns the format of an upload, the format param or else its content type, empty when it is neither csv nor ndjson
+func importFormat(c echo.Context) string {
+	format := c.QueryParam("format")
+	if format == "" {
+		contentType := c.Request().Header.Get(echo.HeaderContentType)
+		switch {
+		case strings.HasPrefix(contentType, "text/csv"):
+			format = domain.ImportFormatCSV
+		case strings.HasPrefix(contentType, "application/x-ndjson"):
+			format = domain.ImportFormatNDJSON
+		}
+	}
+	if format != domain.ImportFormatCSV && format != domain.ImportFormatNDJSON {
+		return ""
+	}
+	return format
+}
+
+func (h HTTP) get(c echo.Context) error {
+	job, err := h.Service.Get(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return notFoundError(c, err)
+	}
+	return c.JSON(http.StatusOK, job)
+}
+
+const (
+	// resultsFlushRows is how many rows are written between flushes to the client
+	resultsFlushRows = 500
+	// resultsWriteTimeout bounds every flush, so a slow client cannot hold the download forever
+	resultsWriteTimeout = 30 * time.Second
+)
+
+// results streams the results saved so far, the file of a running job grows until it is done
+func (h HTTP) results(c echo.Context) error {
+	id := c.Param("id")
+	ctx := c.Request().Context()
+	job, err := h.Service.Get(ctx, id)
+	if err != nil {
+		return notFoundError(c, err)
+	}
+	format := c.QueryParam("format")
+	if format == "" {
+		format = job.Format
+	}
+	if format != domain.ImportFormatCSV && format != domain.ImportFormatNDJSON {
+		return c.JSON(http.StatusBadRequest, domain.ErrorRespond{Error: domain.ErrImportInvalid.Error()})
+	}
+
+	res := c.Response()
+	rc := http.NewResponseController(res.Writer)
+	extendDeadline := func() error {
+		// the server write timeout would otherwise cut long downloads
+		if err := rc.SetWriteDeadline(time.Now().Add(resultsWriteTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+		return nil
+	}
+	if err := extendDeadline(); err != nil {
+		return err
+	}
+
+	var (
+		csvWriter *csv.Writer
+		encoder   *json.Encoder
+	)
+	if format == domain.ImportFormatNDJSON {
+		res.Header().Set(echo.HeaderContentType, "application/x-ndjson")
+		res.Header().Set(echo.HeaderContentDisposition, `attachment; filename="`+id+`-results.ndjson"`)
+		res.WriteHeader(http.StatusOK)
+		encoder = json.NewEncoder(res)
+	} else {
+		res.Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+		res.Header().Set(echo.HeaderContentDisposition, `attachment; filename="`+id+`-results.csv"`)
+		res.WriteHeader(http.StatusOK)
+		csvWriter = csv.NewWriter(res)
+		if err := csvWriter.Write([]string{"row", "id", "shortUrl", "error"}); err != nil {
+			return err
+		}
+	}
+	flush := func() error {
+		if csvWriter != nil {
+			csvWriter.Flush()
+			if err := csvWriter.Error(); err != nil {
+				return err
+			}
+		}
+		res.Flush()
+		return extendDeadline()
+	}
+
+	rows := 0
+	err = h.Service.Results(ctx, id, func(result *domain.ImportJobResult) error {
+		var err error
+		if encoder != nil {
+			err = encoder.Encode(result)
+		} else {
+			err = csvWriter.Write([]string{strconv.Itoa(result.Row), result.ShortCode, result.ShortURL, result.Error})
+		}
+		if err != nil {
+			return err
+		}
+		rows++
+		if rows%resultsFlushRows == 0 {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		// the response is committed, the error is returned so it is logged
+		return err
+	}
+	return flush()
+}
+
+// notFoundError responds 404 for a missing import job and 500 for anything else
+func notFoundError(c echo.Context, err error) error {
+	if errors.Is(err, domain.ErrImportJobNotFound) {
+		return c.JSON(http.StatusNotFound, domain.ErrorRespond{Error: domain.ErrImportJobNotFound.Error()})
+	}
+	return c.JSON(http.StatusInternalServerError, domain.ErrorRespond{Error: http.StatusText(http.StatusInternalServerError)})
+}
@@ -0,0 +1,275 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sappy5678/dcard/pkg/domain"
+	"github.com/sappy5678/dcard/pkg/service/importjob"
+	"github.com/sappy5678/dcard/pkg/utl/server"
+)
+
+var (
+	mockJobID = "test-job-id"
+	mockJob   = &domain.ImportJob{
+		ID:            mockJobID,
+		Format:        domain.ImportFormatCSV,
+		Status:        domain.ImportJobRunning,
+		TotalRows:     2,
+		ProcessedRows: 2,
+		FailedRows:    1,
+		CreatedTime:   1735689600,
+		UpdatedTime:   1735689601,
+	}
+	mockResults = []*domain.ImportJobResult{
+		{Row: 1, ShortCode: "abc", ShortURL: "http://test/abc"},
+		{Row: 2, Error: "short url invalid, \"quoted\""},
+	}
+)
+
+var mockImportJobService = &importjob.MockImportJobService{
+	CreateFunc: func(ctx context.Context, format string, input []byte) (*domain.ImportJob, error) {
+		if string(input) == "invalid" {
+			return nil, domain.ErrImportInvalid
+		}
+		job := *mockJob
+		job.Format = format
+		job.Status = domain.ImportJobPending
+		return &job, nil
+	},
+	GetFunc: func(ctx context.Context, id string) (*domain.ImportJob, error) {
+		if id != mockJobID {
+			return nil, domain.ErrImportJobNotFound
+		}
+		return mockJob, nil
+	},
+	ResultsFunc: func(ctx context.Context, id string, fn func(result *domain.ImportJobResult) error) error {
+		for _, result := range mockResults {
+			if err := fn(result); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+func TestCreate(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		contentType string
+		body        string
+		wantStatus  int
+		wantFormat  string
+		wantErrResp *domain.ErrorRespond
+	}{
+		{
+			name:       "csv by param",
+			query:      "?format=csv",
+			body:       "url,expireAt\n",
+			wantStatus: http.StatusAccepted,
+			wantFormat: domain.ImportFormatCSV,
+		},
+		{
+			name:        "ndjson by content type",
+			contentType: "application/x-ndjson",
+			body:        "{}\n",
+			wantStatus:  http.StatusAccepted,
+			wantFormat:  domain.ImportFormatNDJSON,
+		},
+		{
+			name:        "unknown format",
+			contentType: "application/json",
+			body:        "[]",
+			wantStatus:  http.StatusBadRequest,
+			wantErrResp: &domain.ErrorRespond{Error: domain.ErrImportInvalid.Error()},
+		},
+		{
+			name:        "invalid file",
+			query:       "?format=csv",
+			body:        "invalid",
+			wantStatus:  http.StatusBadRequest,
+			wantErrResp: &domain.ErrorRespond{Error: domain.ErrImportInvalid.Error()},
+		},
+		{
+			name:        "too large",
+			query:       "?format=csv",
+			body:        strings.Repeat("a", 17),
+			wantStatus:  http.StatusRequestEntityTooLarge,
+			wantErrResp: &domain.ErrorRespond{Error: domain.ErrImportTooLarge.Error()},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := server.New()
+			rg := r.Group("")
+			NewHTTP(mockImportJobService, rg, &Config{MaxImportBytes: 16})
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+
+			res, err := http.Post(ts.URL+"/api/v1/jobs"+tt.query, tt.contentType, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, res.StatusCode)
+			if tt.wantErrResp != nil {
+				response := new(domain.ErrorRespond)
+				if err := json.NewDecoder(res.Body).Decode(response); err != nil {
+					t.Fatal(err)
+				}
+				assert.Equal(t, tt.wantErrResp, response)
+				return
+			}
+			response := new(domain.ImportJob)
+			if err := json.NewDecoder(res.Body).Decode(response); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, mockJobID, response.ID)
+			assert.Equal(t, tt.wantFormat, response.Format)
+			assert.Equal(t, domain.ImportJobPending, response.Status)
+			assert.Equal(t, "/api/v1/jobs/"+mockJobID, res.Header.Get(echo.HeaderLocation))
+		})
+	}
+}
+
+func TestGet(t *testing.T) {
+	tests := []struct {
+		name        string
+		id          string
+		wantStatus  int
+		wantResp    *domain.ImportJob
+		wantErrResp *domain.ErrorRespond
+	}{
+		{
+			name:       "progress",
+			id:         mockJobID,
+			wantStatus: http.StatusOK,
+			wantResp:   mockJob,
+		},
+		{
+			name:        "not found",
+			id:          "not-exist",
+			wantStatus:  http.StatusNotFound,
+			wantErrResp: &domain.ErrorRespond{Error: domain.ErrImportJobNotFound.Error()},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := server.New()
+			rg := r.Group("")
+			NewHTTP(mockImportJobService, rg, nil)
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+
+			res, err := http.Get(ts.URL + "/api/v1/jobs/" + tt.id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, res.StatusCode)
+			if tt.wantErrResp != nil {
+				response := new(domain.ErrorRespond)
+				if err := json.NewDecoder(res.Body).Decode(response); err != nil {
+					t.Fatal(err)
+				}
+				assert.Equal(t, tt.wantErrResp, response)
+				return
+			}
+			response := new(domain.ImportJob)
+			if err := json.NewDecoder(res.Body).Decode(response); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tt.wantResp, response)
+		})
+	}
+}
+
+func TestResults(t *testing.T) {
+	tests := []struct {
+		name            string
+		id              string
+		query           string
+		wantStatus      int
+		wantContentType string
+		wantBody        string
+		wantErrResp     *domain.ErrorRespond
+	}{
+		{
+			name:            "csv of the job format",
+			id:              mockJobID,
+			wantStatus:      http.StatusOK,
+			wantContentType: "text/csv; charset=utf-8",
+			wantBody: "row,id,shortUrl,error\n" +
+				"1,abc,http://test/abc,\n" +
+				`2,,,"short url invalid, ""quoted"""` + "\n",
+		},
+		{
+			name:            "ndjson",
+			id:              mockJobID,
+			query:           "?format=ndjson",
+			wantStatus:      http.StatusOK,
+			wantContentType: "application/x-ndjson",
+			wantBody: `{"row":1,"id":"abc","shortUrl":"http://test/abc"}` + "\n" +
+				`{"row":2,"error":"short url invalid, \"quoted\""}` + "\n",
+		},
+		{
+			name:        "invalid format",
+			id:          mockJobID,
+			query:       "?format=xlsx",
+			wantStatus:  http.StatusBadRequest,
+			wantErrResp: &domain.ErrorRespond{Error: domain.ErrImportInvalid.Error()},
+		},
+		{
+			name:        "not found",
+			id:          "not-exist",
+			wantStatus:  http.StatusNotFound,
+			wantErrResp: &domain.ErrorRespond{Error: domain.ErrImportJobNotFound.Error()},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := server.New()
+			rg := r.Group("")
+			NewHTTP(mockImportJobService, rg, nil)
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+
+			res, err := http.Get(ts.URL + "/api/v1/jobs/" + tt.id + "/results" + tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, res.StatusCode)
+			if tt.wantErrResp != nil {
+				response := new(domain.ErrorRespond)
+				if err := json.NewDecoder(res.Body).Decode(response); err != nil {
+					t.Fatal(err)
+				}
+				assert.Equal(t, tt.wantErrResp, response)
+				return
+			}
+			assert.Equal(t, tt.wantContentType, res.Header.Get(echo.HeaderContentType))
+			assert.Contains(t, res.Header.Get(echo.HeaderContentDisposition), "attachment")
+			body := new(bytes.Buffer)
+			if _, err := body.ReadFrom(res.Body); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tt.wantBody, body.String())
+		})
+	}
+}
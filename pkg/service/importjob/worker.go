@@ -0,0 +1,224 @@
+package importjob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/sappy5678/dcard/pkg/domain"
+	"github.com/sappy5678/dcard/pkg/service/importjob/repository"
+)
+
+// WorkerConfig represents the settings of a worker
+type WorkerConfig struct {
+	// PollInterval is how often the worker looks for a job while it is idle
+	PollInterval time.Duration
+	// LeaseTTL is how long a job stays with a worker which stopped saving progress, before another worker resumes it
+	LeaseTTL time.Duration
+	// ChunkSize is how many rows are created and saved at once
+	ChunkSize int
+	// MaxAttempts is how many times a job is claimed without saving progress before it is failed
+	MaxAttempts int
+}
+
+const (
+	defaultPollInterval = time.Second
+	defaultLeaseTTL     = time.Minute
+	defaultChunkSize    = 500
+	defaultMaxAttempts  = 5
+)
+
+// Worker creates the short urls of import jobs. Jobs and their progress live in postgres, so a job a worker
+// did not finish, because it stopped or crashed, is resumed from its last saved chunk once the lease runs out.
+type Worker struct {
+	repo         repository.Repository
+	shorturls    domain.ShortURLService
+	now          func() uint64
+	id           string
+	pollInterval time.Duration
+	leaseTTL     uint64
+	chunkSize    int
+	maxAttempts  int
+}
+
+func NewWorker(repo repository.Repository, shorturls domain.ShortURLService, now func() uint64, cfg *WorkerConfig) *Worker {
+	w := &Worker{
+		repo:         repo,
+		shorturls:    shorturls,
+		now:          now,
+		pollInterval: defaultPollInterval,
+		leaseTTL:     uint64(defaultLeaseTTL / time.Second),
+		chunkSize:    defaultChunkSize,
+		maxAttempts:  defaultMaxAttempts,
+	}
+	if cfg != nil {
+		if cfg.PollInterval > 0 {
+			w.pollInterval = cfg.PollInterval
+		}
+		if cfg.LeaseTTL >= time.Second {
+			w.leaseTTL = uint64(cfg.LeaseTTL / time.Second)
+		}
+		if cfg.ChunkSize > 0 {
+			w.chunkSize = cfg.ChunkSize
+		}
+		if cfg.MaxAttempts > 0 {
+			w.maxAttempts = cfg.MaxAttempts
+		}
+	}
+	// only tells leases apart, so a failing random source just makes them share an empty id
+	w.id, _ = newID()
+	return w
+}
+
+// Run processes jobs until ctx is done, errors are passed to onError and the job is retried once its lease runs out
+func (w *Worker) Run(ctx context.Context, onError func(err error)) {
+	ticker := time.NewTicker(w.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		// jobs are processed back to back while there are any
+		for {
+			found, err := w.RunOnce(ctx)
+			if err != nil && ctx.Err() == nil {
+				onError(err)
+			}
+			if !found || err != nil {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce claims a job and processes it to the end, it reports whether there was a job
+func (w *Worker) RunOnce(ctx context.Context) (bool, error) {
+	now := w.now()
+	job, err := w.repo.Claim(ctx, w.id, now, now+w.leaseTTL)
+	if err != nil || job == nil {
+		return false, err
+	}
+	if job.Attempts > w.maxAttempts {
+		// a chunk which fails or crashes its worker every time would otherwise be retried forever
+		return true, w.repo.Finish(ctx, job.ID, w.id, domain.ImportJobFailed, fmt.Sprintf("stopped after %d attempts without progress", w.maxAttempts), w.now())
+	}
+
+	ctx, stop := w.heartbeat(ctx, job.ID)
+	defer stop()
+	return true, w.process(ctx, job)
+}
+
+// heartbeat extends the lease of a job every third of the lease ttl until stop is called, so a slow chunk keeps it.
+// The returned ctx is canceled once another worker took the job.
+func (w *Worker) heartbeat(ctx context.Context, id string) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(time.Duration(w.leaseTTL) * time.Second / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			now := w.now()
+			// other errors are retried on the next tick, the lease outlives two of them
+			if err := w.repo.ExtendLease(ctx, id, w.id, now, now+w.leaseTTL); errors.Is(err, repository.ErrLeaseLost) {
+				cancel()
+				return
+			}
+		}
+	}()
+	return ctx, func() {
+		cancel()
+		<-done
+	}
+}
+
+func (w *Worker) process(ctx context.Context, job *domain.ImportJob) error {
+	reader, err := newRowReader(job.Format, job.Input)
+	if err != nil {
+		return w.repo.Finish(ctx, job.ID, w.id, domain.ImportJobFailed, err.Error(), w.now())
+	}
+	// rows saved under a previous lease are skipped, a crash mid chunk redoes that chunk, whose rows
+	// have idempotency keys, so the ones created before the crash get their short url again
+	row := 0
+	for ; row < job.ProcessedRows; row++ {
+		if _, err := reader.next(); err == io.EOF {
+			break
+		}
+	}
+
+	for {
+		results := make([]*domain.ImportJobResult, 0, w.chunkSize)
+		creates := make([]*domain.ShortURLCreate, 0, w.chunkSize)
+		// index in results of every create
+		indexes := make([]int, 0, w.chunkSize)
+		eof := false
+		for len(results) < w.chunkSize {
+			create, err := reader.next()
+			if err == io.EOF {
+				eof = true
+				break
+			}
+			row++
+			results = append(results, &domain.ImportJobResult{Row: row})
+			if err != nil {
+				results[len(results)-1].Error = err.Error()
+				continue
+			}
+			create.IdempotencyKey = rowIdempotencyKey(job.ID, row)
+			creates = append(creates, create)
+			indexes = append(indexes, len(results)-1)
+		}
+
+		if len(creates) > 0 {
+			created, err := w.shorturls.CreateBatch(ctx, creates)
+			if err != nil {
+				// the job keeps its lease, it is retried from this chunk once the lease runs out
+				return err
+			}
+			for j, i := range indexes {
+				if errors.Is(created[j].Err, domain.ErrIdempotencyInProgress) {
+					// the worker which lost the job may still create the row, the chunk is retried once the lease runs out
+					return created[j].Err
+				}
+				if created[j].Err != nil {
+					results[i].Error = resultError(created[j].Err)
+					continue
+				}
+				results[i].ShortCode = created[j].ShortURL.ShortCode
+			}
+		}
+		if len(results) > 0 {
+			now := w.now()
+			if err := w.repo.SaveProgress(ctx, job.ID, w.id, results, now, now+w.leaseTTL); err != nil {
+				return err
+			}
+		}
+		if eof {
+			return w.repo.Finish(ctx, job.ID, w.id, domain.ImportJobDone, "", w.now())
+		}
+	}
+}
+
+// rowIdempotencyKey identifies the create of a row of a job across the workers which process it
+func rowIdempotencyKey(jobID string, row int) string {
+	return fmt.Sprintf("import:%s:%d", jobID, row)
+}
+
+// resultError returns the message of a row which was not created, without the cause of an unavailable service
+func resultError(err error) string {
+	if errors.Is(err, domain.ErrShortURLUnavailable) {
+		return domain.ErrShortURLUnavailable.Error()
+	}
+	return err.Error()
+}
@@ -0,0 +1,286 @@
+package importjob_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/sappy5678/dcard/pkg/domain"
+	"github.com/sappy5678/dcard/pkg/service/importjob"
+	"github.com/sappy5678/dcard/pkg/service/importjob/repository"
+	"github.com/sappy5678/dcard/pkg/service/shorturl"
+)
+
+var mockExpireAt = "2025-01-01T01:00:00Z"
+
+type WorkerTestSuite struct {
+	suite.Suite
+	worker    *importjob.Worker
+	repo      *repository.MockImportJobRepository
+	shorturls *shorturl.MockShortURLService
+
+	// progress records every SaveProgress call, finished the status of Finish
+	progress [][]*domain.ImportJobResult
+	finished string
+	failure  string
+}
+
+func (ts *WorkerTestSuite) SetupTest() {
+	ts.repo = &repository.MockImportJobRepository{}
+	ts.shorturls = &shorturl.MockShortURLService{}
+	ts.worker = importjob.NewWorker(ts.repo, ts.shorturls, func() uint64 { return mockNow }, &importjob.WorkerConfig{
+		LeaseTTL:  time.Minute,
+		ChunkSize: 2,
+	})
+	ts.progress = nil
+	ts.finished = ""
+	ts.failure = ""
+
+	ts.repo.SaveProgressFunc = func(ctx context.Context, id, worker string, results []*domain.ImportJobResult, now, leaseUntil uint64) error {
+		ts.Equal(mockNow+60, leaseUntil)
+		ts.progress = append(ts.progress, results)
+		return nil
+	}
+	ts.repo.FinishFunc = func(ctx context.Context, id, worker, status, errMessage string, now uint64) error {
+		ts.finished = status
+		ts.failure = errMessage
+		return nil
+	}
+	// every url ending in "taken" is refused like a taken alias
+	ts.shorturls.CreateBatchFunc = func(ctx context.Context, reqs []*domain.ShortURLCreate) ([]*domain.ShortURLBatchResult, error) {
+		results := make([]*domain.ShortURLBatchResult, len(reqs))
+		for i, req := range reqs {
+			if strings.HasSuffix(req.OriginalURL, "taken") {
+				results[i] = &domain.ShortURLBatchResult{Err: domain.ErrShortURLConflict}
+				continue
+			}
+			results[i] = &domain.ShortURLBatchResult{ShortURL: &domain.ShortURL{ShortCode: strings.TrimPrefix(req.OriginalURL, "https://")}}
+		}
+		return results, nil
+	}
+}
+
+func TestWorkerSuite(t *testing.T) {
+	suite.Run(t, new(WorkerTestSuite))
+}
+
+// claim makes the repository hand out job once
+func (ts *WorkerTestSuite) claim(job *domain.ImportJob) {
+	claimed := false
+	ts.repo.ClaimFunc = func(ctx context.Context, worker string, now, leaseUntil uint64) (*domain.ImportJob, error) {
+		ts.Equal(mockNow+60, leaseUntil)
+		if claimed {
+			return nil, nil
+		}
+		claimed = true
+		return job, nil
+	}
+}
+
+func csvJob(rows ...string) *domain.ImportJob {
+	return &domain.ImportJob{
+		ID:     "job",
+		Format: domain.ImportFormatCSV,
+		Status: domain.ImportJobRunning,
+		Input:  []byte("url,expireAt\n" + strings.Join(rows, "\n")),
+	}
+}
+
+func (ts *WorkerTestSuite) TestRunOnce() {
+	ts.claim(csvJob(
+		"https://a,"+mockExpireAt,
+		"https://b,not a time",
+		"https://taken,"+mockExpireAt,
+	))
+
+	found, err := ts.worker.RunOnce(context.Background())
+	ts.Require().NoError(err)
+	ts.True(found)
+	ts.Equal([][]*domain.ImportJobResult{
+		{{Row: 1, ShortCode: "a"}, {Row: 2, Error: domain.ErrShortURLInvalid.Error() + ": expireAt must be an RFC 3339 time"}},
+		{{Row: 3, Error: domain.ErrShortURLConflict.Error()}},
+	}, ts.progress)
+	ts.Equal(domain.ImportJobDone, ts.finished)
+
+	found, err = ts.worker.RunOnce(context.Background())
+	ts.NoError(err)
+	ts.False(found)
+}
+
+func (ts *WorkerTestSuite) TestRunOnce_Resume() {
+	job := csvJob(
+		"https://a,"+mockExpireAt,
+		"https://b,"+mockExpireAt,
+		"https://c,"+mockExpireAt,
+	)
+	job.ProcessedRows = 2
+	ts.claim(job)
+
+	// every row is created under a key of its own, so a chunk redone after a crash does not create it twice
+	var keys []string
+	createBatch := ts.shorturls.CreateBatchFunc
+	ts.shorturls.CreateBatchFunc = func(ctx context.Context, reqs []*domain.ShortURLCreate) ([]*domain.ShortURLBatchResult, error) {
+		for _, req := range reqs {
+			keys = append(keys, req.IdempotencyKey)
+		}
+		return createBatch(ctx, reqs)
+	}
+
+	found, err := ts.worker.RunOnce(context.Background())
+	ts.Require().NoError(err)
+	ts.True(found)
+	ts.Equal([][]*domain.ImportJobResult{{{Row: 3, ShortCode: "c"}}}, ts.progress)
+	ts.Equal(domain.ImportJobDone, ts.finished)
+	ts.Equal([]string{"import:job:3"}, keys)
+}
+
+func (ts *WorkerTestSuite) TestRunOnce_RowInProgress() {
+	ts.claim(csvJob("https://a,"+mockExpireAt, "https://b,"+mockExpireAt))
+	ts.shorturls.CreateBatchFunc = func(ctx context.Context, reqs []*domain.ShortURLCreate) ([]*domain.ShortURLBatchResult, error) {
+		return []*domain.ShortURLBatchResult{{ShortURL: &domain.ShortURL{ShortCode: "a"}}, {Err: domain.ErrIdempotencyInProgress}}, nil
+	}
+
+	// the row is not failed, the chunk is retried once the lease runs out
+	found, err := ts.worker.RunOnce(context.Background())
+	ts.True(found)
+	ts.ErrorIs(err, domain.ErrIdempotencyInProgress)
+	ts.Empty(ts.progress)
+	ts.Empty(ts.finished)
+}
+
+func (ts *WorkerTestSuite) TestRunOnce_TooManyAttempts() {
+	job := csvJob("https://a," + mockExpireAt)
+	job.Attempts = 6
+	ts.claim(job)
+	ts.shorturls.CreateBatchFunc = func(ctx context.Context, reqs []*domain.ShortURLCreate) ([]*domain.ShortURLBatchResult, error) {
+		ts.Fail("should not be called")
+		return nil, nil
+	}
+
+	found, err := ts.worker.RunOnce(context.Background())
+	ts.Require().NoError(err)
+	ts.True(found)
+	ts.Equal(domain.ImportJobFailed, ts.finished)
+	ts.Equal("stopped after 5 attempts without progress", ts.failure)
+}
+
+func (ts *WorkerTestSuite) TestRunOnce_Heartbeat() {
+	ts.worker = importjob.NewWorker(ts.repo, ts.shorturls, func() uint64 { return mockNow }, &importjob.WorkerConfig{LeaseTTL: time.Second})
+	ts.repo.ClaimFunc = func(ctx context.Context, worker string, now, leaseUntil uint64) (*domain.ImportJob, error) {
+		return csvJob("https://a," + mockExpireAt), nil
+	}
+	ts.repo.SaveProgressFunc = func(ctx context.Context, id, worker string, results []*domain.ImportJobResult, now, leaseUntil uint64) error {
+		return nil
+	}
+	extended := make(chan struct{}, 1)
+	ts.repo.ExtendLeaseFunc = func(ctx context.Context, id, worker string, now, leaseUntil uint64) error {
+		ts.Equal(mockNow+1, leaseUntil)
+		select {
+		case extended <- struct{}{}:
+		default:
+		}
+		return nil
+	}
+	// a chunk which outlives the lease keeps it
+	ts.shorturls.CreateBatchFunc = func(ctx context.Context, reqs []*domain.ShortURLCreate) ([]*domain.ShortURLBatchResult, error) {
+		select {
+		case <-extended:
+		case <-time.After(5 * time.Second):
+			ts.Fail("lease not extended")
+		}
+		return []*domain.ShortURLBatchResult{{ShortURL: &domain.ShortURL{ShortCode: "a"}}}, nil
+	}
+
+	found, err := ts.worker.RunOnce(context.Background())
+	ts.Require().NoError(err)
+	ts.True(found)
+	ts.Equal(domain.ImportJobDone, ts.finished)
+
+	// a worker which lost the job stops creating its rows
+	ts.repo.ExtendLeaseFunc = func(ctx context.Context, id, worker string, now, leaseUntil uint64) error {
+		return repository.ErrLeaseLost
+	}
+	ts.shorturls.CreateBatchFunc = func(ctx context.Context, reqs []*domain.ShortURLCreate) ([]*domain.ShortURLBatchResult, error) {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(5 * time.Second):
+			ts.Fail("chunk not canceled")
+			return nil, nil
+		}
+	}
+	found, err = ts.worker.RunOnce(context.Background())
+	ts.True(found)
+	ts.ErrorIs(err, context.Canceled)
+}
+
+func (ts *WorkerTestSuite) TestRunOnce_BatchError() {
+	ts.claim(csvJob("https://a," + mockExpireAt))
+	mockError := errors.New("error")
+	ts.shorturls.CreateBatchFunc = func(ctx context.Context, reqs []*domain.ShortURLCreate) ([]*domain.ShortURLBatchResult, error) {
+		return nil, mockError
+	}
+
+	// the job is left running, another claim resumes it once the lease runs out
+	found, err := ts.worker.RunOnce(context.Background())
+	ts.True(found)
+	ts.ErrorIs(err, mockError)
+	ts.Empty(ts.progress)
+	ts.Empty(ts.finished)
+}
+
+func (ts *WorkerTestSuite) TestRunOnce_LeaseLost() {
+	ts.claim(csvJob(
+		"https://a,"+mockExpireAt,
+		"https://b,"+mockExpireAt,
+		"https://c,"+mockExpireAt,
+	))
+	ts.repo.SaveProgressFunc = func(ctx context.Context, id, worker string, results []*domain.ImportJobResult, now, leaseUntil uint64) error {
+		return repository.ErrLeaseLost
+	}
+
+	found, err := ts.worker.RunOnce(context.Background())
+	ts.True(found)
+	ts.ErrorIs(err, repository.ErrLeaseLost)
+	ts.Empty(ts.finished)
+}
+
+func (ts *WorkerTestSuite) TestRunOnce_UnknownFormat() {
+	job := csvJob()
+	job.Format = "xlsx"
+	ts.claim(job)
+
+	found, err := ts.worker.RunOnce(context.Background())
+	ts.Require().NoError(err)
+	ts.True(found)
+	ts.Equal(domain.ImportJobFailed, ts.finished)
+	ts.Contains(ts.failure, domain.ErrImportInvalid.Error())
+}
+
+func (ts *WorkerTestSuite) TestRun() {
+	ts.claim(csvJob("https://a," + mockExpireAt))
+	finished := make(chan string, 1)
+	ts.repo.FinishFunc = func(ctx context.Context, id, worker, status, errMessage string, now uint64) error {
+		finished <- status
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ts.worker.Run(ctx, func(err error) { ts.NoError(err) })
+	}()
+
+	select {
+	case status := <-finished:
+		ts.Equal(domain.ImportJobDone, status)
+	case <-time.After(time.Second):
+		ts.Fail("job not finished")
+	}
+	cancel()
+	<-done
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"os"
+
+	"github.com/redis/rueidis"
+	"github.com/redis/rueidis/rueidislock"
+
+	"github.com/sappy5678/dcard/pkg/utl/config"
+	redisLocker "github.com/sappy5678/dcard/pkg/utl/locker"
+	"github.com/sappy5678/dcard/pkg/utl/redis"
+)
+
+// redisStores are the redis clients of the service, the README recommends keeping the bloom filter apart from evictable cache data
+type redisStores struct {
+	bloom  rueidis.Client
+	cache  rueidis.Client
+	locker rueidislock.Locker
+}
+
+func newRedisStores(cfg *config.Configuration) (*redisStores, error) {
+	var stores config.Redis
+	if cfg.Redis != nil {
+		stores = *cfg.Redis
+	}
+
+	bloom, err := redis.NewWithConfig(redisConfig(stores.Bloom))
+	if err != nil {
+		return nil, err
+	}
+
+	cacheCfg := redisConfig(stores.Cache)
+	if cfg.Cache != nil {
+		cacheCfg.CacheSizeEachConn = cfg.Cache.LocalSizeMB << 20
+	}
+	cache, err := redis.NewWithConfig(cacheCfg)
+	if err != nil {
+		bloom.Close()
+		return nil, err
+	}
+
+	locker, err := redisLocker.NewWithConfig(redisConfig(stores.Locker))
+	if err != nil {
+		bloom.Close()
+		cache.Close()
+		return nil, err
+	}
+
+	return &redisStores{
+		bloom:  bloom,
+		cache:  cache,
+		locker: locker,
+	}, nil
+}
+
+func (s *redisStores) Close() {
+	s.locker.Close()
+	s.cache.Close()
+	s.bloom.Close()
+}
+
+// redisConfig returns the connection settings of a store, connecting to REDIS_URL when it has no addresses
+func redisConfig(store *config.RedisStore) *redis.Config {
+	cfg := &redis.Config{Addresses: []string{os.Getenv("REDIS_URL")}}
+	if store == nil {
+		return cfg
+	}
+	if len(store.Addresses) > 0 {
+		cfg.Addresses = store.Addresses
+	}
+	cfg.Username = store.Username
+	cfg.Password = store.Password
+	cfg.TLS = store.TLS
+	cfg.DB = store.DB
+	cfg.KeyPrefix = store.KeyPrefix
+	return cfg
+}
+
+// keyPrefix returns the key prefix of a store
+func keyPrefix(store *config.RedisStore) string {
+	if store == nil {
+		return ""
+	}
+	return store.KeyPrefix
+}
@@ -32,18 +32,28 @@
 package service
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 	"os"
+	"time"
 
+	"github.com/jmoiron/sqlx"
 	"github.com/labstack/echo"
 
+	"github.com/sappy5678/dcard/pkg/domain"
+	"github.com/sappy5678/dcard/pkg/service/importjob"
+	il "github.com/sappy5678/dcard/pkg/service/importjob/logservice"
+	it "github.com/sappy5678/dcard/pkg/service/importjob/transport"
 	"github.com/sappy5678/dcard/pkg/service/shorturl"
+	"github.com/sappy5678/dcard/pkg/service/shorturl/cache"
+	"github.com/sappy5678/dcard/pkg/service/shorturl/click"
 	sl "github.com/sappy5678/dcard/pkg/service/shorturl/logservice"
+	"github.com/sappy5678/dcard/pkg/service/shorturl/repository"
 	st "github.com/sappy5678/dcard/pkg/service/shorturl/transport"
 	"github.com/sappy5678/dcard/pkg/utl/config"
-	redisLocker "github.com/sappy5678/dcard/pkg/utl/locker"
+	"github.com/sappy5678/dcard/pkg/utl/machineid"
 	"github.com/sappy5678/dcard/pkg/utl/postgres"
-	"github.com/sappy5678/dcard/pkg/utl/redis"
 	"github.com/sappy5678/dcard/pkg/utl/server"
 	"github.com/sappy5678/dcard/pkg/utl/zlog"
 )
@@ -55,36 +65,224 @@ func Start(cfg *config.Configuration) error {
 		return err
 	}
 
-	redisClient, err := redis.New(os.Getenv("REDIS_URL"))
+	stores, err := newRedisStores(cfg)
 	if err != nil {
 		return err
 	}
+	defer stores.Close()
 
-	locker, err := redisLocker.New(os.Getenv("REDIS_URL"))
+	log := zlog.New()
+
+	host := "http://localhost:8080" // should get from central config service
+
+	// leases must survive evictions, so they live beside the bloom filter
+	lease, err := machineid.Acquire(context.Background(), stores.bloom, machineIDConfig(cfg.MachineID))
 	if err != nil {
 		return err
 	}
+	defer lease.Close(context.Background())
 
-	log := zlog.New()
+	cacheRepo := newCacheRepository(cfg, db, stores)
 
-	host := "http://localhost:8080" // should get from central config service
-	machineID := uint64(1)          // should get from central config service
+	// visitors, top short urls and live events are fed off the click pipeline too, so redirects never wait on them
+	clickStores := click.MultiStore(
+		clickStore(cfg, db, stores),
+		click.StoreFunc(cacheRepo.AddVisitors),
+		click.StoreFunc(cacheRepo.AddTopClicks),
+		click.StoreFunc(cacheRepo.PublishClicks),
+	)
+	bots, err := botClassifier(cfg.Click, log)
+	if err != nil {
+		return err
+	}
+	clickCfg := clickConfig(cfg.Click)
+	clickCfg.Bots = bots
+	clicks := click.New(clickStores, clickCfg)
+	// runs after the server shut down, so the last redirects are saved too
+	defer clicks.Close(context.Background())
+
+	svc, err := shorturl.Initialize(lease, lease.MaxID(), host, db, cacheRepo, clicks)
+	if err != nil {
+		return err
+	}
+
+	jobs, worker := importjob.Initialize(host, db, svc, importWorkerConfig(cfg.Import))
+	// a job the worker is in the middle of is resumed from its last saved chunk, here or elsewhere, once its lease runs out
+	workerCtx, stopWorker := context.WithCancel(context.Background())
+	defer stopWorker()
+	go worker.Run(workerCtx, func(err error) {
+		log.Log(context.Background(), "importjob", "Process import job", err, nil)
+	})
 
 	e := server.New()
 	rootGroup := e.Group("")
-	st.NewHTTP(sl.New(shorturl.Initialize(machineID, host, db, redisClient, locker), log), rootGroup)
+	// closed once the server shuts down, so event streams do not hold the graceful shutdown up
+	shutdown := make(chan struct{})
+	transportCfg, err := transportConfig(cfg.Redirect)
+	if err != nil {
+		return err
+	}
+	transportCfg.Shutdown = shutdown
+	transportCfg.TrustedProxies, err = st.ParseTrustedProxies(cfg.Server.TrustedProxies)
+	if err != nil {
+		return err
+	}
+	if cfg.API != nil {
+		transportCfg.MaxBatchSize = cfg.API.MaxBatchSize
+	}
+	st.NewHTTP(sl.New(svc, log), rootGroup, transportCfg)
+	it.NewHTTP(il.New(jobs, log), rootGroup, importTransportConfig(cfg.Import))
 
 	rootGroup.GET("/health", func(c echo.Context) error {
 		return c.JSON(http.StatusOK, map[string]string{
 			"status": "health",
 		})
 	})
+	// cache hit and miss counters among other runtime stats, on a listener apart from the public one
+	if cfg.Server.DebugPort != "" {
+		debug, err := server.StartDebug(cfg.Server.DebugPort)
+		if err != nil {
+			return err
+		}
+		defer debug.Close()
+	}
 	server.Start(e, &server.Config{
 		Port:                cfg.Server.Port,
 		ReadTimeoutSeconds:  cfg.Server.ReadTimeout,
 		WriteTimeoutSeconds: cfg.Server.WriteTimeout,
 		Debug:               cfg.Server.Debug,
+		OnShutdown:          func() { close(shutdown) },
 	})
 
 	return nil
 }
+
+func machineIDConfig(cfg *config.MachineID) *machineid.Config {
+	if cfg == nil {
+		return nil
+	}
+	return &machineid.Config{
+		KeyPrefix: cfg.KeyPrefix,
+		MaxID:     cfg.MaxID,
+		TTL:       time.Duration(cfg.LeaseTTL) * time.Second,
+	}
+}
+
+func newCacheRepository(cfg *config.Configuration, db *sqlx.DB, stores *redisStores) cache.Repository {
+	return cache.New(repository.New(db), stores.bloom, stores.cache, stores.locker, cacheConfig(cfg))
+}
+
+func cacheConfig(cfg *config.Configuration) *cache.Config {
+	cacheCfg := &cache.Config{}
+	if cfg.Redis != nil {
+		cacheCfg.BloomKeyPrefix = keyPrefix(cfg.Redis.Bloom)
+		cacheCfg.CacheKeyPrefix = keyPrefix(cfg.Redis.Cache)
+	}
+	if cfg.Cache != nil {
+		cacheCfg.MaxTTL = time.Duration(cfg.Cache.MaxTTL) * time.Second
+		cacheCfg.TTLJitter = time.Duration(cfg.Cache.TTLJitter) * time.Second
+		cacheCfg.NegativeTTL = time.Duration(cfg.Cache.NegativeTTL) * time.Second
+		cacheCfg.LocalTTL = time.Duration(cfg.Cache.LocalTTL) * time.Second
+	}
+	if cfg.API != nil {
+		cacheCfg.IdempotencyTTL = time.Duration(cfg.API.IdempotencyWindow) * time.Second
+	}
+	return cacheCfg
+}
+
+// transportConfig returns the redirect settings of the transport, rejecting a status which is not a redirect or a page which does not parse
+func transportConfig(cfg *config.Redirect) (*st.Config, error) {
+	if cfg == nil {
+		return &st.Config{}, nil
+	}
+	if !domain.ValidRedirectStatus(cfg.Status) {
+		return nil, fmt.Errorf("invalid redirect status %d", cfg.Status)
+	}
+	pages, err := st.LoadPages(cfg.ErrorPages, cfg.PreviewPage)
+	if err != nil {
+		return nil, err
+	}
+	return &st.Config{
+		RedirectStatus: cfg.Status,
+		RedirectMaxAge: time.Duration(cfg.MaxAge) * time.Second,
+		Pages:          pages,
+		ConfirmSecret:  []byte(cfg.ConfirmSecret),
+		ConfirmTTL:     time.Duration(cfg.ConfirmTTL) * time.Second,
+	}, nil
+}
+
+func importWorkerConfig(cfg *config.Import) *importjob.WorkerConfig {
+	if cfg == nil {
+		return nil
+	}
+	return &importjob.WorkerConfig{
+		PollInterval: time.Duration(cfg.PollIntervalMs) * time.Millisecond,
+		LeaseTTL:     time.Duration(cfg.LeaseTTL) * time.Second,
+		ChunkSize:    cfg.ChunkSize,
+		MaxAttempts:  cfg.MaxAttempts,
+	}
+}
+
+func importTransportConfig(cfg *config.Import) *it.Config {
+	if cfg == nil {
+		return nil
+	}
+	return &it.Config{MaxImportBytes: int64(cfg.MaxFileMB) << 20}
+}
+
+func clickConfig(cfg *config.Click) *click.Config {
+	if cfg == nil {
+		return &click.Config{}
+	}
+	return &click.Config{
+		BufferSize:    cfg.BufferSize,
+		BatchSize:     cfg.BatchSize,
+		FlushInterval: time.Duration(cfg.FlushIntervalMs) * time.Millisecond,
+	}
+}
+
+const defaultBotReload = 30 * time.Second
+
+// botClassifier returns the classifier of bot clicks, watching the pattern file when there is one
+func botClassifier(cfg *config.Click, log *zlog.Log) (*click.BotClassifier, error) {
+	if cfg == nil || cfg.BotPatternsFile == "" {
+		return click.NewBotClassifier(click.DefaultBotPatterns)
+	}
+	bots, err := click.NewBotClassifier(nil)
+	if err != nil {
+		return nil, err
+	}
+	reload := time.Duration(cfg.BotReloadSeconds) * time.Second
+	if reload <= 0 {
+		reload = defaultBotReload
+	}
+	// the watch lasts as long as the process
+	err = bots.WatchPatterns(context.Background(), cfg.BotPatternsFile, reload, func(err error) {
+		log.Log(context.Background(), "click", "Reload bot patterns", err, map[string]interface{}{"path": cfg.BotPatternsFile})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return bots, nil
+}
+
+const (
+	clickSinkStream = "stream"
+	defaultClickKey = "clicks"
+)
+
+// clickStore returns where clicks are saved, the stream lives on the cache redis under its key prefix.
+// The rollups of the stats api are kept in postgres whatever the sink.
+func clickStore(cfg *config.Configuration, db *sqlx.DB, stores *redisStores) click.Store {
+	if cfg.Click == nil || cfg.Click.Sink != clickSinkStream {
+		return click.NewPostgresStore(db)
+	}
+	key := cfg.Click.StreamKey
+	if key == "" {
+		key = defaultClickKey
+	}
+	if cfg.Redis != nil {
+		key = keyPrefix(cfg.Redis.Cache) + key
+	}
+	return click.MultiStore(click.NewStreamStore(stores.cache, key, cfg.Click.StreamMaxLen), click.NewRollupStore(db))
+}
@@ -0,0 +1,128 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/redis/rueidis"
+)
+
+const (
+	bfRebuildLock = "bf:shorturl:rebuild"
+
+	// the full scan skips rows committed after it passed their id, which only creates in flight when the rebuild began can be,
+	// looking back this far before the rebuild started covers their created_time
+	bfCatchUpWindow = 60
+)
+
+// bfInsertScript adds the codes in ARGV[3:] to the bloom filter KEYS[1], and to the filter KEYS[2] while a rebuild fills it,
+// so codes created during a rebuild are in the filter it swaps in
+var bfInsertScript = rueidis.NewLuaScript(`
+for i = 3, #ARGV do
+	redis.call("BF.INSERT", KEYS[1], "CAPACITY", ARGV[1], "ERROR", ARGV[2], "ITEMS", ARGV[i])
+end
+if redis.call("EXISTS", KEYS[2]) == 1 then
+	for i = 3, #ARGV do
+		redis.call("BF.INSERT", KEYS[2], "NOCREATE", "ITEMS", ARGV[i])
+	end
+end
+return 1`)
+
+// getBloomRebuildLock returns the name of the lock held while rebuilding, prefixed so deployments sharing the locker do not wait on each other
+func (im *impl) getBloomRebuildLock() string {
+	return im.cfg.BloomKeyPrefix + bfRebuildLock
+}
+
+func (im *impl) RebuildBloomFilter(ctx context.Context) error {
+	// only one node rebuilds at a time
+	ctx, cancel, err := im.locker.WithContext(ctx, im.getBloomRebuildLock())
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	return im.rebuildBloomFilter(ctx)
+}
+
+func (im *impl) EnsureBloomFilter(ctx context.Context) (bool, error) {
+	exists, err := im.bloomFilterExists(ctx)
+	if err != nil || exists {
+		return false, err
+	}
+
+	ctx, cancel, err := im.locker.WithContext(ctx, im.getBloomRebuildLock())
+	if err != nil {
+		return false, err
+	}
+	defer cancel()
+
+	// another node may have rebuilt it while we waited for the lock
+	exists, err = im.bloomFilterExists(ctx)
+	if err != nil || exists {
+		return false, err
+	}
+	return true, im.rebuildBloomFilter(ctx)
+}
+
+// getBloomRebuildKey returns the key a new filter is built in,
+// the hash tag puts it in the slot of the bloom key, so RENAME and the insert script also work on a cluster
+func (im *impl) getBloomRebuildKey() string {
+	return "{" + im.getBloomKey() + "}:rebuild"
+}
+
+// addBloomFilter adds short codes to the bloom filter, and to the one being rebuilt if there is one
+func (im *impl) addBloomFilter(ctx context.Context, shortCodes ...string) error {
+	args := make([]string, 0, len(shortCodes)+2)
+	args = append(args, strconv.FormatInt(bfCap, 10), strconv.FormatFloat(bfErr, 'f', -1, 64))
+	args = append(args, shortCodes...)
+	return bfInsertScript.Exec(ctx, im.bloom, []string{im.getBloomKey(), im.getBloomRebuildKey()}, args).Error()
+}
+
+func (im *impl) addBloomFilterKey(ctx context.Context, key string, shortCodes ...string) error {
+	cmd := im.bloom.B().BfInsert().Key(key).Capacity(bfCap).Error(bfErr).Items().Item(shortCodes...).Build()
+	if _, err := im.bloom.Do(ctx, cmd).AsIntSlice(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (im *impl) rebuildBloomFilter(ctx context.Context) error {
+	startedAt := uint64(im.now().Unix())
+	rebuildKey := im.getBloomRebuildKey()
+
+	if err := im.bloom.Do(ctx, im.bloom.B().Del().Key(rebuildKey).Build()).Error(); err != nil {
+		return err
+	}
+	// from here on creates also add their codes to the new filter
+	cmd := im.bloom.B().BfReserve().Key(rebuildKey).ErrorRate(bfErr).Capacity(bfCap).Build()
+	if err := im.bloom.Do(ctx, cmd).Error(); err != nil {
+		return err
+	}
+	addRebuild := func(shortCodes []string) error {
+		return im.addBloomFilterKey(ctx, rebuildKey, shortCodes...)
+	}
+	since := uint64(0)
+	if startedAt > bfCatchUpWindow {
+		since = startedAt - bfCatchUpWindow
+	}
+	err := im.repo.ScanShortCodes(ctx, 0, addRebuild)
+	if err == nil {
+		err = im.repo.ScanShortCodes(ctx, since, addRebuild)
+	}
+	if err != nil {
+		// so creates stop writing to the abandoned filter, even if an error occurs the next rebuild starts over anyway
+		im.bloom.Do(context.WithoutCancel(ctx), im.bloom.B().Del().Key(rebuildKey).Build())
+		return err
+	}
+
+	cmd = im.bloom.B().Rename().Key(rebuildKey).Newkey(im.getBloomKey()).Build()
+	return im.bloom.Do(ctx, cmd).Error()
+}
+
+func (im *impl) bloomFilterExists(ctx context.Context) (bool, error) {
+	count, err := im.bloom.Do(ctx, im.bloom.B().Exists().Key(im.getBloomKey()).Build()).AsInt64()
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
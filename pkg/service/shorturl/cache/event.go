@@ -0,0 +1,63 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/redis/rueidis"
+
+	"github.com/sappy5678/dcard/pkg/domain"
+)
+
+const (
+	eventChannel = "events:shorturl:"
+	// eventBuffer is how many clicks a subscriber may fall behind before new ones are dropped
+	eventBuffer = 64
+
+	statEventDropped = "event_dropped"
+)
+
+func (im *impl) getEventChannel(shortCode string) string {
+	return im.cfg.CacheKeyPrefix + eventChannel + shortCode
+}
+
+func (im *impl) PublishClicks(ctx context.Context, clicks []*domain.Click) error {
+	if len(clicks) == 0 {
+		return nil
+	}
+
+	cmds := make(rueidis.Commands, 0, len(clicks))
+	for _, click := range clicks {
+		message, err := json.Marshal(click)
+		if err != nil {
+			return err
+		}
+		cmds = append(cmds, im.redis.B().Publish().Channel(im.getEventChannel(click.ShortCode)).Message(string(message)).Build())
+	}
+	for _, resp := range im.redis.DoMulti(ctx, cmds...) {
+		if err := resp.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (im *impl) SubscribeClicks(ctx context.Context, shortCode string) <-chan *domain.Click {
+	clicks := make(chan *domain.Click, eventBuffer)
+	go func() {
+		defer close(clicks)
+		// messages are handled on the connection reader, so a slow subscriber must never block it
+		im.redis.Receive(ctx, im.redis.B().Subscribe().Channel(im.getEventChannel(shortCode)).Build(), func(msg rueidis.PubSubMessage) {
+			click := &domain.Click{}
+			if err := json.Unmarshal([]byte(msg.Message), click); err != nil {
+				return
+			}
+			select {
+			case clicks <- click:
+			default:
+				stats.Add(statEventDropped, 1)
+			}
+		})
+	}()
+	return clicks
+}
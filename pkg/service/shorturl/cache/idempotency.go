@@ -0,0 +1,145 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/redis/rueidis"
+
+	"github.com/sappy5678/dcard/pkg/domain"
+)
+
+const (
+	idempotencyKey = "idempotency:shorturl:"
+	// idempotencyPendingTTL bounds how long a request which never finished, because its pod died, blocks retries
+	idempotencyPendingTTL = time.Minute
+
+	defaultIdempotencyTTL = 24 * time.Hour
+)
+
+// idempotencyRecord is what a key holds, ShortURL stays nil while its request runs and Token tells which request that is
+type idempotencyRecord struct {
+	Hash     string           `json:"hash"`
+	Token    string           `json:"token,omitempty"`
+	ShortURL *domain.ShortURL `json:"shortUrl,omitempty"`
+}
+
+// releaseIdempotencyScript deletes KEYS[1] while it is still the pending record of the request with the token ARGV[1],
+// a request whose record expired must not free the key of the retry which reserved it since
+var releaseIdempotencyScript = rueidis.NewLuaScript(`
+local value = redis.call("GET", KEYS[1])
+if value and cjson.decode(value).token == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// getIdempotencyKey returns the key of a record, records live in the bloom store, an evicted one would let a retry create a duplicate
+func (im *impl) getIdempotencyKey(key string) string {
+	return im.cfg.BloomKeyPrefix + idempotencyKey + key
+}
+
+func (im *impl) ReserveIdempotencyKey(ctx context.Context, key, hash, token string) (*domain.ShortURL, error) {
+	shorts, errs, err := im.ReserveIdempotencyKeys(ctx, []string{key}, []string{hash}, token)
+	if err != nil {
+		return nil, err
+	}
+	return shorts[0], errs[0]
+}
+
+// ReserveIdempotencyKeys claims all keys with one round trip, and reads the records of the taken ones with another
+func (im *impl) ReserveIdempotencyKeys(ctx context.Context, keys, hashes []string, token string) ([]*domain.ShortURL, []error, error) {
+	cmds := make(rueidis.Commands, len(keys))
+	for i, key := range keys {
+		pending, err := json.Marshal(idempotencyRecord{Hash: hashes[i], Token: token})
+		if err != nil {
+			return nil, nil, err
+		}
+		cmds[i] = im.bloom.B().Set().Key(im.getIdempotencyKey(key)).Value(string(pending)).Nx().Px(idempotencyPendingTTL).Build()
+	}
+	// index in keys of every key which was taken
+	var taken []int
+	for i, resp := range im.bloom.DoMulti(ctx, cmds...) {
+		err := resp.Error()
+		if rueidis.IsRedisNil(err) {
+			taken = append(taken, i)
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	shorts := make([]*domain.ShortURL, len(keys))
+	errs := make([]error, len(keys))
+	if len(taken) == 0 {
+		return shorts, errs, nil
+	}
+	cmds = make(rueidis.Commands, len(taken))
+	for j, i := range taken {
+		cmds[j] = im.bloom.B().Get().Key(im.getIdempotencyKey(keys[i])).Build()
+	}
+	for j, resp := range im.bloom.DoMulti(ctx, cmds...) {
+		i := taken[j]
+		value, err := resp.ToString()
+		if rueidis.IsRedisNil(err) {
+			// the record expired since the SET, the client retries
+			errs[i] = domain.ErrIdempotencyInProgress
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		var record idempotencyRecord
+		if err := json.Unmarshal([]byte(value), &record); err != nil {
+			return nil, nil, err
+		}
+		switch {
+		case record.Hash != hashes[i]:
+			errs[i] = domain.ErrIdempotencyKeyReused
+		case record.ShortURL == nil:
+			errs[i] = domain.ErrIdempotencyInProgress
+		default:
+			shorts[i] = record.ShortURL
+		}
+	}
+	return shorts, errs, nil
+}
+
+func (im *impl) SaveIdempotencyKey(ctx context.Context, key, hash string, short *domain.ShortURL) error {
+	return im.SaveIdempotencyKeys(ctx, []string{key}, []string{hash}, []*domain.ShortURL{short})
+}
+
+func (im *impl) SaveIdempotencyKeys(ctx context.Context, keys, hashes []string, shorts []*domain.ShortURL) error {
+	cmds := make(rueidis.Commands, len(keys))
+	for i, key := range keys {
+		value, err := json.Marshal(idempotencyRecord{Hash: hashes[i], ShortURL: shorts[i]})
+		if err != nil {
+			return err
+		}
+		cmds[i] = im.bloom.B().Set().Key(im.getIdempotencyKey(key)).Value(string(value)).Px(im.cfg.IdempotencyTTL).Build()
+	}
+	for _, resp := range im.bloom.DoMulti(ctx, cmds...) {
+		if err := resp.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (im *impl) ReleaseIdempotencyKey(ctx context.Context, key, token string) error {
+	return im.ReleaseIdempotencyKeys(ctx, []string{key}, token)
+}
+
+func (im *impl) ReleaseIdempotencyKeys(ctx context.Context, keys []string, token string) error {
+	execs := make([]rueidis.LuaExec, len(keys))
+	for i, key := range keys {
+		execs[i] = rueidis.LuaExec{Keys: []string{im.getIdempotencyKey(key)}, Args: []string{token}}
+	}
+	for _, resp := range releaseIdempotencyScript.ExecMulti(ctx, im.bloom, execs...) {
+		if err := resp.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
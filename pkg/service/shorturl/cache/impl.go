@@ -3,6 +3,10 @@ package cache
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"expvar"
+	"math/rand/v2"
+	"time"
 
 	"github.com/redis/rueidis"
 	"github.com/redis/rueidis/rueidislock"
@@ -13,26 +17,120 @@ import (
 
 type impl struct {
 	repo   repository.Repository
-	redis  rueidis.Client
+	bloom  rueidis.Client // holds the bloom filter, should not evict keys
+	redis  rueidis.Client // holds cache entries, may evict keys
 	locker rueidislock.Locker
+	cfg    Config
+	now    func() time.Time
+}
+
+// Config represents cache specific config
+type Config struct {
+	// MaxTTL caps how long an entry is cached, even if its short url expires later
+	MaxTTL time.Duration
+	// TTLJitter is a random extra added to MaxTTL so entries cached together don't expire together
+	TTLJitter time.Duration
+	// NegativeTTL is how long a short code that passed the bloom filter but is not in the database is remembered
+	NegativeTTL time.Duration
+	// LocalTTL is how long an entry stays in the in-process cache of the redis client, 0 disables it.
+	// Redis invalidates it as soon as the key changes, so this only bounds memory and staleness on lost invalidations.
+	LocalTTL time.Duration
+	// IdempotencyTTL is how long the short url created under an idempotency key is returned to retries
+	IdempotencyTTL time.Duration
+	// BloomKeyPrefix and CacheKeyPrefix are prepended to the keys in the bloom and cache store
+	BloomKeyPrefix string
+	CacheKeyPrefix string
+}
+
+// stats counts cache hits and misses of every tier, served on /debug/vars
+var stats = expvar.NewMap("shorturl_cache")
+
+const (
+	statLocalHit           = "local_hit"
+	statLocalMiss          = "local_miss"
+	statRedisHit           = "redis_hit"
+	statRedisMiss          = "redis_miss"
+	statNegativeHit        = "negative_hit"
+	statBloomPass          = "bloom_pass"
+	statBloomFalsePositive = "bloom_false_positive"
+	// statDeletedMiss counts codes which missed the database because they were deleted, once their tombstone expired
+	statDeletedMiss = "deleted_miss"
+)
+
+func init() {
+	// share of the codes passing the bloom filter which turned out not to exist
+	stats.Set("bloom_false_positive_rate", expvar.Func(func() any {
+		pass, falsePositive := stats.Get(statBloomPass), stats.Get(statBloomFalsePositive)
+		if pass == nil || falsePositive == nil {
+			return 0.0
+		}
+		return float64(falsePositive.(*expvar.Int).Value()) / float64(pass.(*expvar.Int).Value())
+	}))
 }
 
 const (
 	bfKey = "bf:shorturl"
 	bfCap = 1e10
 	bfErr = 1e-6
+	// the filter of deleted codes only tells them from false positives, it starts small and grows with the deletes
+	bfDeletedKey = "bf:shorturl:deleted"
+	bfDeletedCap = 1e6
+
+	// the bloom filter cannot remove items, so deleted short codes and false positives are answered by a tombstone in their cache key
+	tombstone    = "-"
+	tombstoneTTL = 7 * 24 * time.Hour
+
+	defaultMaxTTL      = 24 * time.Hour
+	defaultNegativeTTL = time.Minute
 )
 
-func New(r repository.Repository, redis rueidis.Client, locker rueidislock.Locker) Repository {
-	return &impl{
+// New returns a Repository keeping the bloom filter in bloom and cache entries in redis, they may be the same client
+func New(r repository.Repository, bloom rueidis.Client, redis rueidis.Client, locker rueidislock.Locker, cfg *Config) Repository {
+	im := &impl{
 		repo:   r,
+		bloom:  bloom,
 		redis:  redis,
 		locker: locker,
+		cfg:    Config{MaxTTL: defaultMaxTTL, NegativeTTL: defaultNegativeTTL, IdempotencyTTL: defaultIdempotencyTTL},
+		now:    time.Now,
 	}
+	if cfg != nil {
+		if cfg.MaxTTL > 0 {
+			im.cfg.MaxTTL = cfg.MaxTTL
+		}
+		if cfg.NegativeTTL > 0 {
+			im.cfg.NegativeTTL = cfg.NegativeTTL
+		}
+		if cfg.IdempotencyTTL > 0 {
+			im.cfg.IdempotencyTTL = cfg.IdempotencyTTL
+		}
+		im.cfg.TTLJitter = cfg.TTLJitter
+		im.cfg.LocalTTL = cfg.LocalTTL
+		im.cfg.BloomKeyPrefix = cfg.BloomKeyPrefix
+		im.cfg.CacheKeyPrefix = cfg.CacheKeyPrefix
+	}
+	return im
 }
 
 func (im *impl) getCacheKey(shortCode string) string {
-	return "shorturl:" + shortCode
+	return im.cfg.CacheKeyPrefix + "shorturl:" + shortCode
+}
+
+func (im *impl) getBloomKey() string {
+	return im.cfg.BloomKeyPrefix + bfKey
+}
+
+func (im *impl) getDeletedBloomKey() string {
+	return im.cfg.BloomKeyPrefix + bfDeletedKey
+}
+
+func (im *impl) ScanShortCodes(ctx context.Context, createdSince uint64, fn func(shortCodes []string) error) error {
+	return im.repo.ScanShortCodes(ctx, createdSince, fn)
+}
+
+// FindDuplicate is not cached, it is only asked when creating a short url
+func (im *impl) FindDuplicate(ctx context.Context, short *domain.ShortURL) (*domain.ShortURL, error) {
+	return im.repo.FindDuplicate(ctx, short)
 }
 
 func (im *impl) Create(ctx context.Context, short *domain.ShortURL) (*domain.ShortURL, error) {
@@ -40,7 +138,65 @@ func (im *impl) Create(ctx context.Context, short *domain.ShortURL) (*domain.Sho
 	if err != nil {
 		return nil, err
 	}
-	return im.repo.Create(ctx, short)
+	short, err = im.repo.Create(ctx, short)
+	if err != nil {
+		return nil, err
+	}
+	// an alias may reuse a deleted short code, drop its tombstone
+	if err := im.deleteCache(ctx, short.ShortCode); err != nil {
+		return nil, err
+	}
+	return short, nil
+}
+
+// CreateOrFindDuplicate adds the code of short to the bloom filter like Create, it is only a false positive when a duplicate is returned
+func (im *impl) CreateOrFindDuplicate(ctx context.Context, short *domain.ShortURL) (*domain.ShortURL, error) {
+	if err := im.addBloomFilter(ctx, short.ShortCode); err != nil {
+		return nil, err
+	}
+	created, err := im.repo.CreateOrFindDuplicate(ctx, short)
+	if err != nil {
+		return nil, err
+	}
+	if created.ShortCode != short.ShortCode {
+		return created, nil
+	}
+	if err := im.deleteCache(ctx, short.ShortCode); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+func (im *impl) CreateBatch(ctx context.Context, shorts []*domain.ShortURL) ([]error, error) {
+	if len(shorts) == 0 {
+		return nil, nil
+	}
+	shortCodes := make([]string, len(shorts))
+	for i, short := range shorts {
+		shortCodes[i] = short.ShortCode
+	}
+	// one BF.INSERT for the whole batch, a code left over by a failed insert is only a false positive
+	if err := im.addBloomFilter(ctx, shortCodes...); err != nil {
+		return nil, err
+	}
+	errs, err := im.repo.CreateBatch(ctx, shorts)
+	if err != nil {
+		return nil, err
+	}
+
+	// aliases may reuse deleted short codes, drop their tombstones in one round trip
+	cmds := make(rueidis.Commands, 0, len(shorts))
+	for i, short := range shorts {
+		if errs[i] == nil {
+			cmds = append(cmds, im.redis.B().Del().Key(im.getCacheKey(short.ShortCode)).Build())
+		}
+	}
+	for _, resp := range im.redis.DoMulti(ctx, cmds...) {
+		if err := resp.Error(); err != nil {
+			return nil, err
+		}
+	}
+	return errs, nil
 }
 
 func (im *impl) Get(ctx context.Context, shortCode string) (*domain.ShortURL, error) {
@@ -52,6 +208,7 @@ func (im *impl) Get(ctx context.Context, shortCode string) (*domain.ShortURL, er
 	if !isExist {
 		return nil, domain.ErrShortURLNotFound
 	}
+	stats.Add(statBloomPass, 1)
 
 	// Get the short URL from the cache
 	short, err := im.getCache(ctx, shortCode)
@@ -80,6 +237,9 @@ func (im *impl) Get(ctx context.Context, shortCode string) (*domain.ShortURL, er
 	}
 	// Cache miss, get data and set it to cache
 	short, err = im.repo.Get(ctx, shortCode)
+	if errors.Is(err, domain.ErrShortURLNotFound) {
+		return im.getMissing(ctx, shortCode)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -88,31 +248,203 @@ func (im *impl) Get(ctx context.Context, shortCode string) (*domain.ShortURL, er
 	return short, nil
 }
 
-func (im *impl) addBloomFilter(ctx context.Context, shortCode string) error {
-	cmd := im.redis.B().BfInsert().Key(bfKey).Capacity(bfCap).Error(bfErr).Items().Item(shortCode).Build()
-	if _, err := im.redis.Do(ctx, cmd).AsIntSlice(); err != nil {
+// GetMany reads the cached short urls in one round trip and the rest from the database in one query.
+// It skips the bloom filter and the lock and does not fill the cache, so it cannot race a delete into caching a stale entry.
+func (im *impl) GetMany(ctx context.Context, shortCodes []string) ([]*domain.ShortURL, error) {
+	if len(shortCodes) == 0 {
+		return nil, nil
+	}
+	keys := make([]string, len(shortCodes))
+	for i, shortCode := range shortCodes {
+		keys[i] = im.getCacheKey(shortCode)
+	}
+	var cached map[string]rueidis.RedisMessage
+	var err error
+	if im.cfg.LocalTTL > 0 {
+		cached, err = rueidis.MGetCache(im.redis, ctx, im.cfg.LocalTTL, keys)
+	} else {
+		cached, err = rueidis.MGet(im.redis, ctx, keys)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	shorts := make([]*domain.ShortURL, 0, len(shortCodes))
+	var missing []string
+	for i, key := range keys {
+		message := cached[key]
+		jsonBytes, err := message.AsBytes()
+		if rueidis.IsRedisNil(err) {
+			missing = append(missing, shortCodes[i])
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if string(jsonBytes) == tombstone {
+			continue
+		}
+		var short domain.ShortURL
+		if err := json.Unmarshal(jsonBytes, &short); err != nil {
+			return nil, err
+		}
+		shorts = append(shorts, &short)
+	}
+	if len(missing) == 0 {
+		return shorts, nil
+	}
+	fromDB, err := im.repo.GetMany(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	return append(shorts, fromDB...), nil
+}
+
+// getMissing remembers a code which passed the bloom filter but is not in the database, so probing it cannot hammer the database.
+// Creates do not take the lock, one may insert the code and drop its entry between the miss and the negative entry,
+// so the database is asked again once the entry is written and a code found then is cached instead.
+func (im *impl) getMissing(ctx context.Context, shortCode string) (*domain.ShortURL, error) {
+	if err := im.setNegative(ctx, shortCode); err != nil {
+		// even if an error occurs, it is not necessary to return an error
+		im.countMissing(ctx, shortCode)
+		return nil, domain.ErrShortURLNotFound
+	}
+	short, err := im.repo.Get(ctx, shortCode)
+	if errors.Is(err, domain.ErrShortURLNotFound) {
+		im.countMissing(ctx, shortCode)
+		return nil, err
+	}
+	// the negative entry is wrong or unconfirmed either way
+	im.deleteCache(ctx, shortCode) // even if an error occurs, it is not necessary to return an error
+	if err != nil {
+		return nil, err
+	}
+	im.setCache(ctx, short) // even if an error occurs, it is not necessary to return an error
+	return short, nil
+}
+
+// countMissing counts a code missing from the database as a bloom filter false positive, unless it was deleted
+func (im *impl) countMissing(ctx context.Context, shortCode string) {
+	cmd := im.bloom.B().BfExists().Key(im.getDeletedBloomKey()).Item(shortCode).Build()
+	if deleted, err := im.bloom.Do(ctx, cmd).AsBool(); err == nil && deleted {
+		stats.Add(statDeletedMiss, 1)
+		return
+	}
+	stats.Add(statBloomFalsePositive, 1)
+}
+
+func (im *impl) Update(ctx context.Context, shortCode string, apply func(short *domain.ShortURL) error) (*domain.ShortURL, error) {
+	var short *domain.ShortURL
+	err := im.withLock(ctx, shortCode, func(ctx context.Context) error {
+		var err error
+		short, err = im.repo.Update(ctx, shortCode, apply)
+		if err != nil {
+			return err
+		}
+		return im.deleteCache(ctx, shortCode)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return short, nil
+}
+
+func (im *impl) Delete(ctx context.Context, shortCode string) error {
+	return im.withLock(ctx, shortCode, func(ctx context.Context) error {
+		if err := im.repo.Delete(ctx, shortCode); err != nil {
+			return err
+		}
+		if err := im.setTombstone(ctx, shortCode); err != nil {
+			return err
+		}
+		// the visitor counter does not expire, the ones of days do by themselves.
+		// Even if an error occurs, it is not necessary to return an error
+		im.bloom.Do(ctx, im.bloom.B().Del().Key(im.getVisitorKey(shortCode)).Build())
+		// remembered after the tombstone expired, so the code does not count as a false positive then.
+		// It only feeds the stats, even if an error occurs, it is not necessary to return an error
+		cmd := im.bloom.B().BfInsert().Key(im.getDeletedBloomKey()).Capacity(bfDeletedCap).Error(bfErr).Items().Item(shortCode).Build()
+		im.bloom.Do(ctx, cmd)
+		return nil
+	})
+}
+
+func (im *impl) Disable(ctx context.Context, shortCode string) error {
+	return im.withLock(ctx, shortCode, func(ctx context.Context) error {
+		if err := im.repo.Disable(ctx, shortCode); err != nil {
+			return err
+		}
+		return im.deleteCache(ctx, shortCode)
+	})
+}
+
+// withLock runs fn holding the lock Get fills the cache under, so a Get which read the row before fn changed it
+// has written its entry before fn invalidates it, instead of caching the old row after
+func (im *impl) withLock(ctx context.Context, shortCode string, fn func(ctx context.Context) error) error {
+	ctx, cancel, err := im.locker.WithContext(ctx, shortCode)
+	if err != nil {
 		return err
 	}
-	return nil
+	defer cancel()
+	return fn(ctx)
 }
 
 func (im *impl) setCache(ctx context.Context, short *domain.ShortURL) error {
+	ttl := im.cacheTTL(short)
 	key := im.getCacheKey(short.ShortCode)
 	jsonBytes, err := json.Marshal(short)
 	if err != nil {
 		return err
 	}
-	cmd := im.redis.B().Set().Key(key).Value(string(jsonBytes)).Build()
+	cmd := im.redis.B().Set().Key(key).Value(string(jsonBytes)).Px(ttl).Build()
 	return im.redis.Do(ctx, cmd).Error()
 }
 
-func (im *impl) getCache(ctx context.Context, shortCode string) (*domain.ShortURL, error) {
+// cacheTTL keeps an entry no longer than its short url is valid, and no longer than MaxTTL plus jitter.
+// An expired short url is kept for NegativeTTL, so visits of a popular expired one are answered without the database.
+func (im *impl) cacheTTL(short *domain.ShortURL) time.Duration {
+	untilExpire := time.Unix(int64(short.ExpireTime), 0).Sub(im.now())
+	if untilExpire < time.Millisecond {
+		return im.cfg.NegativeTTL
+	}
+	ttl := im.cfg.MaxTTL
+	if im.cfg.TTLJitter > 0 {
+		ttl += rand.N(im.cfg.TTLJitter)
+	}
+	if untilExpire < ttl {
+		return untilExpire
+	}
+	return ttl
+}
+
+func (im *impl) setTombstone(ctx context.Context, shortCode string) error {
 	key := im.getCacheKey(shortCode)
-	cmd := im.redis.B().Get().Key(key).Build()
-	jsonBytes, err := im.redis.Do(ctx, cmd).AsBytes()
+	cmd := im.redis.B().Set().Key(key).Value(tombstone).Ex(tombstoneTTL).Build()
+	return im.redis.Do(ctx, cmd).Error()
+}
+
+// setNegative caches a not found result, Create drops it once the short code is taken.
+// It never replaces an entry, rueidis.Nil when there is one.
+func (im *impl) setNegative(ctx context.Context, shortCode string) error {
+	key := im.getCacheKey(shortCode)
+	cmd := im.redis.B().Set().Key(key).Value(tombstone).Nx().Px(im.cfg.NegativeTTL).Build()
+	return im.redis.Do(ctx, cmd).Error()
+}
+
+func (im *impl) deleteCache(ctx context.Context, shortCode string) error {
+	key := im.getCacheKey(shortCode)
+	cmd := im.redis.B().Del().Key(key).Build()
+	return im.redis.Do(ctx, cmd).Error()
+}
+
+func (im *impl) getCache(ctx context.Context, shortCode string) (*domain.ShortURL, error) {
+	jsonBytes, err := im.getCacheBytes(ctx, shortCode)
 	if err != nil {
 		return nil, err
 	}
+	if string(jsonBytes) == tombstone {
+		stats.Add(statNegativeHit, 1)
+		return nil, domain.ErrShortURLNotFound
+	}
 	var short domain.ShortURL
 	if err := json.Unmarshal(jsonBytes, &short); err != nil {
 		return nil, err
@@ -120,9 +452,34 @@ func (im *impl) getCache(ctx context.Context, shortCode string) (*domain.ShortUR
 	return &short, nil
 }
 
+// getCacheBytes reads the in-process cache first and falls back to Redis
+func (im *impl) getCacheBytes(ctx context.Context, shortCode string) ([]byte, error) {
+	key := im.getCacheKey(shortCode)
+	if im.cfg.LocalTTL <= 0 {
+		return im.countRedis(im.redis.Do(ctx, im.redis.B().Get().Key(key).Build()).AsBytes())
+	}
+
+	result := im.redis.DoCache(ctx, im.redis.B().Get().Key(key).Cache(), im.cfg.LocalTTL)
+	if result.IsCacheHit() {
+		stats.Add(statLocalHit, 1)
+		return result.AsBytes()
+	}
+	stats.Add(statLocalMiss, 1)
+	return im.countRedis(result.AsBytes())
+}
+
+func (im *impl) countRedis(jsonBytes []byte, err error) ([]byte, error) {
+	if err == nil {
+		stats.Add(statRedisHit, 1)
+	} else if rueidis.IsRedisNil(err) {
+		stats.Add(statRedisMiss, 1)
+	}
+	return jsonBytes, err
+}
+
 func (im *impl) isExist(ctx context.Context, shortCode string) (bool, error) {
-	cmd := im.redis.B().BfExists().Key(bfKey).Item(shortCode).Build()
-	isExist, err := im.redis.Do(ctx, cmd).AsBool()
+	cmd := im.bloom.B().BfExists().Key(im.getBloomKey()).Item(shortCode).Build()
+	isExist, err := im.bloom.Do(ctx, cmd).AsBool()
 	if err != nil {
 		return false, err
 	}
@@ -2,7 +2,9 @@ package cache
 
 import (
 	"context"
+	"expvar"
 	"testing"
+	"time"
 
 	"github.com/redis/rueidis"
 	"github.com/redis/rueidis/rueidislock"
@@ -15,6 +17,8 @@ import (
 	redisLocker "github.com/sappy5678/dcard/pkg/utl/locker"
 )
 
+var validExpireTime = uint64(time.Now().Add(24 * time.Hour).Unix())
+
 type TestSuite struct {
 	suite.Suite
 	impl       *impl
@@ -46,7 +50,7 @@ func (ts *TestSuite) SetupSuite() {
 	ts.locker, err = redisLocker.New(endpoint)
 	ts.Require().NoError(err)
 	ts.mockRepo = &repository.MockShortURLRepository{}
-	ts.impl = New(ts.mockRepo, ts.redis, ts.locker).(*impl)
+	ts.impl = New(ts.mockRepo, ts.redis, ts.redis, ts.locker, &Config{MaxTTL: time.Hour}).(*impl)
 }
 
 func (ts *TestSuite) TearDownSuite() {
@@ -77,12 +81,62 @@ func (ts *TestSuite) TestCreate() {
 	ts.Require().True(isExist)
 }
 
+func (ts *TestSuite) TestCreateOrFindDuplicate() {
+	ctx := context.Background()
+	ts.Require().NoError(ts.impl.setTombstone(ctx, "deduped"))
+	ts.mockRepo.CreateOrFindDuplicateFunc = func(ctx context.Context, short *domain.ShortURL) (*domain.ShortURL, error) {
+		return short, nil
+	}
+	short := &domain.ShortURL{ShortCode: "deduped", OriginalURL: "http://test.com"}
+	created, err := ts.impl.CreateOrFindDuplicate(ctx, short)
+	ts.Require().NoError(err)
+	ts.Require().Equal(short, created)
+	isExist, err := ts.impl.isExist(ctx, short.ShortCode)
+	ts.Require().NoError(err)
+	ts.Require().True(isExist)
+	_, err = ts.impl.getCache(ctx, short.ShortCode)
+	ts.Require().True(rueidis.IsRedisNil(err))
+
+	// a duplicate found instead keeps the cache of the code which was not inserted
+	existing := &domain.ShortURL{ShortCode: "existing", OriginalURL: "http://test.com"}
+	ts.mockRepo.CreateOrFindDuplicateFunc = func(ctx context.Context, short *domain.ShortURL) (*domain.ShortURL, error) {
+		return existing, nil
+	}
+	ts.Require().NoError(ts.impl.setTombstone(ctx, "unused"))
+	created, err = ts.impl.CreateOrFindDuplicate(ctx, &domain.ShortURL{ShortCode: "unused", OriginalURL: "http://test.com"})
+	ts.Require().NoError(err)
+	ts.Require().Equal(existing, created)
+	_, err = ts.impl.getCache(ctx, "unused")
+	ts.Require().ErrorIs(err, domain.ErrShortURLNotFound)
+}
+
+func (ts *TestSuite) TestCreateBatch() {
+	ctx := context.Background()
+	ts.mockRepo.CreateBatchFunc = func(ctx context.Context, shorts []*domain.ShortURL) ([]error, error) {
+		return []error{nil, domain.ErrShortURLConflict}, nil
+	}
+	// a deleted code reused by the batch loses its tombstone
+	ts.Require().NoError(ts.impl.setTombstone(ctx, "batch-1"))
+
+	errs, err := ts.impl.CreateBatch(ctx, []*domain.ShortURL{{ShortCode: "batch-1"}, {ShortCode: "batch-2"}})
+	ts.Require().NoError(err)
+	ts.Require().Equal([]error{nil, domain.ErrShortURLConflict}, errs)
+	for _, shortCode := range []string{"batch-1", "batch-2"} {
+		isExist, err := ts.impl.isExist(ctx, shortCode)
+		ts.Require().NoError(err)
+		ts.Require().True(isExist)
+	}
+	_, err = ts.impl.getCache(ctx, "batch-1")
+	ts.Require().ErrorIs(err, rueidis.Nil)
+}
+
 func (ts *TestSuite) TestGet_CacheHit() {
 	ctx := context.Background()
 	shortCode := "exist123"
 	expected := &domain.ShortURL{
 		ShortCode:   shortCode,
 		OriginalURL: "http://exist.com",
+		ExpireTime:  validExpireTime,
 	}
 
 	// prefill cache
@@ -108,6 +162,7 @@ func (ts *TestSuite) TestGet_CacheMiss_DBHit() {
 	expected := &domain.ShortURL{
 		ShortCode:   shortCode,
 		OriginalURL: "http://db.com",
+		ExpireTime:  validExpireTime,
 	}
 
 	// setup Mock and cache
@@ -132,6 +187,31 @@ func (ts *TestSuite) TestGet_CacheMiss_DBHit() {
 	ts.Require().Equal(expected, cached)
 }
 
+func (ts *TestSuite) TestGetMany() {
+	ctx := context.Background()
+	cached := &domain.ShortURL{ShortCode: "many1", OriginalURL: "http://cache.com", ExpireTime: validExpireTime}
+	fromDB := &domain.ShortURL{ShortCode: "many2", OriginalURL: "http://db.com", ExpireTime: validExpireTime}
+	ts.Require().NoError(ts.impl.setCache(ctx, cached))
+	ts.Require().NoError(ts.impl.setTombstone(ctx, "deleted1"))
+
+	// only the codes missing from the cache reach the database, in one call
+	calls := 0
+	ts.mockRepo.GetManyFunc = func(ctx context.Context, shortCodes []string) ([]*domain.ShortURL, error) {
+		calls++
+		ts.Require().Equal([]string{"many2", "missing1"}, shortCodes)
+		return []*domain.ShortURL{fromDB}, nil
+	}
+
+	shorts, err := ts.impl.GetMany(ctx, []string{"many1", "deleted1", "many2", "missing1"})
+	ts.Require().NoError(err)
+	ts.Require().Equal([]*domain.ShortURL{cached, fromDB}, shorts)
+	ts.Require().Equal(1, calls)
+
+	// the database rows are not cached
+	_, err = ts.impl.getCache(ctx, "many2")
+	ts.Require().True(rueidis.IsRedisNil(err))
+}
+
 func (ts *TestSuite) TestGet_InvalidShortCode() {
 	ctx := context.Background()
 	shortCode := "invalid"
@@ -154,10 +234,13 @@ func (ts *TestSuite) TestGet_InvalidShortCodeFromDB() {
 	ctx := context.Background()
 	shortCode := "invalid"
 
+	calls := 0
 	ts.mockRepo.GetFunc = func(ctx context.Context, code string) (*domain.ShortURL, error) {
+		calls++
 		return nil, domain.ErrShortURLNotFound
 	}
 	ts.impl.addBloomFilter(ctx, shortCode) // bloom filter pass invalid short code
+	falsePositives := statValue(statBloomFalsePositive)
 
 	_, err := ts.impl.Get(ctx, shortCode)
 	ts.Require().ErrorIs(err, domain.ErrShortURLNotFound)
@@ -166,6 +249,525 @@ func (ts *TestSuite) TestGet_InvalidShortCodeFromDB() {
 	isExist, err := ts.impl.isExist(ctx, shortCode)
 	ts.Require().NoError(err)
 	ts.Require().True(isExist)
+
+	// the false positive is cached, probing it again doesn't reach the database,
+	// which is asked twice only to confirm the miss once the negative entry is written
+	_, err = ts.impl.Get(ctx, shortCode)
+	ts.Require().ErrorIs(err, domain.ErrShortURLNotFound)
+	ts.Require().Equal(2, calls)
+	ts.Require().Equal(falsePositives+1, statValue(statBloomFalsePositive))
+
+	pttl, err := ts.redis.Do(ctx, ts.redis.B().Pttl().Key(ts.impl.getCacheKey(shortCode)).Build()).AsInt64()
+	ts.Require().NoError(err)
+	ts.Require().Greater(pttl, int64(0))
+	ts.Require().LessOrEqual(pttl, defaultNegativeTTL.Milliseconds())
+}
+
+func (ts *TestSuite) TestGet_CreatedDuringMiss() {
+	ctx := context.Background()
+	shortCode := "alias123"
+	expected := &domain.ShortURL{ShortCode: shortCode, OriginalURL: "http://alias.com", ExpireTime: validExpireTime}
+
+	// the alias is created, and its cache entry dropped, between the miss and the negative entry
+	calls := 0
+	ts.mockRepo.GetFunc = func(ctx context.Context, code string) (*domain.ShortURL, error) {
+		calls++
+		if calls == 1 {
+			return nil, domain.ErrShortURLNotFound
+		}
+		return expected, nil
+	}
+	ts.Require().NoError(ts.impl.addBloomFilter(ctx, shortCode))
+	falsePositives := statValue(statBloomFalsePositive)
+
+	result, err := ts.impl.Get(ctx, shortCode)
+	ts.Require().NoError(err)
+	ts.Require().Equal(expected, result)
+	cached, err := ts.impl.getCache(ctx, shortCode)
+	ts.Require().NoError(err)
+	ts.Require().Equal(expected, cached)
+	ts.Require().Equal(falsePositives, statValue(statBloomFalsePositive))
+}
+
+func (ts *TestSuite) TestGet_DeletedAfterTombstone() {
+	ctx := context.Background()
+	shortCode := "gone123"
+	ts.mockRepo.DeleteFunc = func(ctx context.Context, code string) error {
+		return nil
+	}
+	ts.mockRepo.GetFunc = func(ctx context.Context, code string) (*domain.ShortURL, error) {
+		return nil, domain.ErrShortURLNotFound
+	}
+	ts.Require().NoError(ts.impl.addBloomFilter(ctx, shortCode))
+	ts.Require().NoError(ts.impl.Delete(ctx, shortCode))
+	// the tombstone expires
+	ts.Require().NoError(ts.impl.deleteCache(ctx, shortCode))
+	falsePositives := statValue(statBloomFalsePositive)
+	deletedMisses := statValue(statDeletedMiss)
+
+	_, err := ts.impl.Get(ctx, shortCode)
+	ts.Require().ErrorIs(err, domain.ErrShortURLNotFound)
+	ts.Require().Equal(falsePositives, statValue(statBloomFalsePositive))
+	ts.Require().Equal(deletedMisses+1, statValue(statDeletedMiss))
+}
+
+func (ts *TestSuite) TestDelete() {
+	ctx := context.Background()
+	shortCode := "deleted123"
+	ts.mockRepo.DeleteFunc = func(ctx context.Context, code string) error {
+		ts.Require().Equal(shortCode, code)
+		return nil
+	}
+	ts.Require().NoError(ts.impl.addBloomFilter(ctx, shortCode))
+	ts.Require().NoError(ts.impl.setCache(ctx, &domain.ShortURL{ShortCode: shortCode, OriginalURL: "http://deleted.com", ExpireTime: validExpireTime}))
+
+	ts.Require().NoError(ts.impl.Delete(ctx, shortCode))
+
+	// the bloom filter still passes, the tombstone keeps the request away from the database
+	ts.mockRepo.GetFunc = func(ctx context.Context, code string) (*domain.ShortURL, error) {
+		ts.Fail("should not be called")
+		return nil, nil
+	}
+	_, err := ts.impl.Get(ctx, shortCode)
+	ts.Require().ErrorIs(err, domain.ErrShortURLNotFound)
+
+	// recreating the short code drops the tombstone
+	ts.mockRepo.CreateFunc = func(ctx context.Context, short *domain.ShortURL) (*domain.ShortURL, error) {
+		return short, nil
+	}
+	_, err = ts.impl.Create(ctx, &domain.ShortURL{ShortCode: shortCode, OriginalURL: "http://new.com"})
+	ts.Require().NoError(err)
+	_, err = ts.impl.getCache(ctx, shortCode)
+	ts.Require().ErrorIs(err, rueidis.Nil)
+}
+
+func (ts *TestSuite) TestDelete_WaitsForGet() {
+	ctx := context.Background()
+	shortCode := "racing123"
+	deleted := make(chan struct{})
+	ts.mockRepo.DeleteFunc = func(ctx context.Context, code string) error {
+		close(deleted)
+		return nil
+	}
+
+	// a Get filling the cache holds the lock of the short code
+	_, release, err := ts.locker.WithContext(ctx, shortCode)
+	ts.Require().NoError(err)
+	done := make(chan error, 1)
+	go func() { done <- ts.impl.Delete(ctx, shortCode) }()
+
+	select {
+	case <-deleted:
+		ts.Fail("deleted while a Get holds the lock")
+	case <-time.After(100 * time.Millisecond):
+	}
+	// the Get caches the row it read, the delete replaces it once the lock is free
+	ts.Require().NoError(ts.impl.setCache(ctx, &domain.ShortURL{ShortCode: shortCode, OriginalURL: "http://racing.com", ExpireTime: validExpireTime}))
+	release()
+	ts.Require().NoError(<-done)
+	_, err = ts.impl.getCache(ctx, shortCode)
+	ts.Require().ErrorIs(err, domain.ErrShortURLNotFound)
+}
+
+func (ts *TestSuite) TestUpdate() {
+	ctx := context.Background()
+	shortCode := "updated123"
+	ts.mockRepo.UpdateFunc = func(ctx context.Context, code string, apply func(short *domain.ShortURL) error) (*domain.ShortURL, error) {
+		short := &domain.ShortURL{ShortCode: code, OriginalURL: "http://typo.com"}
+		return short, apply(short)
+	}
+	ts.Require().NoError(ts.impl.setCache(ctx, &domain.ShortURL{ShortCode: shortCode, OriginalURL: "http://typo.com", ExpireTime: validExpireTime}))
+
+	updated, err := ts.impl.Update(ctx, shortCode, func(short *domain.ShortURL) error {
+		short.OriginalURL = "http://fixed.com"
+		return nil
+	})
+	ts.Require().NoError(err)
+	ts.Require().Equal("http://fixed.com", updated.OriginalURL)
+
+	_, err = ts.impl.getCache(ctx, shortCode)
+	ts.Require().ErrorIs(err, rueidis.Nil)
+}
+
+func (ts *TestSuite) TestDisable() {
+	ctx := context.Background()
+	shortCode := "disabled123"
+	ts.mockRepo.DisableFunc = func(ctx context.Context, code string) error {
+		return nil
+	}
+	ts.Require().NoError(ts.impl.setCache(ctx, &domain.ShortURL{ShortCode: shortCode, OriginalURL: "http://disabled.com", ExpireTime: validExpireTime}))
+
+	ts.Require().NoError(ts.impl.Disable(ctx, shortCode))
+
+	_, err := ts.impl.getCache(ctx, shortCode)
+	ts.Require().ErrorIs(err, rueidis.Nil)
+}
+
+func (ts *TestSuite) TestSetCache_TTL() {
+	ctx := context.Background()
+	expireSoon := &domain.ShortURL{
+		ShortCode:   "soon123",
+		OriginalURL: "http://soon.com",
+		ExpireTime:  uint64(time.Now().Add(time.Minute).Unix()),
+	}
+	ts.Require().NoError(ts.impl.setCache(ctx, expireSoon))
+	pttl, err := ts.redis.Do(ctx, ts.redis.B().Pttl().Key(ts.impl.getCacheKey(expireSoon.ShortCode)).Build()).AsInt64()
+	ts.Require().NoError(err)
+	ts.Require().Greater(pttl, int64(0))
+	ts.Require().LessOrEqual(pttl, time.Minute.Milliseconds())
+
+	expired := &domain.ShortURL{
+		ShortCode:   "expired123",
+		OriginalURL: "http://expired.com",
+		ExpireTime:  uint64(time.Now().Add(-time.Minute).Unix()),
+	}
+	ts.Require().NoError(ts.impl.setCache(ctx, expired))
+	// an expired short url is cached too, for the negative ttl
+	cached, err := ts.impl.getCache(ctx, expired.ShortCode)
+	ts.Require().NoError(err)
+	ts.Require().Equal(expired.OriginalURL, cached.OriginalURL)
+	pttl, err = ts.redis.Do(ctx, ts.redis.B().Pttl().Key(ts.impl.getCacheKey(expired.ShortCode)).Build()).AsInt64()
+	ts.Require().NoError(err)
+	ts.Require().Greater(pttl, int64(0))
+	ts.Require().LessOrEqual(pttl, defaultNegativeTTL.Milliseconds())
+}
+
+func (ts *TestSuite) TestGet_Expired() {
+	ctx := context.Background()
+	shortCode := "expiredGet"
+	ts.Require().NoError(ts.impl.addBloomFilter(ctx, shortCode))
+	expired := &domain.ShortURL{ShortCode: shortCode, OriginalURL: "http://expired.com", ExpireTime: uint64(time.Now().Add(-time.Minute).Unix())}
+	ts.mockRepo.GetFunc = func(ctx context.Context, code string) (*domain.ShortURL, error) {
+		return expired, nil
+	}
+	_, err := ts.impl.Get(ctx, shortCode)
+	ts.Require().NoError(err)
+
+	// later visits of the expired short url do not reach the database
+	ts.mockRepo.GetFunc = func(ctx context.Context, code string) (*domain.ShortURL, error) {
+		ts.Fail("expired short url read from the database again")
+		return nil, domain.ErrShortURLNotFound
+	}
+	cached, err := ts.impl.Get(ctx, shortCode)
+	ts.Require().NoError(err)
+	ts.Require().Equal(expired.ExpireTime, cached.ExpireTime)
+}
+
+func (ts *TestSuite) TestGetCache_Local() {
+	ctx := context.Background()
+	local := New(ts.mockRepo, ts.redis, ts.redis, ts.locker, &Config{MaxTTL: time.Hour, LocalTTL: time.Minute}).(*impl)
+	short := &domain.ShortURL{
+		ShortCode:   "local123",
+		OriginalURL: "http://local.com",
+		ExpireTime:  validExpireTime,
+	}
+	ts.Require().NoError(local.setCache(ctx, short))
+
+	hits := statValue(statLocalHit)
+	misses := statValue(statLocalMiss)
+
+	// first read fills the in-process cache, second one is served from it
+	for i := 0; i < 2; i++ {
+		got, err := local.getCache(ctx, short.ShortCode)
+		ts.Require().NoError(err)
+		ts.Require().Equal(short, got)
+	}
+	ts.Require().Equal(misses+1, statValue(statLocalMiss))
+	ts.Require().Equal(hits+1, statValue(statLocalHit))
+
+	// a change in Redis invalidates the in-process copy
+	ts.Require().NoError(local.deleteCache(ctx, short.ShortCode))
+	ts.Require().Eventually(func() bool {
+		_, err := local.getCache(ctx, short.ShortCode)
+		return rueidis.IsRedisNil(err)
+	}, time.Second, 10*time.Millisecond)
+}
+
+func statValue(name string) int64 {
+	if v, ok := stats.Get(name).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+func (ts *TestSuite) TestRebuildBloomFilter() {
+	ctx := context.Background()
+	ts.mockRepo.ScanShortCodesFunc = func(ctx context.Context, createdSince uint64, fn func(shortCodes []string) error) error {
+		if err := fn([]string{"rebuild1", "rebuild2"}); err != nil {
+			return err
+		}
+		// a code created during the rebuild, which the scan does not see, still lands in the new filter
+		if err := ts.impl.addBloomFilter(ctx, "created"); err != nil {
+			return err
+		}
+		return fn([]string{"rebuild3"})
+	}
+	// a deleted short code is dropped by the rebuild
+	ts.Require().NoError(ts.impl.addBloomFilter(ctx, "deleted"))
+
+	ts.Require().NoError(ts.impl.RebuildBloomFilter(ctx))
+
+	for _, shortCode := range []string{"rebuild1", "rebuild2", "rebuild3", "created"} {
+		isExist, err := ts.impl.isExist(ctx, shortCode)
+		ts.Require().NoError(err)
+		ts.Require().True(isExist)
+	}
+	isExist, err := ts.impl.isExist(ctx, "deleted")
+	ts.Require().NoError(err)
+	ts.Require().False(isExist)
+}
+
+func (ts *TestSuite) TestEnsureBloomFilter() {
+	ctx := context.Background()
+	ts.mockRepo.ScanShortCodesFunc = func(ctx context.Context, createdSince uint64, fn func(shortCodes []string) error) error {
+		return fn([]string{"ensure1"})
+	}
+
+	rebuilt, err := ts.impl.EnsureBloomFilter(ctx)
+	ts.Require().NoError(err)
+	ts.Require().True(rebuilt)
+	isExist, err := ts.impl.isExist(ctx, "ensure1")
+	ts.Require().NoError(err)
+	ts.Require().True(isExist)
+
+	// an existing filter is left alone
+	rebuilt, err = ts.impl.EnsureBloomFilter(ctx)
+	ts.Require().NoError(err)
+	ts.Require().False(rebuilt)
+}
+
+func (ts *TestSuite) TestVisitors() {
+	ctx := context.Background()
+	day := uint64(20000 * daySeconds)
+	err := ts.impl.AddVisitors(ctx, []*domain.Click{
+		{ShortCode: "short", Time: day + 10, IP: "203.0.113.0", UserAgent: "curl/8.0"},
+		{ShortCode: "short", Time: day + 20, IP: "203.0.113.0", UserAgent: "curl/8.0"},
+		{ShortCode: "short", Time: day + 30, IP: "198.51.100.0", UserAgent: "curl/8.0"},
+		{ShortCode: "short", Time: 2*day + 10, IP: "203.0.113.0", UserAgent: "curl/8.0"},
+		{ShortCode: "other", Time: day + 10, IP: "192.0.2.0"},
+		{ShortCode: "short", Time: day + 40, IP: "192.0.2.0", UserAgent: "Slackbot-LinkExpanding 1.0", Bot: true},
+	})
+	ts.Require().NoError(err)
+
+	total, perDay, err := ts.impl.CountVisitors(ctx, "short", []uint64{day, 2 * day, 3 * day})
+	ts.Require().NoError(err)
+	ts.Require().Equal(uint64(2), total)
+	ts.Require().Equal([]uint64{2, 1, 0}, perDay)
+
+	// the counters of the short url and of its days expire once it is no longer visited
+	for _, key := range []string{ts.impl.getVisitorKey("short"), ts.impl.getDayVisitorKey("short", day)} {
+		ttl, err := ts.redis.Do(ctx, ts.redis.B().Pttl().Key(key).Build()).AsInt64()
+		ts.Require().NoError(err)
+		ts.Require().Greater(ttl, int64(0))
+		ts.Require().LessOrEqual(ttl, visitorTTL.Milliseconds())
+	}
+
+	// deleting the short url drops its counter
+	ts.mockRepo.DeleteFunc = func(ctx context.Context, code string) error {
+		return nil
+	}
+	ts.Require().NoError(ts.impl.Delete(ctx, "short"))
+	total, _, err = ts.impl.CountVisitors(ctx, "short", nil)
+	ts.Require().NoError(err)
+	ts.Require().Equal(uint64(0), total)
+
+	total, _, err = ts.impl.CountVisitors(ctx, "none", nil)
+	ts.Require().NoError(err)
+	ts.Require().Equal(uint64(0), total)
+}
+
+func (ts *TestSuite) TestTopClicks() {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	ts.impl.now = func() time.Time { return now }
+	defer func() { ts.impl.now = time.Now }()
+
+	at := func(ago time.Duration) uint64 { return uint64(now.Add(-ago).Unix()) }
+	err := ts.impl.AddTopClicks(ctx, []*domain.Click{
+		{ShortCode: "a", Time: at(time.Minute)},
+		{ShortCode: "b", Time: at(time.Minute)},
+		{ShortCode: "b", Time: at(30 * time.Minute)},
+		{ShortCode: "c", Time: at(3 * time.Hour)},
+		{ShortCode: "c", Time: at(3 * time.Hour)},
+		{ShortCode: "c", Time: at(3 * time.Hour)},
+		{ShortCode: "d", Time: at(3 * 24 * time.Hour)},
+		{ShortCode: "d", Time: at(3 * 24 * time.Hour)},
+		{ShortCode: "d", Time: at(3 * 24 * time.Hour)},
+		{ShortCode: "d", Time: at(3 * 24 * time.Hour)},
+		// bots do not make links trend
+		{ShortCode: "e", Time: at(time.Minute), Bot: true},
+		{ShortCode: "e", Time: at(time.Minute), Bot: true},
+		{ShortCode: "e", Time: at(time.Minute), Bot: true},
+	})
+	ts.Require().NoError(err)
+
+	top, err := ts.impl.TopClicks(ctx, domain.TopWindowHour, 10)
+	ts.Require().NoError(err)
+	ts.Require().Equal([]domain.StatsCount{{Name: "b", Clicks: 2}, {Name: "a", Clicks: 1}}, top)
+
+	top, err = ts.impl.TopClicks(ctx, domain.TopWindowDay, 2)
+	ts.Require().NoError(err)
+	ts.Require().Equal([]domain.StatsCount{{Name: "c", Clicks: 3}, {Name: "b", Clicks: 2}}, top)
+
+	top, err = ts.impl.TopClicks(ctx, domain.TopWindowWeek, 1)
+	ts.Require().NoError(err)
+	ts.Require().Equal([]domain.StatsCount{{Name: "d", Clicks: 4}}, top)
+
+	_, err = ts.impl.TopClicks(ctx, "1y", 1)
+	ts.Require().ErrorIs(err, domain.ErrTopQueryInvalid)
+}
+
+func (ts *TestSuite) TestIdempotencyKey() {
+	ctx := context.Background()
+	short := &domain.ShortURL{ShortCode: "short", OriginalURL: "http://test.com", ShortURL: "http://host/short", ExpireTime: validExpireTime}
+
+	got, err := ts.impl.ReserveIdempotencyKey(ctx, "key", "hash", "first")
+	ts.Require().NoError(err)
+	ts.Nil(got)
+
+	// retries wait for the first request
+	_, err = ts.impl.ReserveIdempotencyKey(ctx, "key", "hash", "retry")
+	ts.ErrorIs(err, domain.ErrIdempotencyInProgress)
+	_, err = ts.impl.ReserveIdempotencyKey(ctx, "key", "other", "retry")
+	ts.ErrorIs(err, domain.ErrIdempotencyKeyReused)
+
+	ts.Require().NoError(ts.impl.SaveIdempotencyKey(ctx, "key", "hash", short))
+	got, err = ts.impl.ReserveIdempotencyKey(ctx, "key", "hash", "retry")
+	ts.Require().NoError(err)
+	ts.Equal(short, got)
+	_, err = ts.impl.ReserveIdempotencyKey(ctx, "key", "other", "retry")
+	ts.ErrorIs(err, domain.ErrIdempotencyKeyReused)
+
+	ttl, err := ts.redis.Do(ctx, ts.redis.B().Pttl().Key(ts.impl.getIdempotencyKey("key")).Build()).AsInt64()
+	ts.Require().NoError(err)
+	ts.InDelta(defaultIdempotencyTTL.Milliseconds(), ttl, float64(time.Minute.Milliseconds()))
+
+	// a saved key is never released
+	ts.Require().NoError(ts.impl.ReleaseIdempotencyKey(ctx, "key", "first"))
+	got, err = ts.impl.ReserveIdempotencyKey(ctx, "key", "hash", "retry")
+	ts.Require().NoError(err)
+	ts.Equal(short, got)
+
+	// a released key is free for the next request
+	_, err = ts.impl.ReserveIdempotencyKey(ctx, "failed", "hash", "first")
+	ts.Require().NoError(err)
+	ts.Require().NoError(ts.impl.ReleaseIdempotencyKey(ctx, "failed", "first"))
+	got, err = ts.impl.ReserveIdempotencyKey(ctx, "failed", "other", "second")
+	ts.Require().NoError(err)
+	ts.Nil(got)
+
+	// a request whose reservation expired cannot free the key of the request which reserved it since
+	ts.Require().NoError(ts.impl.ReleaseIdempotencyKey(ctx, "failed", "first"))
+	_, err = ts.impl.ReserveIdempotencyKey(ctx, "failed", "other", "third")
+	ts.ErrorIs(err, domain.ErrIdempotencyInProgress)
+}
+
+func (ts *TestSuite) TestIdempotencyKeys() {
+	ctx := context.Background()
+	short := &domain.ShortURL{ShortCode: "short", OriginalURL: "http://test.com", ShortURL: "http://host/short", ExpireTime: validExpireTime}
+	ts.Require().NoError(ts.impl.SaveIdempotencyKey(ctx, "batch-done", "hash", short))
+	_, err := ts.impl.ReserveIdempotencyKey(ctx, "batch-running", "hash", "other")
+	ts.Require().NoError(err)
+
+	// a key repeated in the batch waits for its first request
+	shorts, errs, err := ts.impl.ReserveIdempotencyKeys(ctx,
+		[]string{"batch-done", "batch-running", "batch-new", "batch-reused", "batch-new"},
+		[]string{"hash", "hash", "hash", "other", "hash"}, "batch")
+	ts.Require().NoError(err)
+	ts.Equal([]*domain.ShortURL{short, nil, nil, nil, nil}, shorts)
+	ts.Equal([]error{nil, domain.ErrIdempotencyInProgress, nil, nil, domain.ErrIdempotencyInProgress}, errs)
+
+	// the batch only releases the keys it reserved
+	ts.Require().NoError(ts.impl.SaveIdempotencyKeys(ctx, []string{"batch-new"}, []string{"hash"}, []*domain.ShortURL{short}))
+	ts.Require().NoError(ts.impl.ReleaseIdempotencyKeys(ctx, []string{"batch-reused", "batch-running"}, "batch"))
+	shorts, errs, err = ts.impl.ReserveIdempotencyKeys(ctx, []string{"batch-new", "batch-reused", "batch-running"}, []string{"hash", "hash", "hash"}, "retry")
+	ts.Require().NoError(err)
+	ts.Equal([]*domain.ShortURL{short, nil, nil}, shorts)
+	ts.Equal([]error{nil, nil, domain.ErrIdempotencyInProgress}, errs)
+}
+
+func (ts *TestSuite) TestPublishSubscribeClicks() {
+	ctx, cancel := context.WithCancel(context.Background())
+	clicks := ts.impl.SubscribeClicks(ctx, "short")
+
+	click := &domain.Click{ShortCode: "short", Time: 100, Referrer: "https://example.com"}
+	// the subscription is set up in the background, publish until it is listening
+	var got *domain.Click
+	ts.Require().Eventually(func() bool {
+		if err := ts.impl.PublishClicks(context.Background(), []*domain.Click{{ShortCode: "other"}, click}); err != nil {
+			return false
+		}
+		select {
+		case got = <-clicks:
+			return true
+		case <-time.After(10 * time.Millisecond):
+			return false
+		}
+	}, 5*time.Second, time.Millisecond)
+	ts.Require().Equal(click, got)
+
+	cancel()
+	ts.Require().Eventually(func() bool {
+		_, ok := <-clicks
+		return !ok
+	}, 5*time.Second, time.Millisecond)
+}
+
+func TestCacheTTL(t *testing.T) {
+	now := time.Unix(1000, 0)
+	tests := []struct {
+		name       string
+		cfg        Config
+		expireTime uint64
+		wantMin    time.Duration
+		wantMax    time.Duration
+	}{
+		{
+			name:       "expires before max ttl",
+			cfg:        Config{MaxTTL: time.Hour},
+			expireTime: 1060,
+			wantMin:    time.Minute,
+			wantMax:    time.Minute,
+		},
+		{
+			name:       "capped by max ttl",
+			cfg:        Config{MaxTTL: time.Hour},
+			expireTime: 1000 + 86400,
+			wantMin:    time.Hour,
+			wantMax:    time.Hour,
+		},
+		{
+			name:       "capped by max ttl plus jitter",
+			cfg:        Config{MaxTTL: time.Hour, TTLJitter: time.Minute},
+			expireTime: 1000 + 86400,
+			wantMin:    time.Hour,
+			wantMax:    time.Hour + time.Minute,
+		},
+		{
+			name:       "already expired",
+			cfg:        Config{MaxTTL: time.Hour, NegativeTTL: time.Minute},
+			expireTime: 900,
+			wantMin:    time.Minute,
+			wantMax:    time.Minute,
+		},
+		{
+			name:       "expires now",
+			cfg:        Config{MaxTTL: time.Hour, NegativeTTL: time.Minute},
+			expireTime: 1000,
+			wantMin:    time.Minute,
+			wantMax:    time.Minute,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			im := &impl{cfg: tt.cfg, now: func() time.Time { return now }}
+			got := im.cacheTTL(&domain.ShortURL{ExpireTime: tt.expireTime})
+			if got < tt.wantMin || got > tt.wantMax {
+				t.Errorf("cacheTTL() = %v, want between %v and %v", got, tt.wantMin, tt.wantMax)
+			}
+		})
+	}
 }
 
 func TestCacheSuite(t *testing.T) {
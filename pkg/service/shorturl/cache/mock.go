@@ -7,14 +7,130 @@ import (
 )
 
 type MockShortURLCacheRepository struct {
-	CreateFunc func(ctx context.Context, short *domain.ShortURL) (*domain.ShortURL, error)
-	GetFunc    func(ctx context.Context, shortCode string) (*domain.ShortURL, error)
+	CreateFunc                func(ctx context.Context, short *domain.ShortURL) (*domain.ShortURL, error)
+	CreateBatchFunc           func(ctx context.Context, shorts []*domain.ShortURL) ([]error, error)
+	GetFunc                   func(ctx context.Context, shortCode string) (*domain.ShortURL, error)
+	GetManyFunc               func(ctx context.Context, shortCodes []string) ([]*domain.ShortURL, error)
+	FindDuplicateFunc         func(ctx context.Context, short *domain.ShortURL) (*domain.ShortURL, error)
+	CreateOrFindDuplicateFunc func(ctx context.Context, short *domain.ShortURL) (*domain.ShortURL, error)
+	UpdateFunc                func(ctx context.Context, shortCode string, apply func(short *domain.ShortURL) error) (*domain.ShortURL, error)
+	DeleteFunc                func(ctx context.Context, shortCode string) error
+	DisableFunc               func(ctx context.Context, shortCode string) error
+
+	ScanShortCodesFunc func(ctx context.Context, createdSince uint64, fn func(shortCodes []string) error) error
+
+	RebuildBloomFilterFunc func(ctx context.Context) error
+	EnsureBloomFilterFunc  func(ctx context.Context) (bool, error)
+
+	AddVisitorsFunc   func(ctx context.Context, clicks []*domain.Click) error
+	CountVisitorsFunc func(ctx context.Context, shortCode string, days []uint64) (uint64, []uint64, error)
+	AddTopClicksFunc  func(ctx context.Context, clicks []*domain.Click) error
+	TopClicksFunc     func(ctx context.Context, window string, limit int) ([]domain.StatsCount, error)
+
+	PublishClicksFunc   func(ctx context.Context, clicks []*domain.Click) error
+	SubscribeClicksFunc func(ctx context.Context, shortCode string) <-chan *domain.Click
+
+	ReserveIdempotencyKeyFunc func(ctx context.Context, key, hash, token string) (*domain.ShortURL, error)
+	SaveIdempotencyKeyFunc    func(ctx context.Context, key, hash string, short *domain.ShortURL) error
+	ReleaseIdempotencyKeyFunc func(ctx context.Context, key, token string) error
+
+	ReserveIdempotencyKeysFunc func(ctx context.Context, keys, hashes []string, token string) ([]*domain.ShortURL, []error, error)
+	SaveIdempotencyKeysFunc    func(ctx context.Context, keys, hashes []string, shorts []*domain.ShortURL) error
+	ReleaseIdempotencyKeysFunc func(ctx context.Context, keys []string, token string) error
 }
 
 func (m *MockShortURLCacheRepository) Create(ctx context.Context, short *domain.ShortURL) (*domain.ShortURL, error) {
 	return m.CreateFunc(ctx, short)
 }
 
+func (m *MockShortURLCacheRepository) CreateBatch(ctx context.Context, shorts []*domain.ShortURL) ([]error, error) {
+	return m.CreateBatchFunc(ctx, shorts)
+}
+
 func (m *MockShortURLCacheRepository) Get(ctx context.Context, shortCode string) (*domain.ShortURL, error) {
 	return m.GetFunc(ctx, shortCode)
 }
+
+func (m *MockShortURLCacheRepository) GetMany(ctx context.Context, shortCodes []string) ([]*domain.ShortURL, error) {
+	return m.GetManyFunc(ctx, shortCodes)
+}
+
+func (m *MockShortURLCacheRepository) FindDuplicate(ctx context.Context, short *domain.ShortURL) (*domain.ShortURL, error) {
+	return m.FindDuplicateFunc(ctx, short)
+}
+
+func (m *MockShortURLCacheRepository) CreateOrFindDuplicate(ctx context.Context, short *domain.ShortURL) (*domain.ShortURL, error) {
+	return m.CreateOrFindDuplicateFunc(ctx, short)
+}
+
+func (m *MockShortURLCacheRepository) Update(ctx context.Context, shortCode string, apply func(short *domain.ShortURL) error) (*domain.ShortURL, error) {
+	return m.UpdateFunc(ctx, shortCode, apply)
+}
+
+func (m *MockShortURLCacheRepository) Delete(ctx context.Context, shortCode string) error {
+	return m.DeleteFunc(ctx, shortCode)
+}
+
+func (m *MockShortURLCacheRepository) Disable(ctx context.Context, shortCode string) error {
+	return m.DisableFunc(ctx, shortCode)
+}
+
+func (m *MockShortURLCacheRepository) ScanShortCodes(ctx context.Context, createdSince uint64, fn func(shortCodes []string) error) error {
+	return m.ScanShortCodesFunc(ctx, createdSince, fn)
+}
+
+func (m *MockShortURLCacheRepository) RebuildBloomFilter(ctx context.Context) error {
+	return m.RebuildBloomFilterFunc(ctx)
+}
+
+func (m *MockShortURLCacheRepository) EnsureBloomFilter(ctx context.Context) (bool, error) {
+	return m.EnsureBloomFilterFunc(ctx)
+}
+
+func (m *MockShortURLCacheRepository) AddVisitors(ctx context.Context, clicks []*domain.Click) error {
+	return m.AddVisitorsFunc(ctx, clicks)
+}
+
+func (m *MockShortURLCacheRepository) CountVisitors(ctx context.Context, shortCode string, days []uint64) (uint64, []uint64, error) {
+	return m.CountVisitorsFunc(ctx, shortCode, days)
+}
+
+func (m *MockShortURLCacheRepository) AddTopClicks(ctx context.Context, clicks []*domain.Click) error {
+	return m.AddTopClicksFunc(ctx, clicks)
+}
+
+func (m *MockShortURLCacheRepository) TopClicks(ctx context.Context, window string, limit int) ([]domain.StatsCount, error) {
+	return m.TopClicksFunc(ctx, window, limit)
+}
+
+func (m *MockShortURLCacheRepository) PublishClicks(ctx context.Context, clicks []*domain.Click) error {
+	return m.PublishClicksFunc(ctx, clicks)
+}
+
+func (m *MockShortURLCacheRepository) SubscribeClicks(ctx context.Context, shortCode string) <-chan *domain.Click {
+	return m.SubscribeClicksFunc(ctx, shortCode)
+}
+
+func (m *MockShortURLCacheRepository) ReserveIdempotencyKey(ctx context.Context, key, hash, token string) (*domain.ShortURL, error) {
+	return m.ReserveIdempotencyKeyFunc(ctx, key, hash, token)
+}
+
+func (m *MockShortURLCacheRepository) SaveIdempotencyKey(ctx context.Context, key, hash string, short *domain.ShortURL) error {
+	return m.SaveIdempotencyKeyFunc(ctx, key, hash, short)
+}
+
+func (m *MockShortURLCacheRepository) ReleaseIdempotencyKey(ctx context.Context, key, token string) error {
+	return m.ReleaseIdempotencyKeyFunc(ctx, key, token)
+}
+
+func (m *MockShortURLCacheRepository) ReserveIdempotencyKeys(ctx context.Context, keys, hashes []string, token string) ([]*domain.ShortURL, []error, error) {
+	return m.ReserveIdempotencyKeysFunc(ctx, keys, hashes, token)
+}
+
+func (m *MockShortURLCacheRepository) SaveIdempotencyKeys(ctx context.Context, keys, hashes []string, shorts []*domain.ShortURL) error {
+	return m.SaveIdempotencyKeysFunc(ctx, keys, hashes, shorts)
+}
+
+func (m *MockShortURLCacheRepository) ReleaseIdempotencyKeys(ctx context.Context, keys []string, token string) error {
+	return m.ReleaseIdempotencyKeysFunc(ctx, keys, token)
+}
@@ -1,7 +1,43 @@
 package cache
 
-import "github.com/sappy5678/dcard/pkg/service/shorturl/repository"
+import (
+	"context"
+
+	"github.com/sappy5678/dcard/pkg/domain"
+	"github.com/sappy5678/dcard/pkg/service/shorturl/repository"
+)
 
 type Repository interface {
 	repository.Repository
+	// RebuildBloomFilter streams every short code into a fresh bloom filter and swaps it in atomically
+	RebuildBloomFilter(ctx context.Context) error
+	// EnsureBloomFilter rebuilds the bloom filter if it is missing, and reports whether it did
+	EnsureBloomFilter(ctx context.Context) (bool, error)
+	// AddVisitors counts the visitors of the clicks in HyperLogLogs per short url and per UTC day
+	AddVisitors(ctx context.Context, clicks []*domain.Click) error
+	// CountVisitors estimates the distinct visitors of a short url overall and on each day, days are the unix times of UTC midnights
+	CountVisitors(ctx context.Context, shortCode string, days []uint64) (uint64, []uint64, error)
+	// AddTopClicks counts the clicks in the sorted sets of every top window
+	AddTopClicks(ctx context.Context, clicks []*domain.Click) error
+	// TopClicks returns the most clicked short codes of a window, most clicked first
+	TopClicks(ctx context.Context, window string, limit int) ([]domain.StatsCount, error)
+	// PublishClicks sends the clicks to the subscribers of their short url on every pod
+	PublishClicks(ctx context.Context, clicks []*domain.Click) error
+	// SubscribeClicks streams the published clicks of a short url until ctx is done, the channel is closed then
+	SubscribeClicks(ctx context.Context, shortCode string) <-chan *domain.Click
+	// ReserveIdempotencyKey claims key for a create request with hash and returns nil, or the short url of an earlier
+	// request with the key. ErrIdempotencyKeyReused when that request differed, ErrIdempotencyInProgress while it runs.
+	// The token is unique to the request, only it can release the key.
+	ReserveIdempotencyKey(ctx context.Context, key, hash, token string) (*domain.ShortURL, error)
+	// SaveIdempotencyKey stores the short url created under a reserved key for the idempotency window
+	SaveIdempotencyKey(ctx context.Context, key, hash string, short *domain.ShortURL) error
+	// ReleaseIdempotencyKey frees a key reserved with token whose request failed, so a retry runs it again.
+	// A key which expired and was reserved by another request since is left alone.
+	ReleaseIdempotencyKey(ctx context.Context, key, token string) error
+	// ReserveIdempotencyKeys is ReserveIdempotencyKey for the keys of a batch, with a short url and an error for each of them
+	ReserveIdempotencyKeys(ctx context.Context, keys, hashes []string, token string) ([]*domain.ShortURL, []error, error)
+	// SaveIdempotencyKeys is SaveIdempotencyKey for the keys of a batch
+	SaveIdempotencyKeys(ctx context.Context, keys, hashes []string, shorts []*domain.ShortURL) error
+	// ReleaseIdempotencyKeys is ReleaseIdempotencyKey for the keys of a batch
+	ReleaseIdempotencyKeys(ctx context.Context, keys []string, token string) error
 }
@@ -0,0 +1,127 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/rueidis"
+
+	"github.com/sappy5678/dcard/pkg/domain"
+)
+
+// topKey hash tags every leaderboard key into one slot, so their union works on a cluster
+const (
+	topKey       = "{top:shorturl}:"
+	topResultTTL = 30 * time.Second
+)
+
+// topWindow counts the clicks of a window in buckets, the window slides a bucket at a time
+type topWindow struct {
+	bucket  time.Duration
+	buckets int
+}
+
+var topWindows = map[string]topWindow{
+	domain.TopWindowHour: {bucket: 5 * time.Minute, buckets: 12},
+	domain.TopWindowDay:  {bucket: time.Hour, buckets: 24},
+	domain.TopWindowWeek: {bucket: 24 * time.Hour, buckets: 7},
+}
+
+// getTopBucketKey returns the key counting the clicks of the bucket starting at start
+func (im *impl) getTopBucketKey(window string, start int64) string {
+	return im.cfg.CacheKeyPrefix + topKey + window + ":" + strconv.FormatInt(start, 10)
+}
+
+// getTopResultKey returns the key holding the union of the window ending in the bucket starting at start
+func (im *impl) getTopResultKey(window string, start int64) string {
+	return im.cfg.CacheKeyPrefix + topKey + window + ":result:" + strconv.FormatInt(start, 10)
+}
+
+func bucketStart(unix int64, bucket time.Duration) int64 {
+	size := int64(bucket / time.Second)
+	return unix - unix%size
+}
+
+func (im *impl) AddTopClicks(ctx context.Context, clicks []*domain.Click) error {
+	if len(clicks) == 0 {
+		return nil
+	}
+
+	// one ZINCRBY per key and short code, a batch often holds many clicks of the same short url
+	counts := map[string]map[string]int64{}
+	keys := []string{}
+	expires := map[string]time.Duration{}
+	for _, click := range clicks {
+		// link unfurlers and crawlers would make shared links trend
+		if click.Bot {
+			continue
+		}
+		for name, window := range topWindows {
+			key := im.getTopBucketKey(name, bucketStart(int64(click.Time), window.bucket))
+			if _, ok := counts[key]; !ok {
+				counts[key] = map[string]int64{}
+				keys = append(keys, key)
+				expires[key] = window.bucket * time.Duration(window.buckets+1)
+			}
+			counts[key][click.ShortCode]++
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil
+	}
+	cmds := make(rueidis.Commands, 0, 2*len(keys))
+	for _, key := range keys {
+		for shortCode, count := range counts[key] {
+			cmds = append(cmds, im.redis.B().Zincrby().Key(key).Increment(float64(count)).Member(shortCode).Build())
+		}
+		cmds = append(cmds, im.redis.B().Pexpire().Key(key).Milliseconds(expires[key].Milliseconds()).Build())
+	}
+	for _, resp := range im.redis.DoMulti(ctx, cmds...) {
+		if err := resp.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (im *impl) TopClicks(ctx context.Context, window string, limit int) ([]domain.StatsCount, error) {
+	w, ok := topWindows[window]
+	if !ok || limit <= 0 {
+		return nil, domain.ErrTopQueryInvalid
+	}
+
+	current := bucketStart(im.now().Unix(), w.bucket)
+	resultKey := im.getTopResultKey(window, current)
+	exists, err := im.redis.Do(ctx, im.redis.B().Exists().Key(resultKey).Build()).AsBool()
+	if err != nil {
+		return nil, err
+	}
+	// the union is shared for a while, so busy dashboards do not merge every bucket on every call
+	if !exists {
+		keys := make([]string, w.buckets)
+		for i := range keys {
+			keys[i] = im.getTopBucketKey(window, current-int64(i)*int64(w.bucket/time.Second))
+		}
+		cmds := rueidis.Commands{
+			im.redis.B().Zunionstore().Destination(resultKey).Numkeys(int64(len(keys))).Key(keys...).Build(),
+			im.redis.B().Pexpire().Key(resultKey).Milliseconds(topResultTTL.Milliseconds()).Build(),
+		}
+		for _, resp := range im.redis.DoMulti(ctx, cmds...) {
+			if err := resp.Error(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	scores, err := im.redis.Do(ctx, im.redis.B().Zrange().Key(resultKey).Min("0").Max(strconv.Itoa(limit-1)).Rev().Withscores().Build()).AsZScores()
+	if err != nil {
+		return nil, err
+	}
+	top := make([]domain.StatsCount, len(scores))
+	for i, score := range scores {
+		top[i] = domain.StatsCount{Name: score.Member, Clicks: uint64(score.Score)}
+	}
+	return top, nil
+}
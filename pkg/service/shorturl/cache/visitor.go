@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/rueidis"
+
+	"github.com/sappy5678/dcard/pkg/domain"
+	"github.com/sappy5678/dcard/pkg/service/shorturl/click"
+)
+
+// the counters live in the bloom store, an evicted one would silently undercount.
+// Every counter is kept for visitorTTL after its last click, the one of a short url is refreshed as long as it is visited,
+// so the counter of a short url which expired ages out like the ones of its days.
+const (
+	visitorKey = "hll:shorturl:"
+	visitorTTL = 90 * 24 * time.Hour
+	daySeconds = 24 * 60 * 60
+)
+
+func (im *impl) getVisitorKey(shortCode string) string {
+	return im.cfg.BloomKeyPrefix + visitorKey + shortCode
+}
+
+// getDayVisitorKey returns the key counting the visitors of the UTC day starting at day
+func (im *impl) getDayVisitorKey(shortCode string, day uint64) string {
+	return im.getVisitorKey(shortCode) + ":" + strconv.FormatUint(day, 10)
+}
+
+func (im *impl) AddVisitors(ctx context.Context, clicks []*domain.Click) error {
+	if len(clicks) == 0 {
+		return nil
+	}
+
+	// one PFADD per key, a batch often holds many clicks of the same short url
+	visitors := map[string][]string{}
+	keys := []string{}
+	add := func(key string, visitor string) {
+		if _, ok := visitors[key]; !ok {
+			keys = append(keys, key)
+		}
+		visitors[key] = append(visitors[key], visitor)
+	}
+	for _, c := range clicks {
+		// bots are no visitors
+		if c.Bot {
+			continue
+		}
+		visitor := click.VisitorID(c)
+		add(im.getVisitorKey(c.ShortCode), visitor)
+		add(im.getDayVisitorKey(c.ShortCode, c.Time-c.Time%daySeconds), visitor)
+	}
+
+	if len(keys) == 0 {
+		return nil
+	}
+	cmds := make(rueidis.Commands, 0, 2*len(keys))
+	for _, key := range keys {
+		cmds = append(cmds,
+			im.bloom.B().Pfadd().Key(key).Element(visitors[key]...).Build(),
+			im.bloom.B().Pexpire().Key(key).Milliseconds(visitorTTL.Milliseconds()).Build(),
+		)
+	}
+	for _, resp := range im.bloom.DoMulti(ctx, cmds...) {
+		if err := resp.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (im *impl) CountVisitors(ctx context.Context, shortCode string, days []uint64) (uint64, []uint64, error) {
+	cmds := make(rueidis.Commands, 0, len(days)+1)
+	cmds = append(cmds, im.bloom.B().Pfcount().Key(im.getVisitorKey(shortCode)).Build())
+	for _, day := range days {
+		cmds = append(cmds, im.bloom.B().Pfcount().Key(im.getDayVisitorKey(shortCode, day)).Build())
+	}
+
+	counts := make([]uint64, len(cmds))
+	for i, resp := range im.bloom.DoMulti(ctx, cmds...) {
+		count, err := resp.AsInt64()
+		if err != nil {
+			return 0, nil, err
+		}
+		counts[i] = uint64(count)
+	}
+	return counts[0], counts[1:], nil
+}
@@ -0,0 +1,17 @@
+package click
+
+import (
+	"net"
+)
+
+// AnonymizeIP masks the host part of an ip, keeping the /24 of IPv4 and the /48 of IPv6, unparsable input is dropped
+func AnonymizeIP(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return parsed.Mask(net.CIDRMask(48, 128)).String()
+}
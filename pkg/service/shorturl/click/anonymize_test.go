@@ -0,0 +1,27 @@
+package click
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnonymizeIP(t *testing.T) {
+	tests := []struct {
+		name string
+		ip   string
+		want string
+	}{
+		{name: "ipv4", ip: "203.0.113.7", want: "203.0.113.0"},
+		{name: "ipv4 mapped ipv6", ip: "::ffff:203.0.113.7", want: "203.0.113.0"},
+		{name: "ipv6", ip: "2001:db8:85a3:8d3:1319:8a2e:370:7348", want: "2001:db8:85a3::"},
+		{name: "empty", ip: "", want: ""},
+		{name: "invalid", ip: "not-an-ip", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, AnonymizeIP(tt.ip))
+		})
+	}
+}
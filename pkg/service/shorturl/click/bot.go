@@ -0,0 +1,136 @@
+package click
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/sappy5678/dcard/pkg/domain"
+)
+
+// DefaultBotPatterns match the user agents of common crawlers, link unfurlers and http libraries
+var DefaultBotPatterns = []string{
+	`bot\b`, `bot/`, `crawl`, `spider`, `slurp`,
+	`facebookexternalhit`, `facebookcatalog`,
+	`slack-imgproxy`, `skypeuripreview`, `whatsapp`, `iframely`, `embedly`,
+	`headlesschrome`, `lighthouse`,
+	`curl/`, `wget/`, `python-requests`, `go-http-client`, `okhttp`, `java/`,
+}
+
+// BotClassifier tags clicks as bots by their user agent and request headers, the patterns can be swapped while it is in use
+type BotClassifier struct {
+	patterns atomic.Pointer[regexp.Regexp]
+}
+
+// NewBotClassifier returns a BotClassifier matching the user agent against patterns, case insensitively
+func NewBotClassifier(patterns []string) (*BotClassifier, error) {
+	c := &BotClassifier{}
+	if err := c.SetPatterns(patterns); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// SetPatterns replaces the user agent patterns
+func (c *BotClassifier) SetPatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("bot pattern %q: %w", pattern, err)
+		}
+	}
+	// an empty alternation would match every user agent
+	expr := `$^`
+	if len(patterns) > 0 {
+		expr = `(?i)(?:` + strings.Join(patterns, `)|(?:`) + `)`
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return err
+	}
+	c.patterns.Store(re)
+	return nil
+}
+
+// IsBot reports whether the click was made by a bot. Besides the patterns, clicks without a user agent,
+// prefetches and requests without an Accept-Language header, which every browser sends, count as bots.
+func (c *BotClassifier) IsBot(click *domain.Click) bool {
+	if click.UserAgent == "" || click.AcceptLanguage == "" {
+		return true
+	}
+	if strings.Contains(strings.ToLower(click.Purpose), "prefetch") {
+		return true
+	}
+	return c.patterns.Load().MatchString(click.UserAgent)
+}
+
+// LoadBotPatterns reads a pattern file, one regular expression per line, blank lines and lines starting with # are skipped
+func LoadBotPatterns(path string) ([]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	patterns := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns, scanner.Err()
+}
+
+// WatchPatterns loads the patterns of a file and reloads them whenever the file changes, until ctx is done.
+// A file that fails to load later keeps the patterns in use, onError is told about it.
+func (c *BotClassifier) WatchPatterns(ctx context.Context, path string, interval time.Duration, onError func(error)) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	patterns, err := LoadBotPatterns(path)
+	if err != nil {
+		return err
+	}
+	if err := c.SetPatterns(patterns); err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		modTime, size := info.ModTime(), info.Size()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				if onError != nil {
+					onError(err)
+				}
+				continue
+			}
+			if info.ModTime().Equal(modTime) && info.Size() == size {
+				continue
+			}
+			modTime, size = info.ModTime(), info.Size()
+			patterns, err := LoadBotPatterns(path)
+			if err == nil {
+				err = c.SetPatterns(patterns)
+			}
+			if err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,93 @@
+package click
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sappy5678/dcard/pkg/domain"
+)
+
+const chromeAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+
+func TestBotClassifier_IsBot(t *testing.T) {
+	bots, err := NewBotClassifier(DefaultBotPatterns)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name  string
+		click *domain.Click
+		want  bool
+	}{
+		{name: "browser", click: &domain.Click{UserAgent: chromeAgent, AcceptLanguage: "en-US"}},
+		{name: "slack unfurler", click: &domain.Click{UserAgent: "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)", AcceptLanguage: "en"}, want: true},
+		{name: "facebook unfurler", click: &domain.Click{UserAgent: "facebookexternalhit/1.1", AcceptLanguage: "en"}, want: true},
+		{name: "crawler", click: &domain.Click{UserAgent: "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", AcceptLanguage: "en"}, want: true},
+		{name: "script", click: &domain.Click{UserAgent: "python-requests/2.31.0", AcceptLanguage: "en"}, want: true},
+		{name: "no user agent", click: &domain.Click{AcceptLanguage: "en"}, want: true},
+		{name: "no accept language", click: &domain.Click{UserAgent: chromeAgent}, want: true},
+		{name: "prefetch", click: &domain.Click{UserAgent: chromeAgent, AcceptLanguage: "en", Purpose: "prefetch;prerender"}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, bots.IsBot(tt.click))
+		})
+	}
+}
+
+func TestBotClassifier_SetPatterns(t *testing.T) {
+	bots, err := NewBotClassifier(nil)
+	require.NoError(t, err)
+	click := &domain.Click{UserAgent: "MyMonitor/1.0", AcceptLanguage: "en"}
+	// no patterns match no user agent
+	assert.False(t, bots.IsBot(click))
+
+	require.NoError(t, bots.SetPatterns([]string{"mymonitor"}))
+	assert.True(t, bots.IsBot(click))
+
+	// invalid patterns keep the ones in use
+	assert.Error(t, bots.SetPatterns([]string{"("}))
+	assert.True(t, bots.IsBot(click))
+}
+
+func TestBotClassifier_WatchPatterns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bots.txt")
+	require.NoError(t, os.WriteFile(path, []byte("# monitors\nmymonitor\n\n"), 0o644))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bots, err := NewBotClassifier(nil)
+	require.NoError(t, err)
+	errs := make(chan error, 10)
+	require.NoError(t, bots.WatchPatterns(ctx, path, time.Millisecond, func(err error) { errs <- err }))
+
+	monitor := &domain.Click{UserAgent: "MyMonitor/1.0", AcceptLanguage: "en"}
+	checker := &domain.Click{UserAgent: "UptimeChecker/2.0", AcceptLanguage: "en"}
+	assert.True(t, bots.IsBot(monitor))
+	assert.False(t, bots.IsBot(checker))
+
+	require.NoError(t, os.WriteFile(path, []byte("uptimechecker\n"), 0o644))
+	assert.Eventually(t, func() bool { return bots.IsBot(checker) && !bots.IsBot(monitor) }, time.Second, time.Millisecond)
+
+	// a broken file is reported and the patterns in use are kept
+	require.NoError(t, os.WriteFile(path, []byte("(\n"), 0o644))
+	select {
+	case err := <-errs:
+		assert.Error(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("broken pattern file not reported")
+	}
+	assert.True(t, bots.IsBot(checker))
+}
+
+func TestBotClassifier_WatchPatterns_Missing(t *testing.T) {
+	bots, err := NewBotClassifier(nil)
+	require.NoError(t, err)
+	assert.Error(t, bots.WatchPatterns(context.Background(), filepath.Join(t.TempDir(), "missing.txt"), time.Second, nil))
+}
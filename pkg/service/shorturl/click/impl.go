@@ -0,0 +1,151 @@
+package click
+
+import (
+	"context"
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/sappy5678/dcard/pkg/domain"
+)
+
+const (
+	defaultBufferSize    = 10000
+	defaultBatchSize     = 500
+	defaultFlushInterval = time.Second
+	saveTimeout          = 5 * time.Second
+)
+
+var stats = expvar.NewMap("shorturl_click")
+
+// Config holds the buffering of clicks, zero values fall back to defaults
+type Config struct {
+	BufferSize    int
+	BatchSize     int
+	FlushInterval time.Duration
+	// Bots tags the clicks of bots before they are saved, nil leaves every click untagged
+	Bots *BotClassifier
+}
+
+type recorder struct {
+	store  Store
+	cfg    Config
+	clicks chan *domain.Click
+	quit   chan struct{}
+	done   chan struct{}
+	once   sync.Once
+}
+
+// New returns a Repository that saves clicks to the store in batches, flushing a batch once it is full or FlushInterval passed
+func New(store Store, cfg *Config) Repository {
+	c := Config{}
+	if cfg != nil {
+		c = *cfg
+	}
+	if c.BufferSize <= 0 {
+		c.BufferSize = defaultBufferSize
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = defaultBatchSize
+	}
+	if c.FlushInterval <= 0 {
+		c.FlushInterval = defaultFlushInterval
+	}
+
+	r := &recorder{
+		store:  store,
+		cfg:    c,
+		clicks: make(chan *domain.Click, c.BufferSize),
+		quit:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+func (r *recorder) Record(click *domain.Click) {
+	select {
+	case <-r.quit:
+		stats.Add("dropped", 1)
+		return
+	default:
+	}
+
+	select {
+	case r.clicks <- click:
+		stats.Add("recorded", 1)
+	default:
+		stats.Add("dropped", 1)
+	}
+}
+
+func (r *recorder) Close(ctx context.Context) error {
+	r.once.Do(func() { close(r.quit) })
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *recorder) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*domain.Click, 0, r.cfg.BatchSize)
+	for {
+		select {
+		case click := <-r.clicks:
+			batch = r.add(batch, click)
+		case <-ticker.C:
+			batch = r.flush(batch)
+		case <-r.quit:
+			r.drain(batch)
+			return
+		}
+	}
+}
+
+// drain flushes the clicks still buffered on close
+func (r *recorder) drain(batch []*domain.Click) {
+	for {
+		select {
+		case click := <-r.clicks:
+			batch = r.add(batch, click)
+		default:
+			r.flush(batch)
+			return
+		}
+	}
+}
+
+// add classifies the click and appends it to the batch, a full batch is flushed
+func (r *recorder) add(batch []*domain.Click, click *domain.Click) []*domain.Click {
+	if r.cfg.Bots != nil {
+		click.Bot = r.cfg.Bots.IsBot(click)
+	}
+	batch = append(batch, click)
+	if len(batch) >= r.cfg.BatchSize {
+		batch = r.flush(batch)
+	}
+	return batch
+}
+
+// flush saves the batch and returns it emptied, a failed batch is dropped so a broken store cannot stall redirects
+func (r *recorder) flush(batch []*domain.Click) []*domain.Click {
+	if len(batch) == 0 {
+		return batch
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), saveTimeout)
+	defer cancel()
+	if err := r.store.Save(ctx, batch); err != nil {
+		stats.Add("flush_failed", int64(len(batch)))
+	} else {
+		stats.Add("flushed", int64(len(batch)))
+	}
+	return make([]*domain.Click, 0, r.cfg.BatchSize)
+}
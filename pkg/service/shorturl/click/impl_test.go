@@ -0,0 +1,161 @@
+package click
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sappy5678/dcard/pkg/domain"
+)
+
+// newMemoryStore returns a Store that keeps every saved batch
+func newMemoryStore() (*MockClickStore, func() [][]*domain.Click) {
+	var mu sync.Mutex
+	var batches [][]*domain.Click
+	store := &MockClickStore{
+		SaveFunc: func(ctx context.Context, clicks []*domain.Click) error {
+			mu.Lock()
+			defer mu.Unlock()
+			batches = append(batches, clicks)
+			return nil
+		},
+	}
+	return store, func() [][]*domain.Click {
+		mu.Lock()
+		defer mu.Unlock()
+		return batches
+	}
+}
+
+func TestRecord_FlushFullBatch(t *testing.T) {
+	store, batches := newMemoryStore()
+	r := New(store, &Config{BatchSize: 2, FlushInterval: time.Hour})
+
+	r.Record(&domain.Click{ShortCode: "a"})
+	r.Record(&domain.Click{ShortCode: "b"})
+	r.Record(&domain.Click{ShortCode: "c"})
+
+	assert.Eventually(t, func() bool { return len(batches()) == 1 }, time.Second, time.Millisecond)
+	assert.Len(t, batches()[0], 2)
+
+	// the partial batch is written on close
+	require.NoError(t, r.Close(context.Background()))
+	require.Len(t, batches(), 2)
+	assert.Equal(t, "c", batches()[1][0].ShortCode)
+}
+
+func TestRecord_FlushInterval(t *testing.T) {
+	store, batches := newMemoryStore()
+	r := New(store, &Config{BatchSize: 100, FlushInterval: 10 * time.Millisecond})
+	defer r.Close(context.Background())
+
+	r.Record(&domain.Click{ShortCode: "a"})
+
+	assert.Eventually(t, func() bool { return len(batches()) == 1 }, time.Second, time.Millisecond)
+}
+
+func TestRecord_TagBots(t *testing.T) {
+	store, batches := newMemoryStore()
+	bots, err := NewBotClassifier(DefaultBotPatterns)
+	require.NoError(t, err)
+	r := New(store, &Config{BatchSize: 2, FlushInterval: time.Hour, Bots: bots})
+
+	r.Record(&domain.Click{ShortCode: "a", UserAgent: "Slackbot-LinkExpanding 1.0", AcceptLanguage: "en"})
+	r.Record(&domain.Click{ShortCode: "a", UserAgent: "Mozilla/5.0 Firefox/121.0", AcceptLanguage: "en"})
+	require.NoError(t, r.Close(context.Background()))
+
+	require.Len(t, batches(), 1)
+	assert.True(t, batches()[0][0].Bot)
+	assert.False(t, batches()[0][1].Bot)
+}
+
+func TestRecord_DropWhenFull(t *testing.T) {
+	block := make(chan struct{})
+	store := &MockClickStore{
+		SaveFunc: func(ctx context.Context, clicks []*domain.Click) error {
+			<-block
+			return nil
+		},
+	}
+	r := New(store, &Config{BufferSize: 1, BatchSize: 1, FlushInterval: time.Hour})
+
+	dropped := statValue("dropped")
+	// the first click blocks the writer, the second fills the buffer
+	r.Record(&domain.Click{ShortCode: "a"})
+	assert.Eventually(t, func() bool { return len(r.(*recorder).clicks) == 0 }, time.Second, time.Millisecond)
+	r.Record(&domain.Click{ShortCode: "b"})
+
+	done := make(chan struct{})
+	go func() {
+		r.Record(&domain.Click{ShortCode: "c"})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("record blocked on a full buffer")
+	}
+	assert.Equal(t, dropped+1, statValue("dropped"))
+
+	close(block)
+	require.NoError(t, r.Close(context.Background()))
+}
+
+func TestRecord_StoreFailure(t *testing.T) {
+	store := &MockClickStore{
+		SaveFunc: func(ctx context.Context, clicks []*domain.Click) error {
+			return errors.New("store down")
+		},
+	}
+	r := New(store, &Config{BatchSize: 1, FlushInterval: time.Hour})
+
+	failed := statValue("flush_failed")
+	r.Record(&domain.Click{ShortCode: "a"})
+	require.NoError(t, r.Close(context.Background()))
+	assert.Equal(t, failed+1, statValue("flush_failed"))
+}
+
+func TestClose_Timeout(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	store := &MockClickStore{
+		SaveFunc: func(ctx context.Context, clicks []*domain.Click) error {
+			<-block
+			return nil
+		},
+	}
+	r := New(store, &Config{BatchSize: 1, FlushInterval: time.Hour})
+	r.Record(&domain.Click{ShortCode: "a"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, r.Close(ctx), context.DeadlineExceeded)
+}
+
+func statValue(key string) int64 {
+	v := stats.Get(key)
+	if v == nil {
+		return 0
+	}
+	return v.(interface{ Value() int64 }).Value()
+}
+
+func TestMultiStore(t *testing.T) {
+	store, batches := newMemoryStore()
+	failing := StoreFunc(func(ctx context.Context, clicks []*domain.Click) error {
+		return errors.New("store down")
+	})
+
+	// a failing store does not keep the batch from the others
+	err := MultiStore(failing, store).Save(context.Background(), []*domain.Click{{ShortCode: "a"}})
+	assert.EqualError(t, err, "store down")
+	assert.Len(t, batches(), 1)
+
+	assert.NoError(t, MultiStore(store).Save(context.Background(), []*domain.Click{{ShortCode: "b"}}))
+	assert.Len(t, batches(), 2)
+}
@@ -0,0 +1,46 @@
+package click
+
+import (
+	"context"
+
+	"github.com/sappy5678/dcard/pkg/domain"
+)
+
+type MockClickRepository struct {
+	RecordFunc func(click *domain.Click)
+	CloseFunc  func(ctx context.Context) error
+}
+
+func (m *MockClickRepository) Record(click *domain.Click) {
+	m.RecordFunc(click)
+}
+
+func (m *MockClickRepository) Close(ctx context.Context) error {
+	return m.CloseFunc(ctx)
+}
+
+type MockClickStore struct {
+	SaveFunc func(ctx context.Context, clicks []*domain.Click) error
+}
+
+func (m *MockClickStore) Save(ctx context.Context, clicks []*domain.Click) error {
+	return m.SaveFunc(ctx, clicks)
+}
+
+type MockStatsRepository struct {
+	StatsFunc      func(ctx context.Context, shortCode string, query *domain.LinkStatsQuery) (*domain.LinkStats, error)
+	ScanClicksFunc func(ctx context.Context, shortCode string, query *domain.ClickExportQuery, fn func(click *domain.Click) error) error
+	ScanDailyFunc  func(ctx context.Context, shortCode string, query *domain.ClickExportQuery, fn func(bucket *domain.StatsBucket) error) error
+}
+
+func (m *MockStatsRepository) Stats(ctx context.Context, shortCode string, query *domain.LinkStatsQuery) (*domain.LinkStats, error) {
+	return m.StatsFunc(ctx, shortCode, query)
+}
+
+func (m *MockStatsRepository) ScanClicks(ctx context.Context, shortCode string, query *domain.ClickExportQuery, fn func(click *domain.Click) error) error {
+	return m.ScanClicksFunc(ctx, shortCode, query, fn)
+}
+
+func (m *MockStatsRepository) ScanDaily(ctx context.Context, shortCode string, query *domain.ClickExportQuery, fn func(bucket *domain.StatsBucket) error) error {
+	return m.ScanDailyFunc(ctx, shortCode, query, fn)
+}
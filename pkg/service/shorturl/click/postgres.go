@@ -0,0 +1,73 @@
+package click
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/sappy5678/dcard/pkg/domain"
+)
+
+type postgresStore struct {
+	db     *sqlx.DB
+	events bool
+}
+
+// NewPostgresStore returns a Store backed by the click_event table, the rollups read by the stats api are updated in the same transaction
+func NewPostgresStore(db *sqlx.DB) Store {
+	return &postgresStore{
+		db:     db,
+		events: true,
+	}
+}
+
+// NewRollupStore returns a Store which only updates the rollups read by the stats api, for when the events go elsewhere
+func NewRollupStore(db *sqlx.DB) Store {
+	return &postgresStore{
+		db: db,
+	}
+}
+
+const (
+	insertQuery = `INSERT INTO click_event (short_code, click_time, referrer, user_agent, ip, bot)
+VALUES (:short_code, :click_time, :referrer, :user_agent, :ip, :bot)`
+	hourlyQuery = `INSERT INTO click_rollup_hourly (short_code, bucket_time, bot, clicks)
+VALUES (:short_code, :bucket_time, :bot, :clicks)
+ON CONFLICT (short_code, bucket_time, bot) DO UPDATE SET clicks = click_rollup_hourly.clicks + EXCLUDED.clicks`
+	referrerQuery = `INSERT INTO click_rollup_referrer (short_code, referrer, bot, clicks)
+VALUES (:short_code, :name, :bot, :clicks)
+ON CONFLICT (short_code, referrer, bot) DO UPDATE SET clicks = click_rollup_referrer.clicks + EXCLUDED.clicks`
+	agentQuery = `INSERT INTO click_rollup_agent (short_code, family, bot, clicks)
+VALUES (:short_code, :name, :bot, :clicks)
+ON CONFLICT (short_code, family, bot) DO UPDATE SET clicks = click_rollup_agent.clicks + EXCLUDED.clicks`
+)
+
+func (s *postgresStore) Save(ctx context.Context, clicks []*domain.Click) error {
+	if len(clicks) == 0 {
+		return nil
+	}
+	r := newRollup(clicks)
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// a slice is expanded into a single multi-row insert
+	if s.events {
+		if _, err := tx.NamedExecContext(ctx, insertQuery, clicks); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.NamedExecContext(ctx, hourlyQuery, r.hourly); err != nil {
+		return err
+	}
+	if _, err := tx.NamedExecContext(ctx, referrerQuery, r.referrers); err != nil {
+		return err
+	}
+	if _, err := tx.NamedExecContext(ctx, agentQuery, r.agents); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,54 @@
+package click
+
+import (
+	"context"
+	"errors"
+
+	"github.com/sappy5678/dcard/pkg/domain"
+)
+
+// Repository records clicks in the background, so redirects never wait on storage
+type Repository interface {
+	// Record queues the click, it is dropped when the buffer is full
+	Record(click *domain.Click)
+	// Close flushes the queued clicks
+	Close(ctx context.Context) error
+}
+
+// Store persists a batch of clicks
+type Store interface {
+	Save(ctx context.Context, clicks []*domain.Click) error
+}
+
+// StoreFunc adapts a function to a Store
+type StoreFunc func(ctx context.Context, clicks []*domain.Click) error
+
+func (f StoreFunc) Save(ctx context.Context, clicks []*domain.Click) error {
+	return f(ctx, clicks)
+}
+
+type multiStore []Store
+
+// MultiStore returns a Store saving every batch to all of the stores, a failing store does not keep the batch from the others
+func MultiStore(stores ...Store) Store {
+	return multiStore(stores)
+}
+
+func (m multiStore) Save(ctx context.Context, clicks []*domain.Click) error {
+	var errs []error
+	for _, store := range m {
+		if err := store.Save(ctx, clicks); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// StatsRepository reads the click rollups of short urls
+type StatsRepository interface {
+	Stats(ctx context.Context, shortCode string, query *domain.LinkStatsQuery) (*domain.LinkStats, error)
+	// ScanClicks calls fn with the click events of a short url in time order, row by row
+	ScanClicks(ctx context.Context, shortCode string, query *domain.ClickExportQuery, fn func(click *domain.Click) error) error
+	// ScanDaily calls fn with the daily rollups of a short url in time order, row by row
+	ScanDaily(ctx context.Context, shortCode string, query *domain.ClickExportQuery, fn func(bucket *domain.StatsBucket) error) error
+}
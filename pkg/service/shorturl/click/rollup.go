@@ -0,0 +1,153 @@
+package click
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/sappy5678/dcard/pkg/domain"
+)
+
+const (
+	hourSeconds = 3600
+
+	// DirectReferrer names clicks without a referrer
+	DirectReferrer = "(direct)"
+)
+
+// agentFamilies are matched in order, browsers embed the tokens of the ones they imitate, so the most specific comes first
+var agentFamilies = []struct {
+	token  string
+	family string
+}{
+	{"bot", "Bot"},
+	{"spider", "Bot"},
+	{"crawl", "Bot"},
+	{"edg/", "Edge"},
+	{"opr/", "Opera"},
+	{"samsungbrowser/", "Samsung Internet"},
+	{"firefox/", "Firefox"},
+	{"chrome/", "Chrome"},
+	{"crios/", "Chrome"},
+	{"safari/", "Safari"},
+	{"curl/", "curl"},
+	{"wget/", "Wget"},
+}
+
+// AgentFamily returns the browser family of a user agent
+func AgentFamily(userAgent string) string {
+	if userAgent == "" {
+		return "Unknown"
+	}
+	ua := strings.ToLower(userAgent)
+	for _, f := range agentFamilies {
+		if strings.Contains(ua, f.token) {
+			return f.family
+		}
+	}
+	return "Other"
+}
+
+// ReferrerHost returns the host clicks of a referrer are grouped by
+func ReferrerHost(referrer string) string {
+	if referrer == "" {
+		return DirectReferrer
+	}
+	u, err := url.Parse(referrer)
+	if err != nil || u.Host == "" {
+		return referrer
+	}
+	return strings.ToLower(u.Host)
+}
+
+// VisitorID identifies a visitor by its anonymized ip and user agent
+func VisitorID(click *domain.Click) string {
+	sum := sha256.Sum256([]byte(click.IP + "|" + click.UserAgent))
+	return hex.EncodeToString(sum[:16])
+}
+
+type hourlyRow struct {
+	ShortCode  string `db:"short_code"`
+	BucketTime uint64 `db:"bucket_time"`
+	Bot        bool   `db:"bot"`
+	Clicks     uint64 `db:"clicks"`
+}
+
+type countRow struct {
+	ShortCode string `db:"short_code"`
+	Name      string `db:"name"`
+	Bot       bool   `db:"bot"`
+	Clicks    uint64 `db:"clicks"`
+}
+
+// rollup holds the rollup rows of a batch, a key appears once per table so the batch upserts cleanly.
+// Rows are sorted by their key, so batches saved at once lock the rows they share in the same order and do not deadlock.
+type rollup struct {
+	hourly    []hourlyRow
+	referrers []countRow
+	agents    []countRow
+}
+
+func newRollup(clicks []*domain.Click) *rollup {
+	type nameKey struct {
+		shortCode string
+		name      string
+		bot       bool
+	}
+	type hourKey struct {
+		shortCode string
+		bucket    uint64
+		bot       bool
+	}
+	hourly := map[hourKey]uint64{}
+	referrers := map[nameKey]uint64{}
+	agents := map[nameKey]uint64{}
+	for _, click := range clicks {
+		hourly[hourKey{click.ShortCode, click.Time - click.Time%hourSeconds, click.Bot}]++
+		referrers[nameKey{click.ShortCode, ReferrerHost(click.Referrer), click.Bot}]++
+		agents[nameKey{click.ShortCode, AgentFamily(click.UserAgent), click.Bot}]++
+	}
+
+	r := &rollup{}
+	for k, clicks := range hourly {
+		r.hourly = append(r.hourly, hourlyRow{ShortCode: k.shortCode, BucketTime: k.bucket, Bot: k.bot, Clicks: clicks})
+	}
+	for k, clicks := range referrers {
+		r.referrers = append(r.referrers, countRow{ShortCode: k.shortCode, Name: k.name, Bot: k.bot, Clicks: clicks})
+	}
+	for k, clicks := range agents {
+		r.agents = append(r.agents, countRow{ShortCode: k.shortCode, Name: k.name, Bot: k.bot, Clicks: clicks})
+	}
+	slices.SortFunc(r.hourly, func(a, b hourlyRow) int {
+		return cmp.Or(
+			cmp.Compare(a.ShortCode, b.ShortCode),
+			cmp.Compare(a.BucketTime, b.BucketTime),
+			compareBool(a.Bot, b.Bot),
+		)
+	})
+	slices.SortFunc(r.referrers, compareCountRows)
+	slices.SortFunc(r.agents, compareCountRows)
+	return r
+}
+
+func compareCountRows(a, b countRow) int {
+	return cmp.Or(
+		cmp.Compare(a.ShortCode, b.ShortCode),
+		cmp.Compare(a.Name, b.Name),
+		compareBool(a.Bot, b.Bot),
+	)
+}
+
+// compareBool orders false before true
+func compareBool(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return 1
+	}
+	return -1
+}
@@ -0,0 +1,77 @@
+package click
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sappy5678/dcard/pkg/domain"
+)
+
+func TestAgentFamily(t *testing.T) {
+	tests := []struct {
+		name      string
+		userAgent string
+		want      string
+	}{
+		{name: "empty", userAgent: "", want: "Unknown"},
+		{name: "chrome", userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36", want: "Chrome"},
+		{name: "edge", userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.0.0", want: "Edge"},
+		{name: "safari", userAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1", want: "Safari"},
+		{name: "firefox", userAgent: "Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0", want: "Firefox"},
+		{name: "bot", userAgent: "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", want: "Bot"},
+		{name: "curl", userAgent: "curl/8.4.0", want: "curl"},
+		{name: "other", userAgent: "Lynx/2.8.9", want: "Other"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, AgentFamily(tt.userAgent))
+		})
+	}
+}
+
+func TestReferrerHost(t *testing.T) {
+	assert.Equal(t, DirectReferrer, ReferrerHost(""))
+	assert.Equal(t, "news.example.com", ReferrerHost("https://News.Example.com/a/b?c=d"))
+	assert.Equal(t, "android-app", ReferrerHost("android-app"))
+}
+
+func TestNewRollup(t *testing.T) {
+	clicks := []*domain.Click{
+		{ShortCode: "abc", Time: 3600, Referrer: "https://example.com/a", UserAgent: "curl/8.0", IP: "203.0.113.0"},
+		{ShortCode: "abc", Time: 7199, Referrer: "https://example.com/b", UserAgent: "curl/8.0", IP: "203.0.113.0"},
+		{ShortCode: "abc", Time: 7200, IP: "198.51.100.0"},
+		{ShortCode: "def", Time: 7200},
+		{ShortCode: "def", Time: 7200, Bot: true},
+	}
+
+	r := newRollup(clicks)
+	// bots are counted apart, rows are sorted by their key
+	assert.Equal(t, []hourlyRow{
+		{ShortCode: "abc", BucketTime: 3600, Clicks: 2},
+		{ShortCode: "abc", BucketTime: 7200, Clicks: 1},
+		{ShortCode: "def", BucketTime: 7200, Clicks: 1},
+		{ShortCode: "def", BucketTime: 7200, Bot: true, Clicks: 1},
+	}, r.hourly)
+	assert.Equal(t, []countRow{
+		{ShortCode: "abc", Name: DirectReferrer, Clicks: 1},
+		{ShortCode: "abc", Name: "example.com", Clicks: 2},
+		{ShortCode: "def", Name: DirectReferrer, Clicks: 1},
+		{ShortCode: "def", Name: DirectReferrer, Bot: true, Clicks: 1},
+	}, r.referrers)
+	assert.Equal(t, []countRow{
+		{ShortCode: "abc", Name: "Unknown", Clicks: 1},
+		{ShortCode: "abc", Name: "curl", Clicks: 2},
+		{ShortCode: "def", Name: "Unknown", Clicks: 1},
+		{ShortCode: "def", Name: "Unknown", Bot: true, Clicks: 1},
+	}, r.agents)
+}
+
+func TestVisitorID(t *testing.T) {
+	a := &domain.Click{ShortCode: "abc", IP: "203.0.113.0", UserAgent: "curl/8.0"}
+	// the same ip and user agent is one visitor, whatever link it visits
+	assert.Equal(t, VisitorID(a), VisitorID(&domain.Click{ShortCode: "def", IP: "203.0.113.0", UserAgent: "curl/8.0"}))
+	assert.NotEqual(t, VisitorID(a), VisitorID(&domain.Click{ShortCode: "abc", IP: "203.0.113.0", UserAgent: "curl/8.1"}))
+	assert.Len(t, VisitorID(a), 32)
+}
@@ -0,0 +1,109 @@
+package click
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/sappy5678/dcard/pkg/domain"
+)
+
+type statsRepository struct {
+	db *sqlx.DB
+}
+
+// NewStatsRepository returns a StatsRepository reading the rollups written by the postgres or rollup store, unique visitors are left to the caller
+func NewStatsRepository(db *sqlx.DB) StatsRepository {
+	return &statsRepository{
+		db: db,
+	}
+}
+
+// $2 of every query tells whether the clicks of bots are left out
+const (
+	totalQuery = `SELECT COALESCE(SUM(clicks), 0) FROM click_rollup_hourly
+WHERE short_code = $1 AND NOT (bot AND $2)`
+	// hours are aligned like days, so the first hour is counted whole
+	hourlyRangeQuery = `SELECT bucket_time, SUM(clicks) AS clicks FROM click_rollup_hourly
+WHERE short_code = $1 AND NOT (bot AND $2) AND bucket_time BETWEEN $3::BIGINT - $3::BIGINT % 3600 AND $4
+GROUP BY 1 ORDER BY 1`
+	// days are aligned to UTC midnight, so the first day is counted whole
+	dailyRangeQuery = `SELECT bucket_time - bucket_time % 86400 AS bucket_time, SUM(clicks) AS clicks FROM click_rollup_hourly
+WHERE short_code = $1 AND NOT (bot AND $2) AND bucket_time BETWEEN $3::BIGINT - $3::BIGINT % 86400 AND $4
+GROUP BY 1 ORDER BY 1`
+	topReferrerQuery = `SELECT referrer AS name, SUM(clicks) AS clicks FROM click_rollup_referrer
+WHERE short_code = $1 AND NOT (bot AND $2)
+GROUP BY 1 ORDER BY 2 DESC, 1 LIMIT $3`
+	topAgentQuery = `SELECT family AS name, SUM(clicks) AS clicks FROM click_rollup_agent
+WHERE short_code = $1 AND NOT (bot AND $2)
+GROUP BY 1 ORDER BY 2 DESC, 1 LIMIT $3`
+)
+
+func (s *statsRepository) Stats(ctx context.Context, shortCode string, query *domain.LinkStatsQuery) (*domain.LinkStats, error) {
+	stats := &domain.LinkStats{
+		ShortCode:     shortCode,
+		Hourly:        []domain.StatsBucket{},
+		Daily:         []domain.StatsBucket{},
+		TopReferrers:  []domain.StatsCount{},
+		TopUserAgents: []domain.StatsCount{},
+	}
+	if err := s.db.GetContext(ctx, &stats.TotalClicks, totalQuery, shortCode, query.ExcludeBots); err != nil {
+		return nil, err
+	}
+	if err := s.db.SelectContext(ctx, &stats.Hourly, hourlyRangeQuery, shortCode, query.ExcludeBots, query.From, query.To); err != nil {
+		return nil, err
+	}
+	if err := s.db.SelectContext(ctx, &stats.Daily, dailyRangeQuery, shortCode, query.ExcludeBots, query.From, query.To); err != nil {
+		return nil, err
+	}
+	if err := s.db.SelectContext(ctx, &stats.TopReferrers, topReferrerQuery, shortCode, query.ExcludeBots, query.Top); err != nil {
+		return nil, err
+	}
+	if err := s.db.SelectContext(ctx, &stats.TopUserAgents, topAgentQuery, shortCode, query.ExcludeBots, query.Top); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+const scanClicksQuery = `SELECT short_code, click_time, referrer, user_agent, ip, bot FROM click_event
+WHERE short_code = $1 AND NOT (bot AND $2) AND click_time BETWEEN $3 AND $4
+ORDER BY click_time, id`
+
+func (s *statsRepository) ScanClicks(ctx context.Context, shortCode string, query *domain.ClickExportQuery, fn func(click *domain.Click) error) error {
+	rows, err := s.db.QueryxContext(ctx, scanClicksQuery, shortCode, query.ExcludeBots, query.From, query.To)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		click := &domain.Click{}
+		if err := rows.StructScan(click); err != nil {
+			return err
+		}
+		if err := fn(click); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (s *statsRepository) ScanDaily(ctx context.Context, shortCode string, query *domain.ClickExportQuery, fn func(bucket *domain.StatsBucket) error) error {
+	// the same buckets as the daily series of Stats
+	rows, err := s.db.QueryxContext(ctx, dailyRangeQuery, shortCode, query.ExcludeBots, query.From, query.To)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		bucket := &domain.StatsBucket{}
+		if err := rows.StructScan(bucket); err != nil {
+			return err
+		}
+		if err := fn(bucket); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,55 @@
+package click
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/redis/rueidis"
+
+	"github.com/sappy5678/dcard/pkg/domain"
+)
+
+const defaultStreamMaxLen = 1000000
+
+type streamStore struct {
+	client rueidis.Client
+	key    string
+	maxLen int64
+}
+
+// NewStreamStore returns a Store that appends clicks to a Redis Stream for other consumers, the stream is trimmed to about maxLen entries
+func NewStreamStore(client rueidis.Client, key string, maxLen int64) Store {
+	if maxLen <= 0 {
+		maxLen = defaultStreamMaxLen
+	}
+	return &streamStore{
+		client: client,
+		key:    key,
+		maxLen: maxLen,
+	}
+}
+
+func (s *streamStore) Save(ctx context.Context, clicks []*domain.Click) error {
+	if len(clicks) == 0 {
+		return nil
+	}
+
+	cmds := make(rueidis.Commands, 0, len(clicks))
+	for _, click := range clicks {
+		cmds = append(cmds, s.client.B().Xadd().Key(s.key).Maxlen().Almost().Threshold(strconv.FormatInt(s.maxLen, 10)).Id("*").
+			FieldValue().
+			FieldValue("short_code", click.ShortCode).
+			FieldValue("click_time", strconv.FormatUint(click.Time, 10)).
+			FieldValue("referrer", click.Referrer).
+			FieldValue("user_agent", click.UserAgent).
+			FieldValue("ip", click.IP).
+			FieldValue("bot", strconv.FormatBool(click.Bot)).
+			Build())
+	}
+	for _, resp := range s.client.DoMulti(ctx, cmds...) {
+		if err := resp.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
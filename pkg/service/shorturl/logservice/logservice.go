@@ -22,20 +22,38 @@ type LogService struct {
 
 const name = "shorturl"
 
-func (ls *LogService) Create(ctx context.Context, originalURL string, expireTime uint64) (short *domain.ShortURL, err error) {
+func (ls *LogService) Create(ctx context.Context, req *domain.ShortURLCreate) (short *domain.ShortURL, err error) {
 	defer func(begin time.Time) {
 		ls.logger.Log(
 			ctx,
 			name, "Create shorturl request", err,
 			map[string]interface{}{
-				"originalURL": originalURL,
-				"expireTime":  expireTime,
-				"took":        time.Since(begin),
+				"originalURL":    req.OriginalURL,
+				"expireTime":     req.ExpireTime,
+				"alias":          req.Alias,
+				"idempotencyKey": req.IdempotencyKey,
+				"dedupe":         req.Dedupe,
+				"took":           time.Since(begin),
 			},
 		)
 	}(time.Now())
 
-	return ls.ShortURLService.Create(ctx, originalURL, expireTime)
+	return ls.ShortURLService.Create(ctx, req)
+}
+
+func (ls *LogService) CreateBatch(ctx context.Context, reqs []*domain.ShortURLCreate) (results []*domain.ShortURLBatchResult, err error) {
+	defer func(begin time.Time) {
+		ls.logger.Log(
+			ctx,
+			name, "Create shorturl batch request", err,
+			map[string]interface{}{
+				"size": len(reqs),
+				"took": time.Since(begin),
+			},
+		)
+	}(time.Now())
+
+	return ls.ShortURLService.CreateBatch(ctx, reqs)
 }
 
 func (ls *LogService) Get(ctx context.Context, shortCode string) (short *domain.ShortURL, err error) {
@@ -52,3 +70,159 @@ func (ls *LogService) Get(ctx context.Context, shortCode string) (short *domain.
 
 	return ls.ShortURLService.Get(ctx, shortCode)
 }
+
+func (ls *LogService) Lookup(ctx context.Context, shortCode string) (short *domain.ShortURL, err error) {
+	defer func(begin time.Time) {
+		ls.logger.Log(
+			ctx,
+			name, "Lookup shorturl request", err,
+			map[string]interface{}{
+				"shortCode": shortCode,
+				"took":      time.Since(begin),
+			},
+		)
+	}(time.Now())
+
+	return ls.ShortURLService.Lookup(ctx, shortCode)
+}
+
+func (ls *LogService) Visit(ctx context.Context, click *domain.Click) (short *domain.ShortURL, err error) {
+	defer func(begin time.Time) {
+		ls.logger.Log(
+			ctx,
+			name, "Visit shorturl request", err,
+			map[string]interface{}{
+				"shortCode": click.ShortCode,
+				"referrer":  click.Referrer,
+				"took":      time.Since(begin),
+			},
+		)
+	}(time.Now())
+
+	return ls.ShortURLService.Visit(ctx, click)
+}
+
+func (ls *LogService) Stats(ctx context.Context, shortCode string, query *domain.LinkStatsQuery) (stats *domain.LinkStats, err error) {
+	defer func(begin time.Time) {
+		params := map[string]interface{}{
+			"shortCode": shortCode,
+			"took":      time.Since(begin),
+		}
+		if query != nil {
+			params["from"] = query.From
+			params["to"] = query.To
+			params["top"] = query.Top
+		}
+		ls.logger.Log(ctx, name, "Stats shorturl request", err, params)
+	}(time.Now())
+
+	return ls.ShortURLService.Stats(ctx, shortCode, query)
+}
+
+func (ls *LogService) Top(ctx context.Context, window string, limit int) (top []*domain.TopShortURL, err error) {
+	defer func(begin time.Time) {
+		ls.logger.Log(
+			ctx,
+			name, "Top shorturl request", err,
+			map[string]interface{}{
+				"window": window,
+				"limit":  limit,
+				"took":   time.Since(begin),
+			},
+		)
+	}(time.Now())
+
+	return ls.ShortURLService.Top(ctx, window, limit)
+}
+
+func (ls *LogService) Subscribe(ctx context.Context, shortCode string) (clicks <-chan *domain.Click, err error) {
+	defer func(begin time.Time) {
+		ls.logger.Log(
+			ctx,
+			name, "Subscribe shorturl request", err,
+			map[string]interface{}{
+				"shortCode": shortCode,
+				"took":      time.Since(begin),
+			},
+		)
+	}(time.Now())
+
+	return ls.ShortURLService.Subscribe(ctx, shortCode)
+}
+
+func exportParams(shortCode string, query *domain.ClickExportQuery, begin time.Time) map[string]interface{} {
+	params := map[string]interface{}{
+		"shortCode": shortCode,
+		"took":      time.Since(begin),
+	}
+	if query != nil {
+		params["from"] = query.From
+		params["to"] = query.To
+		params["excludeBots"] = query.ExcludeBots
+	}
+	return params
+}
+
+func (ls *LogService) ExportClicks(ctx context.Context, shortCode string, query *domain.ClickExportQuery, fn func(click *domain.Click) error) (err error) {
+	defer func(begin time.Time) {
+		ls.logger.Log(ctx, name, "Export shorturl clicks request", err, exportParams(shortCode, query, begin))
+	}(time.Now())
+
+	return ls.ShortURLService.ExportClicks(ctx, shortCode, query, fn)
+}
+
+func (ls *LogService) ExportDaily(ctx context.Context, shortCode string, query *domain.ClickExportQuery, fn func(bucket *domain.StatsBucket) error) (err error) {
+	defer func(begin time.Time) {
+		ls.logger.Log(ctx, name, "Export shorturl daily clicks request", err, exportParams(shortCode, query, begin))
+	}(time.Now())
+
+	return ls.ShortURLService.ExportDaily(ctx, shortCode, query, fn)
+}
+
+func (ls *LogService) Update(ctx context.Context, shortCode string, update *domain.ShortURLUpdate) (short *domain.ShortURL, err error) {
+	defer func(begin time.Time) {
+		params := map[string]interface{}{
+			"shortCode": shortCode,
+			"took":      time.Since(begin),
+		}
+		if update.OriginalURL != nil {
+			params["originalURL"] = *update.OriginalURL
+		}
+		if update.ExpireTime != nil {
+			params["expireTime"] = *update.ExpireTime
+		}
+		ls.logger.Log(ctx, name, "Update shorturl request", err, params)
+	}(time.Now())
+
+	return ls.ShortURLService.Update(ctx, shortCode, update)
+}
+
+func (ls *LogService) Delete(ctx context.Context, shortCode string) (err error) {
+	defer func(begin time.Time) {
+		ls.logger.Log(
+			ctx,
+			name, "Delete shorturl request", err,
+			map[string]interface{}{
+				"shortCode": shortCode,
+				"took":      time.Since(begin),
+			},
+		)
+	}(time.Now())
+
+	return ls.ShortURLService.Delete(ctx, shortCode)
+}
+
+func (ls *LogService) Disable(ctx context.Context, shortCode string) (err error) {
+	defer func(begin time.Time) {
+		ls.logger.Log(
+			ctx,
+			name, "Disable shorturl request", err,
+			map[string]interface{}{
+				"shortCode": shortCode,
+				"took":      time.Since(begin),
+			},
+		)
+	}(time.Now())
+
+	return ls.ShortURLService.Disable(ctx, shortCode)
+}
@@ -33,22 +33,67 @@ var (
 )
 
 var mockShortURLService = &shorturl.MockShortURLService{
-	CreateFunc: func(ctx context.Context, originalURL string, expireTime uint64) (*domain.ShortURL, error) {
-		if originalURL != mockShort.OriginalURL || expireTime != mockShort.ExpireTime {
+	CreateFunc: func(ctx context.Context, req *domain.ShortURLCreate) (*domain.ShortURL, error) {
+		if req.OriginalURL != mockShort.OriginalURL || req.ExpireTime != mockShort.ExpireTime {
 			return nil, mockError
 		}
 		return mockShort, nil
 	},
+	CreateBatchFunc: func(ctx context.Context, reqs []*domain.ShortURLCreate) ([]*domain.ShortURLBatchResult, error) {
+		return []*domain.ShortURLBatchResult{{ShortURL: mockShort}, {Err: mockError}}, nil
+	},
 	GetFunc: func(ctx context.Context, shortCode string) (*domain.ShortURL, error) {
 		return mockShort, nil
 	},
+	LookupFunc: func(ctx context.Context, shortCode string) (*domain.ShortURL, error) {
+		return mockShort, nil
+	},
+	VisitFunc: func(ctx context.Context, click *domain.Click) (*domain.ShortURL, error) {
+		return mockShort, nil
+	},
+	StatsFunc: func(ctx context.Context, shortCode string, query *domain.LinkStatsQuery) (*domain.LinkStats, error) {
+		return &domain.LinkStats{ShortCode: shortCode}, nil
+	},
+	TopFunc: func(ctx context.Context, window string, limit int) ([]*domain.TopShortURL, error) {
+		return []*domain.TopShortURL{{ShortURL: *mockShort, Clicks: 1}}, nil
+	},
+	SubscribeFunc: func(ctx context.Context, shortCode string) (<-chan *domain.Click, error) {
+		return nil, domain.ErrShortURLNotFound
+	},
+	ExportClicksFunc: func(ctx context.Context, shortCode string, query *domain.ClickExportQuery, fn func(click *domain.Click) error) error {
+		return fn(&domain.Click{ShortCode: shortCode})
+	},
+	ExportDailyFunc: func(ctx context.Context, shortCode string, query *domain.ClickExportQuery, fn func(bucket *domain.StatsBucket) error) error {
+		return domain.ErrShortURLNotFound
+	},
+	UpdateFunc: func(ctx context.Context, shortCode string, update *domain.ShortURLUpdate) (*domain.ShortURL, error) {
+		return mockShort, nil
+	},
+	DeleteFunc: func(ctx context.Context, shortCode string) error {
+		return mockError
+	},
+	DisableFunc: func(ctx context.Context, shortCode string) error {
+		return nil
+	},
 }
 
 func TestCreate(t *testing.T) {
 	log := zlog.New()
 	svc := sl.New(mockShortURLService, log)
-	r1, e1 := svc.Create(context.Background(), mockOriginalURL, uint64(mockExpireTime.Unix()))
-	r2, e2 := mockShortURLService.Create(context.Background(), mockOriginalURL, uint64(mockExpireTime.Unix()))
+	req := &domain.ShortURLCreate{OriginalURL: mockOriginalURL, ExpireTime: uint64(mockExpireTime.Unix())}
+	r1, e1 := svc.Create(context.Background(), req)
+	r2, e2 := mockShortURLService.Create(context.Background(), req)
+
+	assert.Equal(t, r1, r2)
+	assert.Equal(t, e1, e2)
+}
+
+func TestCreateBatch(t *testing.T) {
+	log := zlog.New()
+	svc := sl.New(mockShortURLService, log)
+	reqs := []*domain.ShortURLCreate{{OriginalURL: mockOriginalURL}, {}}
+	r1, e1 := svc.CreateBatch(context.Background(), reqs)
+	r2, e2 := mockShortURLService.CreateBatch(context.Background(), reqs)
 
 	assert.Equal(t, r1, r2)
 	assert.Equal(t, e1, e2)
@@ -63,3 +108,108 @@ func TestGet(t *testing.T) {
 	assert.Equal(t, r1, r2)
 	assert.Equal(t, e1, e2)
 }
+
+func TestLookup(t *testing.T) {
+	log := zlog.New()
+	svc := sl.New(mockShortURLService, log)
+	r1, e1 := svc.Lookup(context.Background(), mockShortCode)
+	r2, e2 := mockShortURLService.Lookup(context.Background(), mockShortCode)
+
+	assert.Equal(t, r1, r2)
+	assert.Equal(t, e1, e2)
+}
+
+func TestVisit(t *testing.T) {
+	log := zlog.New()
+	svc := sl.New(mockShortURLService, log)
+	click := &domain.Click{ShortCode: mockShortCode, Referrer: "https://example.com"}
+	r1, e1 := svc.Visit(context.Background(), click)
+	r2, e2 := mockShortURLService.Visit(context.Background(), click)
+
+	assert.Equal(t, r1, r2)
+	assert.Equal(t, e1, e2)
+}
+
+func TestStats(t *testing.T) {
+	log := zlog.New()
+	svc := sl.New(mockShortURLService, log)
+	query := &domain.LinkStatsQuery{From: 1, To: 2, Top: 3}
+	r1, e1 := svc.Stats(context.Background(), mockShortCode, query)
+	r2, e2 := mockShortURLService.Stats(context.Background(), mockShortCode, query)
+
+	assert.Equal(t, r1, r2)
+	assert.Equal(t, e1, e2)
+}
+
+func TestTop(t *testing.T) {
+	log := zlog.New()
+	svc := sl.New(mockShortURLService, log)
+	r1, e1 := svc.Top(context.Background(), domain.TopWindowHour, 10)
+	r2, e2 := mockShortURLService.Top(context.Background(), domain.TopWindowHour, 10)
+
+	assert.Equal(t, r1, r2)
+	assert.Equal(t, e1, e2)
+}
+
+func TestSubscribe(t *testing.T) {
+	log := zlog.New()
+	svc := sl.New(mockShortURLService, log)
+	r1, e1 := svc.Subscribe(context.Background(), mockShortCode)
+	r2, e2 := mockShortURLService.Subscribe(context.Background(), mockShortCode)
+
+	assert.Equal(t, r1, r2)
+	assert.Equal(t, e1, e2)
+}
+
+func TestExportClicks(t *testing.T) {
+	log := zlog.New()
+	svc := sl.New(mockShortURLService, log)
+	var clicks []*domain.Click
+	err := svc.ExportClicks(context.Background(), mockShortCode, &domain.ClickExportQuery{From: 1, To: 2}, func(click *domain.Click) error {
+		clicks = append(clicks, click)
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []*domain.Click{{ShortCode: mockShortCode}}, clicks)
+}
+
+func TestExportDaily(t *testing.T) {
+	log := zlog.New()
+	svc := sl.New(mockShortURLService, log)
+	fn := func(bucket *domain.StatsBucket) error { return nil }
+	e1 := svc.ExportDaily(context.Background(), mockShortCode, nil, fn)
+	e2 := mockShortURLService.ExportDaily(context.Background(), mockShortCode, nil, fn)
+
+	assert.Equal(t, e1, e2)
+}
+
+func TestUpdate(t *testing.T) {
+	log := zlog.New()
+	svc := sl.New(mockShortURLService, log)
+	originalURL := "https://example.com"
+	update := &domain.ShortURLUpdate{OriginalURL: &originalURL}
+	r1, e1 := svc.Update(context.Background(), mockShortCode, update)
+	r2, e2 := mockShortURLService.Update(context.Background(), mockShortCode, update)
+
+	assert.Equal(t, r1, r2)
+	assert.Equal(t, e1, e2)
+}
+
+func TestDelete(t *testing.T) {
+	log := zlog.New()
+	svc := sl.New(mockShortURLService, log)
+	e1 := svc.Delete(context.Background(), mockShortCode)
+	e2 := mockShortURLService.Delete(context.Background(), mockShortCode)
+
+	assert.Equal(t, e1, e2)
+}
+
+func TestDisable(t *testing.T) {
+	log := zlog.New()
+	svc := sl.New(mockShortURLService, log)
+	e1 := svc.Disable(context.Background(), mockShortCode)
+	e2 := mockShortURLService.Disable(context.Background(), mockShortCode)
+
+	assert.Equal(t, e1, e2)
+}
@@ -7,14 +7,69 @@ import (
 )
 
 type MockShortURLService struct {
-	CreateFunc func(ctx context.Context, originalURL string, expireTime uint64) (*domain.ShortURL, error)
-	GetFunc    func(ctx context.Context, shortCode string) (*domain.ShortURL, error)
+	CreateFunc       func(ctx context.Context, req *domain.ShortURLCreate) (*domain.ShortURL, error)
+	CreateBatchFunc  func(ctx context.Context, reqs []*domain.ShortURLCreate) ([]*domain.ShortURLBatchResult, error)
+	GetFunc          func(ctx context.Context, shortCode string) (*domain.ShortURL, error)
+	LookupFunc       func(ctx context.Context, shortCode string) (*domain.ShortURL, error)
+	VisitFunc        func(ctx context.Context, click *domain.Click) (*domain.ShortURL, error)
+	StatsFunc        func(ctx context.Context, shortCode string, query *domain.LinkStatsQuery) (*domain.LinkStats, error)
+	TopFunc          func(ctx context.Context, window string, limit int) ([]*domain.TopShortURL, error)
+	SubscribeFunc    func(ctx context.Context, shortCode string) (<-chan *domain.Click, error)
+	ExportClicksFunc func(ctx context.Context, shortCode string, query *domain.ClickExportQuery, fn func(click *domain.Click) error) error
+	ExportDailyFunc  func(ctx context.Context, shortCode string, query *domain.ClickExportQuery, fn func(bucket *domain.StatsBucket) error) error
+	UpdateFunc       func(ctx context.Context, shortCode string, update *domain.ShortURLUpdate) (*domain.ShortURL, error)
+	DeleteFunc       func(ctx context.Context, shortCode string) error
+	DisableFunc      func(ctx context.Context, shortCode string) error
 }
 
-func (m *MockShortURLService) Create(ctx context.Context, originalURL string, expireTime uint64) (*domain.ShortURL, error) {
-	return m.CreateFunc(ctx, originalURL, expireTime)
+func (m *MockShortURLService) Create(ctx context.Context, req *domain.ShortURLCreate) (*domain.ShortURL, error) {
+	return m.CreateFunc(ctx, req)
+}
+
+func (m *MockShortURLService) CreateBatch(ctx context.Context, reqs []*domain.ShortURLCreate) ([]*domain.ShortURLBatchResult, error) {
+	return m.CreateBatchFunc(ctx, reqs)
 }
 
 func (m *MockShortURLService) Get(ctx context.Context, shortCode string) (*domain.ShortURL, error) {
 	return m.GetFunc(ctx, shortCode)
 }
+
+func (m *MockShortURLService) Lookup(ctx context.Context, shortCode string) (*domain.ShortURL, error) {
+	return m.LookupFunc(ctx, shortCode)
+}
+
+func (m *MockShortURLService) Visit(ctx context.Context, click *domain.Click) (*domain.ShortURL, error) {
+	return m.VisitFunc(ctx, click)
+}
+
+func (m *MockShortURLService) Stats(ctx context.Context, shortCode string, query *domain.LinkStatsQuery) (*domain.LinkStats, error) {
+	return m.StatsFunc(ctx, shortCode, query)
+}
+
+func (m *MockShortURLService) Top(ctx context.Context, window string, limit int) ([]*domain.TopShortURL, error) {
+	return m.TopFunc(ctx, window, limit)
+}
+
+func (m *MockShortURLService) Subscribe(ctx context.Context, shortCode string) (<-chan *domain.Click, error) {
+	return m.SubscribeFunc(ctx, shortCode)
+}
+
+func (m *MockShortURLService) ExportClicks(ctx context.Context, shortCode string, query *domain.ClickExportQuery, fn func(click *domain.Click) error) error {
+	return m.ExportClicksFunc(ctx, shortCode, query, fn)
+}
+
+func (m *MockShortURLService) ExportDaily(ctx context.Context, shortCode string, query *domain.ClickExportQuery, fn func(bucket *domain.StatsBucket) error) error {
+	return m.ExportDailyFunc(ctx, shortCode, query, fn)
+}
+
+func (m *MockShortURLService) Update(ctx context.Context, shortCode string, update *domain.ShortURLUpdate) (*domain.ShortURL, error) {
+	return m.UpdateFunc(ctx, shortCode, update)
+}
+
+func (m *MockShortURLService) Delete(ctx context.Context, shortCode string) error {
+	return m.DeleteFunc(ctx, shortCode)
+}
+
+func (m *MockShortURLService) Disable(ctx context.Context, shortCode string) error {
+	return m.DisableFunc(ctx, shortCode)
+}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 
 	"github.com/sappy5678/dcard/pkg/domain"
 
@@ -15,6 +16,7 @@ import (
 
 // postgresql error code define
 // http://www.postgresql.org/docs/9.3/static/errcodes-appendix.html
+const uniqueViolation = "23505"
 
 type impl struct {
 	db *sqlx.DB
@@ -31,18 +33,80 @@ var (
 	ErrAlreadyExists = echo.NewHTTPError(http.StatusInternalServerError, "Username or email already exists.")
 )
 
-const createQuery = `INSERT INTO short_url (short_code, original_url, expire_time, created_time) VALUES ($1, $2, $3, $4)`
+const createQuery = `INSERT INTO short_url (short_code, original_url, expire_time, created_time, redirect_status, untrusted, url_hash) VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''))`
 
 func (im *impl) Create(ctx context.Context, short *domain.ShortURL) (*domain.ShortURL, error) {
-	_, err := im.db.ExecContext(ctx, createQuery, short.ShortCode, short.OriginalURL, short.ExpireTime, short.CreatedTime)
+	_, err := im.db.ExecContext(ctx, createQuery, short.ShortCode, short.OriginalURL, short.ExpireTime, short.CreatedTime, short.RedirectStatus, short.Untrusted, short.URLHash)
 	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return nil, domain.ErrShortURLConflict
+		}
 		return nil, err
 	}
 
 	return short, nil
 }
 
-const getQuery = `SELECT short_code, original_url, expire_time, created_time FROM short_url WHERE short_code = $1`
+const (
+	// the short codes which were inserted are returned, a taken one is skipped instead of failing the batch
+	createBatchQuery = `INSERT INTO short_url (short_code, original_url, expire_time, created_time, redirect_status, untrusted, url_hash)
+VALUES (:short_code, :original_url, :expire_time, :created_time, :redirect_status, :untrusted, NULLIF(:url_hash, ''))
+ON CONFLICT (short_code) DO NOTHING RETURNING short_code`
+	// keeps a statement under the 65535 parameters postgres accepts
+	createBatchRows = 5000
+)
+
+func (im *impl) CreateBatch(ctx context.Context, shorts []*domain.ShortURL) ([]error, error) {
+	// the chunks commit together, so a failed batch leaves nothing behind for the caller to report
+	tx, err := im.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	created := make(map[string]bool, len(shorts))
+	for start := 0; start < len(shorts); start += createBatchRows {
+		end := min(start+createBatchRows, len(shorts))
+		if err := insertBatch(ctx, tx, shorts[start:end], created); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	errs := make([]error, len(shorts))
+	for i, short := range shorts {
+		if created[short.ShortCode] {
+			// a code repeated in the batch is only inserted once, by its first short url
+			delete(created, short.ShortCode)
+			continue
+		}
+		errs[i] = domain.ErrShortURLConflict
+	}
+	return errs, nil
+}
+
+// insertBatch inserts shorts in one statement and marks the inserted short codes in created
+func insertBatch(ctx context.Context, tx *sqlx.Tx, shorts []*domain.ShortURL, created map[string]bool) error {
+	rows, err := sqlx.NamedQueryContext(ctx, tx, createBatchQuery, shorts)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var shortCode string
+		if err := rows.Scan(&shortCode); err != nil {
+			return err
+		}
+		created[shortCode] = true
+	}
+	return rows.Err()
+}
+
+const getQuery = `SELECT short_code, original_url, expire_time, created_time, disabled, redirect_status, untrusted FROM short_url WHERE short_code = $1`
 
 func (im *impl) Get(ctx context.Context, shortCode string) (*domain.ShortURL, error) {
 	var short domain.ShortURL
@@ -56,3 +120,175 @@ func (im *impl) Get(ctx context.Context, shortCode string) (*domain.ShortURL, er
 
 	return &short, nil
 }
+
+const getManyQuery = `SELECT short_code, original_url, expire_time, created_time, disabled, redirect_status, untrusted FROM short_url WHERE short_code = ANY($1)`
+
+func (im *impl) GetMany(ctx context.Context, shortCodes []string) ([]*domain.ShortURL, error) {
+	if len(shortCodes) == 0 {
+		return nil, nil
+	}
+	var shorts []*domain.ShortURL
+	if err := im.db.SelectContext(ctx, &shorts, getManyQuery, pq.Array(shortCodes)); err != nil {
+		return nil, err
+	}
+	return shorts, nil
+}
+
+// findDuplicateQuery only sees short urls created with a hash, older ones are never reused
+const findDuplicateQuery = `SELECT short_code, original_url, expire_time, created_time, disabled, redirect_status, untrusted FROM short_url
+WHERE url_hash = $1 AND expire_time >= $2 AND expire_time > $3 AND NOT disabled AND redirect_status = $4 AND untrusted = $5
+ORDER BY created_time DESC LIMIT 1`
+
+func (im *impl) FindDuplicate(ctx context.Context, short *domain.ShortURL) (*domain.ShortURL, error) {
+	return findDuplicate(ctx, im.db, short)
+}
+
+func findDuplicate(ctx context.Context, q sqlx.QueryerContext, short *domain.ShortURL) (*domain.ShortURL, error) {
+	var duplicate domain.ShortURL
+	err := sqlx.GetContext(ctx, q, &duplicate, findDuplicateQuery, short.URLHash, short.ExpireTime, short.CreatedTime, short.RedirectStatus, short.Untrusted)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrShortURLNotFound
+		}
+		return nil, err
+	}
+	return &duplicate, nil
+}
+
+// lockHashQuery serializes the creates of a url hash until their transaction ends
+const lockHashQuery = `SELECT pg_advisory_xact_lock(hashtext($1))`
+
+// CreateOrFindDuplicate looks for the duplicate and inserts short in one transaction holding the lock of its hash,
+// so creates of the same url racing each other cannot both miss
+func (im *impl) CreateOrFindDuplicate(ctx context.Context, short *domain.ShortURL) (*domain.ShortURL, error) {
+	tx, err := im.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, lockHashQuery, short.URLHash); err != nil {
+		return nil, err
+	}
+	duplicate, err := findDuplicate(ctx, tx, short)
+	if err == nil {
+		return duplicate, nil
+	}
+	if !errors.Is(err, domain.ErrShortURLNotFound) {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, createQuery, short.ShortCode, short.OriginalURL, short.ExpireTime, short.CreatedTime, short.RedirectStatus, short.Untrusted, short.URLHash); err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return nil, domain.ErrShortURLConflict
+		}
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return short, nil
+}
+
+const (
+	lockQuery          = `SELECT short_code, original_url, expire_time, created_time, disabled, redirect_status, untrusted, COALESCE(url_hash, '') AS url_hash FROM short_url WHERE short_code = $1 FOR UPDATE`
+	insertHistoryQuery = `INSERT INTO short_url_history (short_code, original_url, expire_time, changed_time) VALUES ($1, $2, $3, EXTRACT(EPOCH FROM now())::BIGINT)`
+	updateQuery        = `UPDATE short_url SET original_url = $2, expire_time = $3, redirect_status = $4, untrusted = $5, url_hash = NULLIF($6, '') WHERE short_code = $1`
+)
+
+// Update merges the change into the locked row, so concurrent updates of different fields both land
+func (im *impl) Update(ctx context.Context, shortCode string, apply func(short *domain.ShortURL) error) (*domain.ShortURL, error) {
+	tx, err := im.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var short domain.ShortURL
+	if err := tx.GetContext(ctx, &short, lockQuery, shortCode); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrShortURLNotFound
+		}
+		return nil, err
+	}
+	previous := short
+	if err := apply(&short); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, insertHistoryQuery, short.ShortCode, previous.OriginalURL, previous.ExpireTime); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, updateQuery, short.ShortCode, short.OriginalURL, short.ExpireTime, short.RedirectStatus, short.Untrusted, short.URLHash); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &short, nil
+}
+
+const deleteQuery = `DELETE FROM short_url WHERE short_code = $1`
+
+func (im *impl) Delete(ctx context.Context, shortCode string) error {
+	result, err := im.db.ExecContext(ctx, deleteQuery, shortCode)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+const disableQuery = `UPDATE short_url SET disabled = true WHERE short_code = $1`
+
+func (im *impl) Disable(ctx context.Context, shortCode string) error {
+	result, err := im.db.ExecContext(ctx, disableQuery, shortCode)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+const (
+	scanQuery     = `SELECT id, short_code FROM short_url WHERE id > $1 AND created_time >= $2 ORDER BY id LIMIT $3`
+	scanBatchSize = 1000
+)
+
+func (im *impl) ScanShortCodes(ctx context.Context, createdSince uint64, fn func(shortCodes []string) error) error {
+	var lastID int64
+	for {
+		var rows []struct {
+			ID        int64  `db:"id"`
+			ShortCode string `db:"short_code"`
+		}
+		if err := im.db.SelectContext(ctx, &rows, scanQuery, lastID, createdSince, scanBatchSize); err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+
+		shortCodes := make([]string, len(rows))
+		for i, row := range rows {
+			shortCodes[i] = row.ShortCode
+		}
+		if err := fn(shortCodes); err != nil {
+			return err
+		}
+		if len(rows) < scanBatchSize {
+			return nil
+		}
+		lastID = rows[len(rows)-1].ID
+	}
+}
+
+// expectAffected reports ErrShortURLNotFound when a statement matched no short url
+func expectAffected(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrShortURLNotFound
+	}
+	return nil
+}
@@ -2,6 +2,8 @@ package repository_test
 
 import (
 	"context"
+	"fmt"
+	"sync"
 	"testing"
 
 	embeddedpostgres "github.com/fergusstrange/embedded-postgres"
@@ -143,6 +145,21 @@ func (ts *TestSuite) TestCreate() {
 	}
 }
 
+func (ts *TestSuite) TestCreate_Conflict() {
+	ctx := context.Background()
+	short := &domain.ShortURL{
+		ShortCode:   "spring-sale",
+		OriginalURL: "http://test.com",
+		ExpireTime:  1,
+		CreatedTime: 1,
+	}
+
+	_, err := ts.impl.Create(ctx, short)
+	ts.Require().NoError(err)
+	_, err = ts.impl.Create(ctx, short)
+	ts.Require().ErrorIs(err, domain.ErrShortURLConflict)
+}
+
 func (ts *TestSuite) TestGet() {
 	ctx := context.Background()
 	testCases := []struct {
@@ -187,6 +204,250 @@ func (ts *TestSuite) TestGet() {
 	}
 }
 
+func (ts *TestSuite) TestGetMany() {
+	ctx := context.Background()
+	for _, shortCode := range []string{"many1", "many2"} {
+		_, err := ts.impl.Create(ctx, &domain.ShortURL{ShortCode: shortCode, OriginalURL: "http://test.com", ExpireTime: 1, CreatedTime: 1})
+		ts.Require().NoError(err)
+	}
+
+	shorts, err := ts.impl.GetMany(ctx, []string{"many1", "missing", "many2"})
+	ts.Require().NoError(err)
+	shortCodes := []string{}
+	for _, short := range shorts {
+		shortCodes = append(shortCodes, short.ShortCode)
+	}
+	ts.Require().ElementsMatch([]string{"many1", "many2"}, shortCodes)
+}
+
+func (ts *TestSuite) TestCreateBatch() {
+	ctx := context.Background()
+	_, err := ts.impl.Create(ctx, &domain.ShortURL{ShortCode: "taken", OriginalURL: "http://test.com", ExpireTime: 1, CreatedTime: 1})
+	ts.Require().NoError(err)
+
+	errs, err := ts.impl.CreateBatch(ctx, []*domain.ShortURL{
+		{ShortCode: "first", OriginalURL: "http://first.com", ExpireTime: 1, CreatedTime: 1},
+		{ShortCode: "taken", OriginalURL: "http://taken.com", ExpireTime: 1, CreatedTime: 1},
+		{ShortCode: "second", OriginalURL: "http://second.com", ExpireTime: 1, CreatedTime: 1, RedirectStatus: 301},
+		{ShortCode: "first", OriginalURL: "http://again.com", ExpireTime: 1, CreatedTime: 1},
+	})
+	ts.Require().NoError(err)
+	ts.Require().Equal([]error{nil, domain.ErrShortURLConflict, nil, domain.ErrShortURLConflict}, errs)
+
+	got, err := ts.impl.Get(ctx, "first")
+	ts.Require().NoError(err)
+	ts.Require().Equal("http://first.com", got.OriginalURL)
+	got, err = ts.impl.Get(ctx, "second")
+	ts.Require().NoError(err)
+	ts.Require().Equal(301, got.RedirectStatus)
+	got, err = ts.impl.Get(ctx, "taken")
+	ts.Require().NoError(err)
+	ts.Require().Equal("http://test.com", got.OriginalURL)
+
+	// an invalid short url fails the whole batch
+	_, err = ts.impl.CreateBatch(ctx, []*domain.ShortURL{{ShortCode: "invalid", OriginalURL: "", ExpireTime: 1, CreatedTime: 1}})
+	ts.Require().Error(err)
+
+	// even when it is in a later statement than the rows before it, which are rolled back
+	shorts := make([]*domain.ShortURL, 5001)
+	for i := range shorts {
+		shorts[i] = &domain.ShortURL{ShortCode: fmt.Sprintf("chunk%d", i), OriginalURL: "http://chunk.com", ExpireTime: 1, CreatedTime: 1}
+	}
+	shorts[len(shorts)-1].OriginalURL = ""
+	_, err = ts.impl.CreateBatch(ctx, shorts)
+	ts.Require().Error(err)
+	_, err = ts.impl.Get(ctx, "chunk0")
+	ts.Require().ErrorIs(err, domain.ErrShortURLNotFound)
+}
+
+func (ts *TestSuite) TestUpdate() {
+	ctx := context.Background()
+	short := &domain.ShortURL{
+		ShortCode:   "test",
+		OriginalURL: "http://test.com",
+		ExpireTime:  1,
+		CreatedTime: 1,
+	}
+	_, err := ts.impl.Create(ctx, short)
+	ts.Require().NoError(err)
+
+	// apply gets the stored row
+	updated, err := ts.impl.Update(ctx, short.ShortCode, func(locked *domain.ShortURL) error {
+		ts.Require().Equal(short, locked)
+		locked.OriginalURL = "http://fixed.com"
+		locked.ExpireTime = 2
+		locked.RedirectStatus = 308
+		locked.Untrusted = true
+		return nil
+	})
+	ts.Require().NoError(err)
+	ts.Require().Equal("http://fixed.com", updated.OriginalURL)
+
+	got, err := ts.impl.Get(ctx, short.ShortCode)
+	ts.Require().NoError(err)
+	ts.Require().Equal("http://fixed.com", got.OriginalURL)
+	ts.Require().Equal(uint64(2), got.ExpireTime)
+	ts.Require().Equal(308, got.RedirectStatus)
+	ts.Require().True(got.Untrusted)
+
+	// the previous destination is kept in the history
+	var history []domain.ShortURL
+	err = ts.dbConnection.SelectContext(ctx, &history, `SELECT short_code, original_url, expire_time FROM short_url_history WHERE short_code = $1`, short.ShortCode)
+	ts.Require().NoError(err)
+	ts.Require().Len(history, 1)
+	ts.Require().Equal("http://test.com", history[0].OriginalURL)
+	ts.Require().Equal(uint64(1), history[0].ExpireTime)
+
+	// a change apply refuses is not saved
+	_, err = ts.impl.Update(ctx, short.ShortCode, func(locked *domain.ShortURL) error {
+		locked.OriginalURL = "http://refused.com"
+		return domain.ErrShortURLInvalid
+	})
+	ts.Require().ErrorIs(err, domain.ErrShortURLInvalid)
+	got, err = ts.impl.Get(ctx, short.ShortCode)
+	ts.Require().NoError(err)
+	ts.Require().Equal("http://fixed.com", got.OriginalURL)
+
+	_, err = ts.impl.Update(ctx, "invalid", func(locked *domain.ShortURL) error { return nil })
+	ts.Require().ErrorIs(err, domain.ErrShortURLNotFound)
+}
+
+func (ts *TestSuite) TestDelete() {
+	ctx := context.Background()
+	short := &domain.ShortURL{
+		ShortCode:   "test",
+		OriginalURL: "http://test.com",
+		ExpireTime:  1,
+		CreatedTime: 1,
+	}
+	_, err := ts.impl.Create(ctx, short)
+	ts.Require().NoError(err)
+
+	ts.Require().NoError(ts.impl.Delete(ctx, short.ShortCode))
+	_, err = ts.impl.Get(ctx, short.ShortCode)
+	ts.Require().ErrorIs(err, domain.ErrShortURLNotFound)
+
+	ts.Require().ErrorIs(ts.impl.Delete(ctx, short.ShortCode), domain.ErrShortURLNotFound)
+}
+
+func (ts *TestSuite) TestDisable() {
+	ctx := context.Background()
+	short := &domain.ShortURL{
+		ShortCode:   "test",
+		OriginalURL: "http://test.com",
+		ExpireTime:  1,
+		CreatedTime: 1,
+	}
+	_, err := ts.impl.Create(ctx, short)
+	ts.Require().NoError(err)
+
+	ts.Require().NoError(ts.impl.Disable(ctx, short.ShortCode))
+	got, err := ts.impl.Get(ctx, short.ShortCode)
+	ts.Require().NoError(err)
+	ts.Require().True(got.Disabled)
+
+	ts.Require().ErrorIs(ts.impl.Disable(ctx, "invalid"), domain.ErrShortURLNotFound)
+}
+
+func (ts *TestSuite) TestFindDuplicate() {
+	ctx := context.Background()
+	shorts := []*domain.ShortURL{
+		{ShortCode: "old", OriginalURL: "http://test.com", ExpireTime: 100, CreatedTime: 1, URLHash: "hash"},
+		{ShortCode: "new", OriginalURL: "http://test.com", ExpireTime: 100, CreatedTime: 2, URLHash: "hash"},
+		{ShortCode: "expired", OriginalURL: "http://test.com", ExpireTime: 10, CreatedTime: 3, URLHash: "hash"},
+		{ShortCode: "disabled", OriginalURL: "http://test.com", ExpireTime: 100, CreatedTime: 4, URLHash: "hash"},
+		{ShortCode: "permanent", OriginalURL: "http://test.com", ExpireTime: 100, CreatedTime: 5, URLHash: "hash", RedirectStatus: 301},
+		{ShortCode: "nohash", OriginalURL: "http://test.com", ExpireTime: 100, CreatedTime: 6},
+	}
+	for _, short := range shorts {
+		_, err := ts.impl.Create(ctx, short)
+		ts.Require().NoError(err)
+	}
+	ts.Require().NoError(ts.impl.Disable(ctx, "disabled"))
+
+	// the newest short url which redirects alike and is neither expired nor disabled
+	got, err := ts.impl.FindDuplicate(ctx, &domain.ShortURL{URLHash: "hash", CreatedTime: 50, ExpireTime: 80})
+	ts.Require().NoError(err)
+	ts.Require().Equal("new", got.ShortCode)
+
+	got, err = ts.impl.FindDuplicate(ctx, &domain.ShortURL{URLHash: "hash", CreatedTime: 50, ExpireTime: 100, RedirectStatus: 301})
+	ts.Require().NoError(err)
+	ts.Require().Equal("permanent", got.ShortCode)
+
+	_, err = ts.impl.FindDuplicate(ctx, &domain.ShortURL{URLHash: "hash", CreatedTime: 50, ExpireTime: 80, Untrusted: true})
+	ts.Require().ErrorIs(err, domain.ErrShortURLNotFound)
+	_, err = ts.impl.FindDuplicate(ctx, &domain.ShortURL{URLHash: "hash", CreatedTime: 100, ExpireTime: 100})
+	ts.Require().ErrorIs(err, domain.ErrShortURLNotFound)
+	_, err = ts.impl.FindDuplicate(ctx, &domain.ShortURL{URLHash: "", CreatedTime: 50, ExpireTime: 80})
+	ts.Require().ErrorIs(err, domain.ErrShortURLNotFound)
+	// a short url expiring before the requested expiry would cut the link short
+	_, err = ts.impl.FindDuplicate(ctx, &domain.ShortURL{URLHash: "hash", CreatedTime: 50, ExpireTime: 101})
+	ts.Require().ErrorIs(err, domain.ErrShortURLNotFound)
+}
+
+func (ts *TestSuite) TestCreateOrFindDuplicate() {
+	ctx := context.Background()
+	// creates of the same url racing each other share one short url
+	const creates = 10
+	codes := make(chan string, creates)
+	var wg sync.WaitGroup
+	for i := 0; i < creates; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := ts.impl.CreateOrFindDuplicate(ctx, &domain.ShortURL{
+				ShortCode: fmt.Sprintf("race%d", i), OriginalURL: "http://race.com", ExpireTime: 100, CreatedTime: 1, URLHash: "race",
+			})
+			ts.NoError(err)
+			if got != nil {
+				codes <- got.ShortCode
+			}
+		}()
+	}
+	wg.Wait()
+	close(codes)
+	shortCodes := map[string]bool{}
+	for code := range codes {
+		shortCodes[code] = true
+	}
+	ts.Require().Len(shortCodes, 1)
+
+	// a taken short code is still a conflict
+	_, err := ts.impl.Create(ctx, &domain.ShortURL{ShortCode: "taken", OriginalURL: "http://test.com", ExpireTime: 100, CreatedTime: 1})
+	ts.Require().NoError(err)
+	_, err = ts.impl.CreateOrFindDuplicate(ctx, &domain.ShortURL{ShortCode: "taken", OriginalURL: "http://other.com", ExpireTime: 100, CreatedTime: 1, URLHash: "other"})
+	ts.Require().ErrorIs(err, domain.ErrShortURLConflict)
+}
+
+func (ts *TestSuite) TestScanShortCodes() {
+	ctx := context.Background()
+	for i, code := range []string{"old", "new1", "new2"} {
+		_, err := ts.impl.Create(ctx, &domain.ShortURL{
+			ShortCode:   code,
+			OriginalURL: "http://test.com",
+			ExpireTime:  100,
+			CreatedTime: uint64(10 * (i + 1)),
+		})
+		ts.Require().NoError(err)
+	}
+
+	var all []string
+	err := ts.impl.ScanShortCodes(ctx, 0, func(shortCodes []string) error {
+		all = append(all, shortCodes...)
+		return nil
+	})
+	ts.Require().NoError(err)
+	ts.Require().Equal([]string{"old", "new1", "new2"}, all)
+
+	var recent []string
+	err = ts.impl.ScanShortCodes(ctx, 20, func(shortCodes []string) error {
+		recent = append(recent, shortCodes...)
+		return nil
+	})
+	ts.Require().NoError(err)
+	ts.Require().Equal([]string{"new1", "new2"}, recent)
+}
+
 func TestShortURLSuite(t *testing.T) {
 	ts := new(TestSuite)
 	suite.Run(t, ts)
@@ -7,14 +7,55 @@ import (
 )
 
 type MockShortURLRepository struct {
-	CreateFunc func(ctx context.Context, short *domain.ShortURL) (*domain.ShortURL, error)
-	GetFunc    func(ctx context.Context, shortCode string) (*domain.ShortURL, error)
+	CreateFunc                func(ctx context.Context, short *domain.ShortURL) (*domain.ShortURL, error)
+	CreateBatchFunc           func(ctx context.Context, shorts []*domain.ShortURL) ([]error, error)
+	GetFunc                   func(ctx context.Context, shortCode string) (*domain.ShortURL, error)
+	GetManyFunc               func(ctx context.Context, shortCodes []string) ([]*domain.ShortURL, error)
+	FindDuplicateFunc         func(ctx context.Context, short *domain.ShortURL) (*domain.ShortURL, error)
+	CreateOrFindDuplicateFunc func(ctx context.Context, short *domain.ShortURL) (*domain.ShortURL, error)
+	UpdateFunc                func(ctx context.Context, shortCode string, apply func(short *domain.ShortURL) error) (*domain.ShortURL, error)
+	DeleteFunc                func(ctx context.Context, shortCode string) error
+	DisableFunc               func(ctx context.Context, shortCode string) error
+
+	ScanShortCodesFunc func(ctx context.Context, createdSince uint64, fn func(shortCodes []string) error) error
 }
 
 func (m *MockShortURLRepository) Create(ctx context.Context, short *domain.ShortURL) (*domain.ShortURL, error) {
 	return m.CreateFunc(ctx, short)
 }
 
+func (m *MockShortURLRepository) CreateBatch(ctx context.Context, shorts []*domain.ShortURL) ([]error, error) {
+	return m.CreateBatchFunc(ctx, shorts)
+}
+
 func (m *MockShortURLRepository) Get(ctx context.Context, shortCode string) (*domain.ShortURL, error) {
 	return m.GetFunc(ctx, shortCode)
 }
+
+func (m *MockShortURLRepository) GetMany(ctx context.Context, shortCodes []string) ([]*domain.ShortURL, error) {
+	return m.GetManyFunc(ctx, shortCodes)
+}
+
+func (m *MockShortURLRepository) FindDuplicate(ctx context.Context, short *domain.ShortURL) (*domain.ShortURL, error) {
+	return m.FindDuplicateFunc(ctx, short)
+}
+
+func (m *MockShortURLRepository) CreateOrFindDuplicate(ctx context.Context, short *domain.ShortURL) (*domain.ShortURL, error) {
+	return m.CreateOrFindDuplicateFunc(ctx, short)
+}
+
+func (m *MockShortURLRepository) Update(ctx context.Context, shortCode string, apply func(short *domain.ShortURL) error) (*domain.ShortURL, error) {
+	return m.UpdateFunc(ctx, shortCode, apply)
+}
+
+func (m *MockShortURLRepository) Delete(ctx context.Context, shortCode string) error {
+	return m.DeleteFunc(ctx, shortCode)
+}
+
+func (m *MockShortURLRepository) Disable(ctx context.Context, shortCode string) error {
+	return m.DisableFunc(ctx, shortCode)
+}
+
+func (m *MockShortURLRepository) ScanShortCodes(ctx context.Context, createdSince uint64, fn func(shortCodes []string) error) error {
+	return m.ScanShortCodesFunc(ctx, createdSince, fn)
+}
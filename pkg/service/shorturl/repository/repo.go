@@ -9,5 +9,23 @@ import (
 // Repository is a repository for shorturl
 type Repository interface {
 	Create(ctx context.Context, short *domain.ShortURL) (*domain.ShortURL, error)
+	// CreateBatch inserts shorts in one transaction and returns an error for each of them,
+	// ErrShortURLConflict when its short code is taken and nil when it was created. Nothing is inserted when it fails.
+	CreateBatch(ctx context.Context, shorts []*domain.ShortURL) ([]error, error)
 	Get(ctx context.Context, shortCode string) (*domain.ShortURL, error)
+	// GetMany returns the short urls of shortCodes in one query, codes which do not exist are left out
+	GetMany(ctx context.Context, shortCodes []string) ([]*domain.ShortURL, error)
+	// FindDuplicate returns the newest short url with the URLHash, redirect status and trust of short which is
+	// neither disabled nor expired at its CreatedTime and lives until its ExpireTime, ErrShortURLNotFound when there is none
+	FindDuplicate(ctx context.Context, short *domain.ShortURL) (*domain.ShortURL, error)
+	// CreateOrFindDuplicate returns the short url FindDuplicate would, or inserts short and returns it when there is none.
+	// Calls with the same URLHash run one at a time, so they never insert two duplicates.
+	CreateOrFindDuplicate(ctx context.Context, short *domain.ShortURL) (*domain.ShortURL, error)
+	// Update locks the short url and passes it to apply, which changes and validates it in place, then saves it
+	// and records the previous destination and expiry in the history. Nothing is saved when apply fails.
+	Update(ctx context.Context, shortCode string, apply func(short *domain.ShortURL) error) (*domain.ShortURL, error)
+	Delete(ctx context.Context, shortCode string) error
+	Disable(ctx context.Context, shortCode string) error
+	// ScanShortCodes passes the short codes created since createdSince to fn, in batches ordered by insertion
+	ScanShortCodes(ctx context.Context, createdSince uint64, fn func(shortCodes []string) error) error
 }
@@ -1,41 +1,49 @@
 package shorturl
 
 import (
+	"context"
 	"time"
 
 	"github.com/jmoiron/sqlx"
-	"github.com/redis/rueidis"
-	"github.com/redis/rueidis/rueidislock"
 
 	"github.com/sappy5678/dcard/pkg/domain"
 	"github.com/sappy5678/dcard/pkg/service/shorturl/cache"
-	"github.com/sappy5678/dcard/pkg/service/shorturl/repository"
+	"github.com/sappy5678/dcard/pkg/service/shorturl/click"
 	"github.com/sappy5678/dcard/pkg/service/shorturl/shortcode"
 )
 
 type shorturlService struct {
 	domain.ShortURLService
 	shortcodeGenerator shortcode.Repository
+	maxMachineID       uint64 // highest machine id of generated short codes, aliases must not look like them
 	repo               cache.Repository
+	clicks             click.Repository
+	stats              click.StatsRepository
 	host               string // should get from central config service
 	now                func() uint64
 }
 
-func New(host string, now func() uint64, shortcodeGenerator shortcode.Repository, repo cache.Repository) domain.ShortURLService {
+func New(host string, now func() uint64, shortcodeGenerator shortcode.Repository, maxMachineID uint64, repo cache.Repository, clicks click.Repository, stats click.StatsRepository) domain.ShortURLService {
 	return &shorturlService{
 		shortcodeGenerator: shortcodeGenerator,
+		maxMachineID:       maxMachineID,
 		repo:               repo,
+		clicks:             clicks,
+		stats:              stats,
 		host:               host,
 		now:                now,
 	}
 }
 
-func Initialize(machineID uint64, host string, db *sqlx.DB, redis rueidis.Client, locker rueidislock.Locker) domain.ShortURLService {
-	shortcodeGenerator := shortcode.New(machineID)
-	cacheRepo := cache.New(repository.New(db), redis, locker)
+func Initialize(machineID shortcode.MachineID, maxMachineID uint64, host string, db *sqlx.DB, cacheRepo cache.Repository, clicks click.Repository) (domain.ShortURLService, error) {
+	shortcodeGenerator := shortcode.New(machineID, shortcode.NewCounterStore(db), shortcode.DefaultBlockSize)
+	// without the bloom filter every short url is reported as not found
+	if _, err := cacheRepo.EnsureBloomFilter(context.Background()); err != nil {
+		return nil, err
+	}
 	now := func() uint64 {
 		now := time.Now().Unix()
 		return uint64(now)
 	}
-	return New(host, now, shortcodeGenerator, cacheRepo)
+	return New(host, now, shortcodeGenerator, maxMachineID, cacheRepo, clicks, click.NewStatsRepository(db)), nil
 }
@@ -0,0 +1,79 @@
+package shortcode
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sappy5678/dcard/pkg/domain"
+)
+
+const (
+	aliasMinLength = 3
+	aliasMaxLength = 20 // short_url.short_code is VARCHAR(20)
+	aliasChars     = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz-_"
+)
+
+// reservedAliases are first path segments already routed by the server, and "top" which GET /api/v1/urls/top would shadow
+var reservedAliases = map[string]bool{
+	"api":    true,
+	"health": true,
+	"debug":  true,
+	"top":    true,
+}
+
+// ValidateAlias checks a custom short code can be served without clashing with routes or generated codes.
+// maxMachineID is the highest machine id generated codes may carry.
+func ValidateAlias(alias string, maxMachineID uint64) error {
+	if len(alias) < aliasMinLength || len(alias) > aliasMaxLength {
+		return fmt.Errorf("%w: length must be between %d and %d", domain.ErrAliasInvalid, aliasMinLength, aliasMaxLength)
+	}
+	for i := 0; i < len(alias); i++ {
+		if strings.IndexByte(aliasChars, alias[i]) < 0 {
+			return fmt.Errorf("%w: only letters, digits, '-' and '_' are allowed", domain.ErrAliasInvalid)
+		}
+	}
+	if reservedAliases[strings.ToLower(alias)] {
+		return fmt.Errorf("%w: %s is reserved", domain.ErrAliasInvalid, alias)
+	}
+	if isGenerated(alias, maxMachineID) {
+		return fmt.Errorf("%w: %s may be generated by the server", domain.ErrAliasInvalid, alias)
+	}
+	return nil
+}
+
+// isGenerated reports whether code is a {machineID}-{AutoIncrID} code NextID may produce:
+// a machine id from 1 to maxMachineID and a counter, both base57 encoded without leading zeros
+func isGenerated(code string, maxMachineID uint64) bool {
+	machinePart, counterPart, found := strings.Cut(code, "-")
+	if !found || !isMachineID(machinePart, maxMachineID) {
+		return false
+	}
+	if counterPart == "" || counterPart[0] == base57Chars[0] {
+		return false
+	}
+	for i := 0; i < len(counterPart); i++ {
+		if _, exists := base57Map[counterPart[i]]; !exists {
+			return false
+		}
+	}
+	return true
+}
+
+// isMachineID reports whether part encodes a machine id from 1 to maxMachineID
+func isMachineID(part string, maxMachineID uint64) bool {
+	if part == "" || part[0] == base57Chars[0] {
+		return false
+	}
+	var id uint64
+	for i := 0; i < len(part); i++ {
+		digit, exists := base57Map[part[i]]
+		if !exists {
+			return false
+		}
+		id = id*uint64(len(base57Chars)) + digit
+		if id > maxMachineID {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,47 @@
+package shortcode
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sappy5678/dcard/pkg/domain"
+)
+
+func TestValidateAlias(t *testing.T) {
+	tests := []struct {
+		name    string
+		alias   string
+		wantErr bool
+	}{
+		{name: "normal", alias: "spring-sale"},
+		{name: "underscore and digits", alias: "sale_2025"},
+		{name: "too short", alias: "ab", wantErr: true},
+		{name: "too long", alias: "this-alias-is-far-too-long", wantErr: true},
+		{name: "invalid character", alias: "spring/sale", wantErr: true},
+		{name: "non ascii", alias: "特價活動", wantErr: true},
+		{name: "reserved", alias: "api", wantErr: true},
+		{name: "reserved ignoring case", alias: "Health", wantErr: true},
+		{name: "reserved by the leaderboard", alias: "top", wantErr: true},
+		{name: "generated shape", alias: "3-5ob", wantErr: true},
+		{name: "generated shape up to the max machine id", alias: "Ab-cd", wantErr: true},
+		{name: "hyphen outside base57", alias: "sale-2025"},
+		{name: "vanity words in base57", alias: "new-year"},
+		{name: "longer vanity words in base57", alias: "summer-camp"},
+		{name: "machine part above the max machine id", alias: "zz-cd"},
+		{name: "machine part with a leading zero", alias: "23-5ob"},
+		{name: "machine id 0", alias: "2-5ob"},
+		{name: "counter with a leading zero", alias: "3-25ob"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateAlias(tt.alias, 1024)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, domain.ErrAliasInvalid)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
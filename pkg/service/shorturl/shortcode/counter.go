@@ -0,0 +1,31 @@
+package shortcode
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type counterStore struct {
+	db *sqlx.DB
+}
+
+// NewCounterStore returns a CounterStore backed by the shortcode_counter table
+func NewCounterStore(db *sqlx.DB) CounterStore {
+	return &counterStore{
+		db: db,
+	}
+}
+
+// the upsert is atomic, so concurrent generators of the same machine always get disjoint blocks
+const leaseQuery = `INSERT INTO shortcode_counter (machine_id, next_value) VALUES ($1, $2)
+ON CONFLICT (machine_id) DO UPDATE SET next_value = shortcode_counter.next_value + EXCLUDED.next_value
+RETURNING next_value`
+
+func (s *counterStore) Lease(ctx context.Context, machineID uint64, size uint64) (uint64, error) {
+	var ceiling uint64
+	if err := s.db.GetContext(ctx, &ceiling, leaseQuery, machineID, size); err != nil {
+		return 0, err
+	}
+	return ceiling, nil
+}
@@ -1,9 +1,13 @@
 package shortcode
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"math"
-	"sync/atomic"
+	"sync"
+
+	"github.com/sappy5678/dcard/pkg/domain"
 )
 
 // base57, ignore 0, 1, I, O, l
@@ -18,25 +22,63 @@ func init() {
 	}
 }
 
+// DefaultBlockSize is how many counter values a generator leases at once
+const DefaultBlockSize = 1000
+
 type impl struct {
-	machineID uint64
-	counter   uint64
+	machineID MachineID
+	store     CounterStore
+	blockSize uint64
+
+	mu       sync.Mutex
+	leasedID uint64 // machine id the block was leased for
+	counter  uint64 // last issued value
+	ceiling  uint64 // last value of the leased block
 }
 
 // New returns a new Repository
-func New(machineID uint64) Repository {
+func New(machineID MachineID, store CounterStore, blockSize uint64) Repository {
+	if blockSize == 0 {
+		blockSize = DefaultBlockSize
+	}
 	return &impl{
 		machineID: machineID,
-		counter:   0,
+		store:     store,
+		blockSize: blockSize,
 	}
 }
 
 // NextID returns a new short code
-func (im *impl) NextID() string {
-	machineID := im.encodeID(im.machineID)
-	newCounter := atomic.AddUint64(&im.counter, 1)
-	counterID := im.encodeID(newCounter)
-	return machineID + "-" + counterID
+func (im *impl) NextID(ctx context.Context) (string, error) {
+	machineID, err := im.machineID.MachineID()
+	if err != nil {
+		// without a machine id we may collide with another node, so refuse to issue codes
+		return "", fmt.Errorf("%w: %v", domain.ErrShortURLUnavailable, err)
+	}
+	newCounter, err := im.nextCounter(ctx, machineID)
+	if err != nil {
+		return "", err
+	}
+	return im.encodeID(machineID) + "-" + im.encodeID(newCounter), nil
+}
+
+// nextCounter hands out values from the leased block, leasing a new one once it is used up.
+// Values left in a block when the process stops are skipped, never reissued.
+func (im *impl) nextCounter(ctx context.Context, machineID uint64) (uint64, error) {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	if im.counter >= im.ceiling || im.leasedID != machineID {
+		ceiling, err := im.store.Lease(ctx, machineID, im.blockSize)
+		if err != nil {
+			return 0, err
+		}
+		im.leasedID = machineID
+		im.counter = ceiling - im.blockSize
+		im.ceiling = ceiling
+	}
+	im.counter++
+	return im.counter, nil
 }
 
 func (im *impl) encodeID(n uint64) string {
@@ -1,18 +1,39 @@
 package shortcode
 
 import (
+	"context"
+	"errors"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/suite"
+
+	"github.com/sappy5678/dcard/pkg/domain"
+	"github.com/sappy5678/dcard/pkg/utl/machineid"
 )
 
+// newMemoryCounterStore returns a CounterStore that keeps its counters in memory,
+// it outlives the generators using it just like the database does
+func newMemoryCounterStore() *MockCounterStore {
+	var mu sync.Mutex
+	counters := map[uint64]uint64{}
+	return &MockCounterStore{
+		LeaseFunc: func(ctx context.Context, machineID uint64, size uint64) (uint64, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			counters[machineID] += size
+			return counters[machineID], nil
+		},
+	}
+}
+
 type TestSuite struct {
 	suite.Suite
 	impl *impl
 }
 
 func (ts *TestSuite) SetupSuite() {
-	ts.impl = New(1).(*impl)
+	ts.impl = New(machineid.Static(1), newMemoryCounterStore(), 2).(*impl)
 }
 
 func (ts *TestSuite) TestEncodeID() {
@@ -73,13 +94,95 @@ func (ts *TestSuite) TestNextID() {
 
 	for _, tc := range tests {
 		ts.Run(tc.name, func() {
-			got := ts.impl.NextID()
+			got, err := ts.impl.NextID(context.Background())
+			ts.Require().NoError(err)
 			ts.Require().NotEmpty(got)
 			ts.Require().Equal(tc.want, got)
 		})
 	}
 }
 
+func (ts *TestSuite) TestNextID_Restart() {
+	ctx := context.Background()
+	store := newMemoryCounterStore()
+	seen := map[string]bool{}
+
+	// every generator simulates a process start, abandoning the rest of its block
+	for restart := 0; restart < 5; restart++ {
+		gen := New(machineid.Static(1), store, 10)
+		for i := 0; i < 7; i++ {
+			got, err := gen.NextID(ctx)
+			ts.Require().NoError(err)
+			ts.Require().False(seen[got], "duplicate short code %s", got)
+			seen[got] = true
+		}
+	}
+}
+
+func (ts *TestSuite) TestNextID_ConcurrentGenerators() {
+	ctx := context.Background()
+	store := newMemoryCounterStore()
+	results := make(chan string, 4*100)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		gen := New(machineid.Static(1), store, 3)
+		for w := 0; w < 2; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 50; i++ {
+					got, err := gen.NextID(ctx)
+					if err != nil {
+						return
+					}
+					results <- got
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	close(results)
+
+	seen := map[string]bool{}
+	for got := range results {
+		ts.Require().False(seen[got], "duplicate short code %s", got)
+		seen[got] = true
+	}
+	ts.Require().Len(seen, 4*100)
+}
+
+func (ts *TestSuite) TestNextID_LeaseFailure() {
+	gen := New(machineid.Static(1), &MockCounterStore{
+		LeaseFunc: func(ctx context.Context, machineID uint64, size uint64) (uint64, error) {
+			return 0, errors.New("database error")
+		},
+	}, 10)
+
+	got, err := gen.NextID(context.Background())
+	ts.Require().ErrorContains(err, "database error")
+	ts.Require().Empty(got)
+}
+
+type lostMachineID struct{}
+
+func (lostMachineID) MachineID() (uint64, error) {
+	return 0, machineid.ErrLeaseLost
+}
+
+func (ts *TestSuite) TestNextID_MachineIDLost() {
+	gen := New(lostMachineID{}, &MockCounterStore{
+		LeaseFunc: func(ctx context.Context, machineID uint64, size uint64) (uint64, error) {
+			ts.Fail("should not be called")
+			return 0, nil
+		},
+	}, 10)
+
+	got, err := gen.NextID(context.Background())
+	ts.Require().ErrorIs(err, domain.ErrShortURLUnavailable)
+	ts.Require().Empty(got)
+}
+
 func TestShortCodeIDSuite(t *testing.T) {
 	ts := new(TestSuite)
 	suite.Run(t, ts)
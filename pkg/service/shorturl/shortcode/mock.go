@@ -1,9 +1,19 @@
 package shortcode
 
+import "context"
+
 type MockShortCodeIDRepository struct {
-	NextIDFunc func() string
+	NextIDFunc func(ctx context.Context) (string, error)
+}
+
+func (m *MockShortCodeIDRepository) NextID(ctx context.Context) (string, error) {
+	return m.NextIDFunc(ctx)
+}
+
+type MockCounterStore struct {
+	LeaseFunc func(ctx context.Context, machineID uint64, size uint64) (uint64, error)
 }
 
-func (m *MockShortCodeIDRepository) NextID() string {
-	return m.NextIDFunc()
+func (m *MockCounterStore) Lease(ctx context.Context, machineID uint64, size uint64) (uint64, error) {
+	return m.LeaseFunc(ctx, machineID, size)
 }
@@ -1,5 +1,18 @@
 package shortcode
 
+import "context"
+
 type Repository interface {
-	NextID() string
+	NextID(ctx context.Context) (string, error)
+}
+
+// MachineID provides the machine id every short code is prefixed with
+type MachineID interface {
+	MachineID() (uint64, error)
+}
+
+// CounterStore leases blocks of counter values so a restarted generator never reissues a code
+type CounterStore interface {
+	// Lease reserves the next size counter values of machineID and returns the highest of them
+	Lease(ctx context.Context, machineID uint64, size uint64) (uint64, error)
 }
@@ -2,42 +2,499 @@ package shorturl
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 
+	"github.com/google/uuid"
+
 	"github.com/sappy5678/dcard/pkg/domain"
+	"github.com/sappy5678/dcard/pkg/service/shorturl/click"
+	"github.com/sappy5678/dcard/pkg/service/shorturl/shortcode"
 )
 
 func (im *shorturlService) getShortURL(shortCode string) string {
 	return fmt.Sprintf("%s/%s", im.host, shortCode)
 }
 
-func (im *shorturlService) Create(ctx context.Context, originalURL string, expireTime uint64) (*domain.ShortURL, error) {
-	shortCode := im.shortcodeGenerator.NextID()
+func (im *shorturlService) Create(ctx context.Context, req *domain.ShortURLCreate) (*domain.ShortURL, error) {
+	if req.IdempotencyKey == "" {
+		return im.create(ctx, req)
+	}
+
+	hash, err := idempotencyHash(req)
+	if err != nil {
+		return nil, err
+	}
+	token := uuid.NewString()
+	shortURL, err := im.repo.ReserveIdempotencyKey(ctx, req.IdempotencyKey, hash, token)
+	if err != nil || shortURL != nil {
+		return shortURL, err
+	}
+	shortURL, err = im.create(ctx, req)
+	if err != nil {
+		// failures are not remembered, a retry runs the request again
+		return nil, errors.Join(err, im.repo.ReleaseIdempotencyKey(ctx, req.IdempotencyKey, token))
+	}
+	// the short url exists, failing the request now would only make the client retry into a duplicate
+	_ = im.repo.SaveIdempotencyKey(ctx, req.IdempotencyKey, hash, shortURL)
+	return shortURL, nil
+}
+
+// idempotencyHash identifies the fields of a create request, a key reused with other fields is refused
+func idempotencyHash(req *domain.ShortURLCreate) (string, error) {
+	fields := *req
+	fields.IdempotencyKey = ""
+	body, err := json.Marshal(fields)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func (im *shorturlService) create(ctx context.Context, req *domain.ShortURLCreate) (*domain.ShortURL, error) {
+	dedupe := req.Dedupe && req.Alias == ""
+	if dedupe {
+		// most duplicates are found without a lock or spending a short code
+		shortURL, err := im.findDuplicate(ctx, req)
+		if !errors.Is(err, domain.ErrShortURLNotFound) {
+			return shortURL, err
+		}
+	}
+	shortURL, err := im.newShortURL(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if dedupe {
+		// a create of the same url may have raced the lookup, it is looked for again under the lock of the hash
+		shortURL, err = im.repo.CreateOrFindDuplicate(ctx, shortURL)
+		if err != nil {
+			return nil, err
+		}
+		shortURL.ShortURL = im.getShortURL(shortURL.ShortCode)
+		return shortURL, nil
+	}
+	shortURL, err = im.repo.Create(ctx, shortURL)
+	if err != nil {
+		return nil, err
+	}
+	return shortURL, nil
+}
+
+func (im *shorturlService) CreateBatch(ctx context.Context, reqs []*domain.ShortURLCreate) ([]*domain.ShortURLBatchResult, error) {
+	results := make([]*domain.ShortURLBatchResult, len(reqs))
+	token := uuid.NewString()
+	reserved, err := im.reserveBatch(ctx, reqs, results, token)
+	if err != nil {
+		return nil, err
+	}
+	if err := im.createBatch(ctx, reqs, results); err != nil {
+		if len(reserved.keys) > 0 {
+			// failures are not remembered, a retry runs the batch again
+			err = errors.Join(err, im.repo.ReleaseIdempotencyKeys(ctx, reserved.keys, token))
+		}
+		return nil, err
+	}
+	if len(reserved.keys) == 0 {
+		return results, nil
+	}
+
+	var saved, released batchKeys
+	var shortURLs []*domain.ShortURL
+	for n, i := range reserved.indexes {
+		if results[i].Err != nil {
+			released.add(i, reserved.keys[n], reserved.hashes[n])
+			continue
+		}
+		saved.add(i, reserved.keys[n], reserved.hashes[n])
+		shortURLs = append(shortURLs, results[i].ShortURL)
+	}
+	// like in Create, the short urls exist and a key left pending just runs out
+	if len(saved.keys) > 0 {
+		_ = im.repo.SaveIdempotencyKeys(ctx, saved.keys, saved.hashes, shortURLs)
+	}
+	if len(released.keys) > 0 {
+		_ = im.repo.ReleaseIdempotencyKeys(ctx, released.keys, token)
+	}
+	return results, nil
+}
+
+// batchKeys are idempotency keys of a batch with their hashes and the index of their request
+type batchKeys struct {
+	indexes []int
+	keys    []string
+	hashes  []string
+}
+
+func (b *batchKeys) add(index int, key, hash string) {
+	b.indexes = append(b.indexes, index)
+	b.keys = append(b.keys, key)
+	b.hashes = append(b.hashes, hash)
+}
+
+// reserveBatch reserves the idempotency keys of reqs at once. The result of a request whose key was
+// used before is set to the earlier short url or the error of the key, the reserved keys are returned.
+func (im *shorturlService) reserveBatch(ctx context.Context, reqs []*domain.ShortURLCreate, results []*domain.ShortURLBatchResult, token string) (batchKeys, error) {
+	var keyed batchKeys
+	for i, req := range reqs {
+		if req.IdempotencyKey == "" {
+			continue
+		}
+		hash, err := idempotencyHash(req)
+		if err != nil {
+			return batchKeys{}, err
+		}
+		keyed.add(i, req.IdempotencyKey, hash)
+	}
+	if len(keyed.keys) == 0 {
+		return keyed, nil
+	}
+
+	shortURLs, errs, err := im.repo.ReserveIdempotencyKeys(ctx, keyed.keys, keyed.hashes, token)
+	if err != nil {
+		return batchKeys{}, err
+	}
+	var reserved batchKeys
+	for n, i := range keyed.indexes {
+		switch {
+		case errs[n] != nil:
+			results[i] = &domain.ShortURLBatchResult{Err: errs[n]}
+		case shortURLs[n] != nil:
+			results[i] = &domain.ShortURLBatchResult{ShortURL: shortURLs[n]}
+		default:
+			reserved.add(i, keyed.keys[n], keyed.hashes[n])
+		}
+	}
+	return reserved, nil
+}
+
+// createBatch creates the requests which have no result yet and sets their results
+func (im *shorturlService) createBatch(ctx context.Context, reqs []*domain.ShortURLCreate, results []*domain.ShortURLBatchResult) error {
+	shortURLs := make([]*domain.ShortURL, 0, len(reqs))
+	// index in reqs of every short url in shortURLs
+	indexes := make([]int, 0, len(reqs))
+	for i, req := range reqs {
+		if results[i] != nil {
+			continue
+		}
+		shortURL, err := im.newShortURL(ctx, req)
+		if err != nil {
+			results[i] = &domain.ShortURLBatchResult{Err: err}
+			continue
+		}
+		shortURLs = append(shortURLs, shortURL)
+		indexes = append(indexes, i)
+	}
+	if len(shortURLs) == 0 {
+		return nil
+	}
+
+	errs, err := im.repo.CreateBatch(ctx, shortURLs)
+	if err != nil {
+		return err
+	}
+	for j, i := range indexes {
+		if errs[j] != nil {
+			results[i] = &domain.ShortURLBatchResult{Err: errs[j]}
+			continue
+		}
+		results[i] = &domain.ShortURLBatchResult{ShortURL: shortURLs[j]}
+	}
+	return nil
+}
+
+// findDuplicate returns a short url which redirects like req would at least until its expiry, ErrShortURLNotFound when there is none
+func (im *shorturlService) findDuplicate(ctx context.Context, req *domain.ShortURLCreate) (*domain.ShortURL, error) {
+	shortURL, err := im.repo.FindDuplicate(ctx, &domain.ShortURL{
+		OriginalURL:    req.OriginalURL,
+		URLHash:        urlHash(req.OriginalURL),
+		ExpireTime:     req.ExpireTime,
+		CreatedTime:    im.now(),
+		RedirectStatus: req.RedirectStatus,
+		Untrusted:      req.Untrusted,
+	})
+	if err != nil {
+		return nil, err
+	}
+	shortURL.ShortURL = im.getShortURL(shortURL.ShortCode)
+	return shortURL, nil
+}
+
+// newShortURL builds and validates the short url of a create request
+func (im *shorturlService) newShortURL(ctx context.Context, req *domain.ShortURLCreate) (*domain.ShortURL, error) {
+	shortCode, err := im.nextShortCode(ctx, req.Alias)
+	if err != nil {
+		return nil, err
+	}
 	shortURL := &domain.ShortURL{
-		ShortCode:   shortCode,
-		OriginalURL: originalURL,
-		ShortURL:    im.getShortURL(shortCode),
-		ExpireTime:  expireTime,
-		CreatedTime: im.now(),
+		ShortCode:      shortCode,
+		OriginalURL:    req.OriginalURL,
+		ShortURL:       im.getShortURL(shortCode),
+		ExpireTime:     req.ExpireTime,
+		CreatedTime:    im.now(),
+		RedirectStatus: req.RedirectStatus,
+		Untrusted:      req.Untrusted,
+		URLHash:        urlHash(req.OriginalURL),
 	}
 	if !shortURL.IsValid(im.now()) {
 		return nil, domain.ErrShortURLInvalid
 	}
-	shortURL, err := im.repo.Create(ctx, shortURL)
+	return shortURL, nil
+}
+
+// nextShortCode returns the alias when the caller chose one, a generated code otherwise
+func (im *shorturlService) nextShortCode(ctx context.Context, alias string) (string, error) {
+	if alias == "" {
+		return im.shortcodeGenerator.NextID(ctx)
+	}
+	if err := shortcode.ValidateAlias(alias, im.maxMachineID); err != nil {
+		return "", err
+	}
+	return alias, nil
+}
+
+func (im *shorturlService) Get(ctx context.Context, shortCode string) (*domain.ShortURL, error) {
+	shortURL, err := im.repo.Get(ctx, shortCode)
 	if err != nil {
 		return nil, err
 	}
+	shortURL.ShortURL = im.getShortURL(shortCode)
+	if err := im.checkRedirect(shortURL); err != nil {
+		return nil, err
+	}
 	return shortURL, nil
 }
 
-func (im *shorturlService) Get(ctx context.Context, shortCode string) (*domain.ShortURL, error) {
+// checkRedirect returns ErrShortURLNotFound or ErrShortURLExpired when the short url no longer redirects
+func (im *shorturlService) checkRedirect(shortURL *domain.ShortURL) error {
+	if shortURL.Disabled {
+		return domain.ErrShortURLNotFound
+	}
+	now := im.now()
+	if shortURL.ExpireTime != 0 && now > shortURL.ExpireTime {
+		return domain.ErrShortURLExpired
+	}
+	if !shortURL.IsValid(now) {
+		return domain.ErrShortURLNotFound
+	}
+	return nil
+}
+
+func (im *shorturlService) Lookup(ctx context.Context, shortCode string) (*domain.ShortURL, error) {
 	shortURL, err := im.repo.Get(ctx, shortCode)
 	if err != nil {
 		return nil, err
 	}
 	shortURL.ShortURL = im.getShortURL(shortCode)
-	if shortURL == nil || !shortURL.IsValid(im.now()) {
-		return nil, domain.ErrShortURLNotFound
+	switch {
+	case shortURL.Disabled:
+		shortURL.Status = domain.ShortURLStatusDisabled
+	case im.now() > shortURL.ExpireTime:
+		shortURL.Status = domain.ShortURLStatusExpired
+	default:
+		shortURL.Status = domain.ShortURLStatusActive
+	}
+	return shortURL, nil
+}
+
+func (im *shorturlService) Visit(ctx context.Context, visit *domain.Click) (*domain.ShortURL, error) {
+	shortURL, err := im.Get(ctx, visit.ShortCode)
+	if err != nil {
+		return nil, err
+	}
+	if shortURL.Untrusted && !visit.Confirmed {
+		return nil, domain.ErrShortURLUntrusted
 	}
+	visit.Time = im.now()
+	visit.IP = click.AnonymizeIP(visit.IP)
+	im.clicks.Record(visit)
 	return shortURL, nil
 }
+
+const (
+	defaultStatsRange = 7 * 24 * 60 * 60
+	defaultStatsTop   = 10
+	maxStatsTop       = 100
+)
+
+// Stats returns the clicks of a short url, expired and disabled ones included, the series cover the last week unless the query says otherwise
+func (im *shorturlService) Stats(ctx context.Context, shortCode string, query *domain.LinkStatsQuery) (*domain.LinkStats, error) {
+	q := domain.LinkStatsQuery{}
+	if query != nil {
+		q = *query
+	}
+	if q.To == 0 {
+		q.To = im.now()
+	}
+	if q.From == 0 && q.To > defaultStatsRange {
+		q.From = q.To - defaultStatsRange
+	}
+	if q.From > q.To || q.Top < 0 {
+		return nil, domain.ErrStatsQueryInvalid
+	}
+	if q.Top == 0 {
+		q.Top = defaultStatsTop
+	}
+	if q.Top > maxStatsTop {
+		q.Top = maxStatsTop
+	}
+
+	if _, err := im.repo.Get(ctx, shortCode); err != nil {
+		return nil, err
+	}
+	stats, err := im.stats.Stats(ctx, shortCode, &q)
+	if err != nil {
+		return nil, err
+	}
+
+	// distinct visitors are estimated by HyperLogLogs, so they cost the same however busy the link is
+	days := make([]uint64, len(stats.Daily))
+	for i, bucket := range stats.Daily {
+		days[i] = bucket.Time
+	}
+	total, perDay, err := im.repo.CountVisitors(ctx, shortCode, days)
+	if err != nil {
+		return nil, err
+	}
+	stats.UniqueVisitors = total
+	for i := range stats.Daily {
+		stats.Daily[i].Visitors = perDay[i]
+	}
+	return stats, nil
+}
+
+const (
+	defaultTopLimit = 10
+	maxTopLimit     = 100
+)
+
+// Top returns the most clicked short urls of a window, short urls which no longer redirect are left out
+func (im *shorturlService) Top(ctx context.Context, window string, limit int) ([]*domain.TopShortURL, error) {
+	if limit < 0 {
+		return nil, domain.ErrTopQueryInvalid
+	}
+	if limit == 0 {
+		limit = defaultTopLimit
+	}
+	if limit > maxTopLimit {
+		limit = maxTopLimit
+	}
+
+	// fetch extra codes, so the ones left out rarely shorten the list
+	counts, err := im.repo.TopClicks(ctx, window, 2*limit)
+	if err != nil {
+		return nil, err
+	}
+	shortCodes := make([]string, len(counts))
+	for i, count := range counts {
+		shortCodes[i] = count.Name
+	}
+	shortURLs, err := im.repo.GetMany(ctx, shortCodes)
+	if err != nil {
+		return nil, err
+	}
+	byCode := make(map[string]*domain.ShortURL, len(shortURLs))
+	for _, shortURL := range shortURLs {
+		byCode[shortURL.ShortCode] = shortURL
+	}
+
+	top := make([]*domain.TopShortURL, 0, limit)
+	for _, count := range counts {
+		if len(top) == limit {
+			break
+		}
+		shortURL, ok := byCode[count.Name]
+		if !ok || im.checkRedirect(shortURL) != nil {
+			continue
+		}
+		shortURL.ShortURL = im.getShortURL(count.Name)
+		top = append(top, &domain.TopShortURL{ShortURL: *shortURL, Clicks: count.Clicks})
+	}
+	return top, nil
+}
+
+func (im *shorturlService) Subscribe(ctx context.Context, shortCode string) (<-chan *domain.Click, error) {
+	if _, err := im.repo.Get(ctx, shortCode); err != nil {
+		return nil, err
+	}
+	return im.repo.SubscribeClicks(ctx, shortCode), nil
+}
+
+// exportQuery fills the defaults of an export, every click up to now
+func (im *shorturlService) exportQuery(query *domain.ClickExportQuery) (*domain.ClickExportQuery, error) {
+	q := domain.ClickExportQuery{}
+	if query != nil {
+		q = *query
+	}
+	if q.To == 0 {
+		q.To = im.now()
+	}
+	if q.From > q.To {
+		return nil, domain.ErrExportQueryInvalid
+	}
+	return &q, nil
+}
+
+func (im *shorturlService) ExportClicks(ctx context.Context, shortCode string, query *domain.ClickExportQuery, fn func(click *domain.Click) error) error {
+	q, err := im.exportQuery(query)
+	if err != nil {
+		return err
+	}
+	if _, err := im.repo.Get(ctx, shortCode); err != nil {
+		return err
+	}
+	return im.stats.ScanClicks(ctx, shortCode, q, fn)
+}
+
+func (im *shorturlService) ExportDaily(ctx context.Context, shortCode string, query *domain.ClickExportQuery, fn func(bucket *domain.StatsBucket) error) error {
+	q, err := im.exportQuery(query)
+	if err != nil {
+		return err
+	}
+	if _, err := im.repo.Get(ctx, shortCode); err != nil {
+		return err
+	}
+	return im.stats.ScanDaily(ctx, shortCode, q, fn)
+}
+
+// Update changes the given fields of the stored row, which the repository holds locked meanwhile, so a stale cache entry or
+// a concurrent update of other fields is never written back
+func (im *shorturlService) Update(ctx context.Context, shortCode string, update *domain.ShortURLUpdate) (*domain.ShortURL, error) {
+	now := im.now()
+	shortURL, err := im.repo.Update(ctx, shortCode, func(shortURL *domain.ShortURL) error {
+		if update.OriginalURL != nil {
+			shortURL.OriginalURL = *update.OriginalURL
+		}
+		if update.ExpireTime != nil {
+			shortURL.ExpireTime = *update.ExpireTime
+		}
+		if update.RedirectStatus != nil {
+			shortURL.RedirectStatus = *update.RedirectStatus
+		}
+		if update.Untrusted != nil {
+			shortURL.Untrusted = *update.Untrusted
+		}
+		if !shortURL.IsValid(now) {
+			return domain.ErrShortURLInvalid
+		}
+		// rows created before url hashes have none, it is set whether or not the destination changed
+		shortURL.URLHash = urlHash(shortURL.OriginalURL)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	shortURL.ShortURL = im.getShortURL(shortCode)
+	return shortURL, nil
+}
+
+func (im *shorturlService) Delete(ctx context.Context, shortCode string) error {
+	return im.repo.Delete(ctx, shortCode)
+}
+
+func (im *shorturlService) Disable(ctx context.Context, shortCode string) error {
+	return im.repo.Disable(ctx, shortCode)
+}
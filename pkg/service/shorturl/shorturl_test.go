@@ -2,6 +2,8 @@ package shorturl_test
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"time"
 
@@ -10,15 +12,20 @@ import (
 	"github.com/sappy5678/dcard/pkg/domain"
 	"github.com/sappy5678/dcard/pkg/service/shorturl"
 	"github.com/sappy5678/dcard/pkg/service/shorturl/cache"
+	"github.com/sappy5678/dcard/pkg/service/shorturl/click"
 	"github.com/sappy5678/dcard/pkg/service/shorturl/shortcode"
 )
 
 var mockHost = "http://test:test"
 
+var mockMaxMachineID uint64 = 1024
+
 type TestSuite struct {
 	suite.Suite
 	impl               domain.ShortURLService
 	repo               *cache.MockShortURLCacheRepository
+	clicks             *click.MockClickRepository
+	stats              *click.MockStatsRepository
 	shortCodeGenerator *shortcode.MockShortCodeIDRepository
 	mockNowFn          func() uint64
 	mockNow            *time.Time
@@ -27,10 +34,12 @@ type TestSuite struct {
 func (ts *TestSuite) SetupSuite() {
 	ts.shortCodeGenerator = &shortcode.MockShortCodeIDRepository{}
 	ts.repo = &cache.MockShortURLCacheRepository{}
+	ts.clicks = &click.MockClickRepository{}
+	ts.stats = &click.MockStatsRepository{}
 	ts.mockNowFn = func() uint64 {
 		return uint64(ts.mockNow.Unix())
 	}
-	ts.impl = shorturl.New(mockHost, ts.mockNowFn, ts.shortCodeGenerator, ts.repo)
+	ts.impl = shorturl.New(mockHost, ts.mockNowFn, ts.shortCodeGenerator, mockMaxMachineID, ts.repo, ts.clicks, ts.stats)
 }
 
 func (ts *TestSuite) TearDownSuite() {}
@@ -40,41 +49,289 @@ func (ts *TestSuite) TestCreate_NormalCase() {
 	ts.mockNow = &now
 	expireTime := uint64(ts.mockNow.Add(time.Hour).Unix())
 
-	ts.shortCodeGenerator.NextIDFunc = func() string { return "abc123" }
+	ts.shortCodeGenerator.NextIDFunc = func(ctx context.Context) (string, error) { return "abc123", nil }
 	expectedShort := &domain.ShortURL{
 		ShortCode:   "abc123",
 		ShortURL:    mockHost + "/abc123",
 		OriginalURL: "https://example.com",
 		ExpireTime:  expireTime,
 		CreatedTime: uint64(ts.mockNow.Unix()),
+		URLHash:     sha256Hex("https://example.com/"),
 	}
 	ts.repo.CreateFunc = func(ctx context.Context, short *domain.ShortURL) (*domain.ShortURL, error) {
 		return short, nil
 	}
 
-	result, err := ts.impl.Create(context.Background(), "https://example.com", expireTime)
+	result, err := ts.impl.Create(context.Background(), &domain.ShortURLCreate{OriginalURL: "https://example.com", ExpireTime: expireTime})
 
 	ts.Require().NoError(err)
 	ts.Require().Equal(expectedShort, result)
 }
 
+// sha256Hex is the url hash of a normalized url
+func sha256Hex(normalizedURL string) string {
+	sum := sha256.Sum256([]byte(normalizedURL))
+	return hex.EncodeToString(sum[:])
+}
+
+func (ts *TestSuite) TestCreate_Dedupe() {
+	now := time.Now()
+	ts.mockNow = &now
+	expireTime := uint64(ts.mockNow.Add(time.Hour).Unix())
+	existing := &domain.ShortURL{ShortCode: "existing", OriginalURL: "https://Example.com:443", ExpireTime: expireTime}
+
+	ts.repo.FindDuplicateFunc = func(ctx context.Context, short *domain.ShortURL) (*domain.ShortURL, error) {
+		ts.Require().Equal(sha256Hex("https://example.com/"), short.URLHash)
+		ts.Require().Equal(uint64(ts.mockNow.Unix()), short.CreatedTime)
+		ts.Require().Equal(expireTime, short.ExpireTime)
+		if short.RedirectStatus != 0 {
+			return nil, domain.ErrShortURLNotFound
+		}
+		return existing, nil
+	}
+	ts.shortCodeGenerator.NextIDFunc = func(ctx context.Context) (string, error) { return "abc123", nil }
+	ts.repo.CreateFunc = func(ctx context.Context, short *domain.ShortURL) (*domain.ShortURL, error) {
+		return short, nil
+	}
+	// a miss is created under the lock of the hash, which finds a duplicate created since
+	raced := false
+	ts.repo.CreateOrFindDuplicateFunc = func(ctx context.Context, short *domain.ShortURL) (*domain.ShortURL, error) {
+		ts.Require().Equal(sha256Hex("https://example.com/"), short.URLHash)
+		if raced {
+			return &domain.ShortURL{ShortCode: "raced"}, nil
+		}
+		return short, nil
+	}
+
+	result, err := ts.impl.Create(context.Background(), &domain.ShortURLCreate{OriginalURL: "https://example.com", ExpireTime: expireTime, Dedupe: true})
+	ts.Require().NoError(err)
+	ts.Require().Equal("existing", result.ShortCode)
+	ts.Require().Equal(mockHost+"/existing", result.ShortURL)
+
+	// a short url which redirects differently is no duplicate
+	result, err = ts.impl.Create(context.Background(), &domain.ShortURLCreate{OriginalURL: "https://example.com", ExpireTime: expireTime, RedirectStatus: 301, Dedupe: true})
+	ts.Require().NoError(err)
+	ts.Require().Equal("abc123", result.ShortCode)
+
+	raced = true
+	result, err = ts.impl.Create(context.Background(), &domain.ShortURLCreate{OriginalURL: "https://example.com", ExpireTime: expireTime, RedirectStatus: 301, Dedupe: true})
+	ts.Require().NoError(err)
+	ts.Require().Equal("raced", result.ShortCode)
+	ts.Require().Equal(mockHost+"/raced", result.ShortURL)
+
+	// an alias is always created
+	ts.repo.FindDuplicateFunc = func(ctx context.Context, short *domain.ShortURL) (*domain.ShortURL, error) {
+		ts.FailNow("looked up a duplicate of an alias")
+		return nil, nil
+	}
+	result, err = ts.impl.Create(context.Background(), &domain.ShortURLCreate{OriginalURL: "https://example.com", ExpireTime: expireTime, Alias: "spring-sale", Dedupe: true})
+	ts.Require().NoError(err)
+	ts.Require().Equal("spring-sale", result.ShortCode)
+}
+
+func (ts *TestSuite) TestCreate_IdempotencyKey() {
+	now := time.Now()
+	ts.mockNow = &now
+	expireTime := uint64(ts.mockNow.Add(time.Hour).Unix())
+	req := &domain.ShortURLCreate{OriginalURL: "https://example.com", ExpireTime: expireTime, IdempotencyKey: "key"}
+
+	ts.shortCodeGenerator.NextIDFunc = func(ctx context.Context) (string, error) { return "abc123", nil }
+	ts.repo.CreateFunc = func(ctx context.Context, short *domain.ShortURL) (*domain.ShortURL, error) {
+		return short, nil
+	}
+	var hash string
+	var saved *domain.ShortURL
+	ts.repo.ReserveIdempotencyKeyFunc = func(ctx context.Context, key, h, token string) (*domain.ShortURL, error) {
+		ts.Require().Equal("key", key)
+		if hash != "" && h != hash {
+			return nil, domain.ErrIdempotencyKeyReused
+		}
+		hash = h
+		return saved, nil
+	}
+	ts.repo.SaveIdempotencyKeyFunc = func(ctx context.Context, key, h string, short *domain.ShortURL) error {
+		ts.Require().Equal(hash, h)
+		saved = short
+		return nil
+	}
+
+	first, err := ts.impl.Create(context.Background(), req)
+	ts.Require().NoError(err)
+	ts.Require().Equal(saved, first)
+
+	// the retry gets the first short url without creating another
+	ts.repo.CreateFunc = func(ctx context.Context, short *domain.ShortURL) (*domain.ShortURL, error) {
+		ts.FailNow("retry created a short url")
+		return nil, nil
+	}
+	retry, err := ts.impl.Create(context.Background(), req)
+	ts.Require().NoError(err)
+	ts.Require().Equal(first, retry)
+
+	_, err = ts.impl.Create(context.Background(), &domain.ShortURLCreate{OriginalURL: "https://other.example", ExpireTime: expireTime, IdempotencyKey: "key"})
+	ts.Require().ErrorIs(err, domain.ErrIdempotencyKeyReused)
+}
+
+func (ts *TestSuite) TestCreate_IdempotencyKeyReleasedOnFailure() {
+	now := time.Now()
+	ts.mockNow = &now
+
+	ts.shortCodeGenerator.NextIDFunc = func(ctx context.Context) (string, error) { return "abc123", nil }
+	var reservedToken string
+	ts.repo.ReserveIdempotencyKeyFunc = func(ctx context.Context, key, hash, token string) (*domain.ShortURL, error) {
+		reservedToken = token
+		return nil, nil
+	}
+	released := false
+	ts.repo.ReleaseIdempotencyKeyFunc = func(ctx context.Context, key, token string) error {
+		// only the request which reserved the key releases it
+		ts.Require().NotEmpty(token)
+		ts.Require().Equal(reservedToken, token)
+		released = true
+		return nil
+	}
+
+	_, err := ts.impl.Create(context.Background(), &domain.ShortURLCreate{OriginalURL: "https://example.com", IdempotencyKey: "key"})
+	ts.Require().ErrorIs(err, domain.ErrShortURLInvalid)
+	ts.Require().True(released)
+}
+
+func (ts *TestSuite) TestCreateBatch() {
+	now := time.Now()
+	ts.mockNow = &now
+	expireTime := uint64(ts.mockNow.Add(time.Hour).Unix())
+
+	ts.shortCodeGenerator.NextIDFunc = func(ctx context.Context) (string, error) {
+		return "generated", nil
+	}
+	ts.repo.CreateBatchFunc = func(ctx context.Context, shorts []*domain.ShortURL) ([]error, error) {
+		// only the valid short urls are inserted
+		ts.Require().Len(shorts, 2)
+		return []error{nil, domain.ErrShortURLConflict}, nil
+	}
+
+	results, err := ts.impl.CreateBatch(context.Background(), []*domain.ShortURLCreate{
+		{OriginalURL: "https://example.com", ExpireTime: expireTime},
+		{OriginalURL: "not-a-url", ExpireTime: expireTime},
+		{OriginalURL: "https://example.com", ExpireTime: expireTime, Alias: "taken-alias"},
+	})
+	ts.Require().NoError(err)
+	ts.Require().Len(results, 3)
+	ts.Require().NoError(results[0].Err)
+	ts.Require().Equal("generated", results[0].ShortURL.ShortCode)
+	ts.Require().Equal(mockHost+"/generated", results[0].ShortURL.ShortURL)
+	ts.Require().ErrorIs(results[1].Err, domain.ErrShortURLInvalid)
+	ts.Require().ErrorIs(results[2].Err, domain.ErrShortURLConflict)
+}
+
+func (ts *TestSuite) TestCreateBatch_IdempotencyKeys() {
+	now := time.Now()
+	ts.mockNow = &now
+	expireTime := uint64(ts.mockNow.Add(time.Hour).Unix())
+	earlier := &domain.ShortURL{ShortCode: "earlier", ShortURL: mockHost + "/earlier"}
+
+	ts.shortCodeGenerator.NextIDFunc = func(ctx context.Context) (string, error) {
+		return "generated", nil
+	}
+	var reservedToken string
+	ts.repo.ReserveIdempotencyKeysFunc = func(ctx context.Context, keys, hashes []string, token string) ([]*domain.ShortURL, []error, error) {
+		ts.Require().Equal([]string{"done", "running", "new", "invalid"}, keys)
+		reservedToken = token
+		return []*domain.ShortURL{earlier, nil, nil, nil}, []error{nil, domain.ErrIdempotencyInProgress, nil, nil}, nil
+	}
+	ts.repo.CreateBatchFunc = func(ctx context.Context, shorts []*domain.ShortURL) ([]error, error) {
+		// the requests answered by their key are not created again
+		ts.Require().Len(shorts, 2)
+		return []error{nil, nil}, nil
+	}
+	var saved, released []string
+	ts.repo.SaveIdempotencyKeysFunc = func(ctx context.Context, keys, hashes []string, shorts []*domain.ShortURL) error {
+		saved = keys
+		ts.Require().Equal("generated", shorts[0].ShortCode)
+		return nil
+	}
+	ts.repo.ReleaseIdempotencyKeysFunc = func(ctx context.Context, keys []string, token string) error {
+		ts.Require().Equal(reservedToken, token)
+		released = keys
+		return nil
+	}
+
+	results, err := ts.impl.CreateBatch(context.Background(), []*domain.ShortURLCreate{
+		{OriginalURL: "https://example.com", ExpireTime: expireTime, IdempotencyKey: "done"},
+		{OriginalURL: "https://example.com", ExpireTime: expireTime, IdempotencyKey: "running"},
+		{OriginalURL: "https://example.com", ExpireTime: expireTime, IdempotencyKey: "new"},
+		{OriginalURL: "not-a-url", ExpireTime: expireTime, IdempotencyKey: "invalid"},
+		{OriginalURL: "https://example.com", ExpireTime: expireTime},
+	})
+	ts.Require().NoError(err)
+	ts.Require().Equal(earlier, results[0].ShortURL)
+	ts.Require().ErrorIs(results[1].Err, domain.ErrIdempotencyInProgress)
+	ts.Require().Equal("generated", results[2].ShortURL.ShortCode)
+	ts.Require().ErrorIs(results[3].Err, domain.ErrShortURLInvalid)
+	ts.Require().Equal("generated", results[4].ShortURL.ShortCode)
+	ts.Require().Equal([]string{"new"}, saved)
+	ts.Require().Equal([]string{"invalid"}, released)
+
+	// a failed batch releases every key it reserved
+	mockErr := fmt.Errorf("database error")
+	released = nil
+	ts.repo.ReserveIdempotencyKeysFunc = func(ctx context.Context, keys, hashes []string, token string) ([]*domain.ShortURL, []error, error) {
+		reservedToken = token
+		return make([]*domain.ShortURL, len(keys)), make([]error, len(keys)), nil
+	}
+	ts.repo.CreateBatchFunc = func(ctx context.Context, shorts []*domain.ShortURL) ([]error, error) {
+		return nil, mockErr
+	}
+	_, err = ts.impl.CreateBatch(context.Background(), []*domain.ShortURLCreate{
+		{OriginalURL: "https://example.com", ExpireTime: expireTime, IdempotencyKey: "new"},
+		{OriginalURL: "https://example.com", ExpireTime: expireTime, IdempotencyKey: "invalid"},
+	})
+	ts.Require().ErrorIs(err, mockErr)
+	ts.Require().Equal([]string{"new", "invalid"}, released)
+}
+
 func (ts *TestSuite) TestCreate_ShortCodeGenerationFailure() {
-	ts.shortCodeGenerator.NextIDFunc = func() string { return "" }
+	ts.shortCodeGenerator.NextIDFunc = func(ctx context.Context) (string, error) { return "", nil }
 
-	_, err := ts.impl.Create(context.Background(), "https://example.com", 0)
+	_, err := ts.impl.Create(context.Background(), &domain.ShortURLCreate{OriginalURL: "https://example.com"})
 	ts.Require().ErrorIs(err, domain.ErrShortURLInvalid)
 }
 
 func (ts *TestSuite) TestCreate_RepositoryFailure() {
-	ts.shortCodeGenerator.NextIDFunc = func() string { return "def456" }
+	ts.shortCodeGenerator.NextIDFunc = func(ctx context.Context) (string, error) { return "def456", nil }
 	ts.repo.CreateFunc = func(ctx context.Context, short *domain.ShortURL) (*domain.ShortURL, error) {
 		return nil, fmt.Errorf("database error")
 	}
 
-	_, err := ts.impl.Create(context.Background(), "https://invalid.url", 0)
+	_, err := ts.impl.Create(context.Background(), &domain.ShortURLCreate{OriginalURL: "https://invalid.url"})
 	ts.ErrorContains(err, "database error")
 }
 
+func (ts *TestSuite) TestCreate_Alias() {
+	now := time.Now()
+	ts.mockNow = &now
+	expireTime := uint64(ts.mockNow.Add(time.Hour).Unix())
+
+	ts.shortCodeGenerator.NextIDFunc = func(ctx context.Context) (string, error) {
+		ts.Fail("should not be called")
+		return "", nil
+	}
+	ts.repo.CreateFunc = func(ctx context.Context, short *domain.ShortURL) (*domain.ShortURL, error) {
+		return short, nil
+	}
+
+	result, err := ts.impl.Create(context.Background(), &domain.ShortURLCreate{OriginalURL: "https://example.com", ExpireTime: expireTime, Alias: "spring-sale"})
+
+	ts.Require().NoError(err)
+	ts.Require().Equal("spring-sale", result.ShortCode)
+	ts.Require().Equal(mockHost+"/spring-sale", result.ShortURL)
+}
+
+func (ts *TestSuite) TestCreate_InvalidAlias() {
+	_, err := ts.impl.Create(context.Background(), &domain.ShortURLCreate{OriginalURL: "https://example.com", Alias: "api"})
+	ts.Require().ErrorIs(err, domain.ErrAliasInvalid)
+}
+
 func (ts *TestSuite) TestGet_NormalCase() {
 	now := time.Now()
 	ts.mockNow = &now
@@ -131,5 +388,378 @@ func (ts *TestSuite) TestGet_Expired() {
 
 	_, err := ts.impl.Get(context.Background(), "expired")
 
+	ts.Require().ErrorIs(err, domain.ErrShortURLExpired)
+}
+
+func (ts *TestSuite) TestGet_Disabled() {
+	now := time.Now()
+	ts.mockNow = &now
+	expireTime := uint64(ts.mockNow.Add(time.Hour).Unix())
+
+	ts.repo.GetFunc = func(ctx context.Context, shortCode string) (*domain.ShortURL, error) {
+		return &domain.ShortURL{
+			ShortCode:   shortCode,
+			OriginalURL: "https://example.com",
+			ExpireTime:  expireTime,
+			CreatedTime: uint64(ts.mockNow.Unix()),
+			Disabled:    true,
+		}, nil
+	}
+
+	_, err := ts.impl.Get(context.Background(), "disabled")
+
 	ts.Require().ErrorIs(err, domain.ErrShortURLNotFound)
 }
+
+func (ts *TestSuite) TestLookup() {
+	now := time.Now()
+	ts.mockNow = &now
+	expireTime := uint64(ts.mockNow.Add(time.Hour).Unix())
+
+	ts.repo.GetFunc = func(ctx context.Context, shortCode string) (*domain.ShortURL, error) {
+		switch shortCode {
+		case "notfound":
+			return nil, domain.ErrShortURLNotFound
+		case "expired":
+			return &domain.ShortURL{ShortCode: shortCode, ExpireTime: uint64(ts.mockNow.Add(-time.Hour).Unix())}, nil
+		case "disabled":
+			return &domain.ShortURL{ShortCode: shortCode, ExpireTime: expireTime, Disabled: true}, nil
+		}
+		return &domain.ShortURL{ShortCode: shortCode, ExpireTime: expireTime}, nil
+	}
+
+	// expired and disabled short urls are returned too
+	for shortCode, status := range map[string]string{
+		"abc123":   domain.ShortURLStatusActive,
+		"expired":  domain.ShortURLStatusExpired,
+		"disabled": domain.ShortURLStatusDisabled,
+	} {
+		result, err := ts.impl.Lookup(context.Background(), shortCode)
+		ts.Require().NoError(err)
+		ts.Require().Equal(status, result.Status)
+		ts.Require().Equal(mockHost+"/"+shortCode, result.ShortURL)
+	}
+
+	_, err := ts.impl.Lookup(context.Background(), "notfound")
+	ts.Require().ErrorIs(err, domain.ErrShortURLNotFound)
+}
+
+func (ts *TestSuite) TestVisit() {
+	now := time.Now()
+	ts.mockNow = &now
+	expireTime := uint64(ts.mockNow.Add(time.Hour).Unix())
+
+	ts.repo.GetFunc = func(ctx context.Context, shortCode string) (*domain.ShortURL, error) {
+		return &domain.ShortURL{
+			ShortCode:   shortCode,
+			OriginalURL: "https://example.com",
+			ExpireTime:  expireTime,
+			CreatedTime: uint64(ts.mockNow.Unix()),
+		}, nil
+	}
+	var recorded *domain.Click
+	ts.clicks.RecordFunc = func(click *domain.Click) {
+		recorded = click
+	}
+
+	result, err := ts.impl.Visit(context.Background(), &domain.Click{ShortCode: "abc123", Referrer: "https://ref.example", IP: "203.0.113.7"})
+	ts.Require().NoError(err)
+	ts.Require().Equal("https://example.com", result.OriginalURL)
+	ts.Require().Equal(&domain.Click{
+		ShortCode: "abc123",
+		Time:      uint64(ts.mockNow.Unix()),
+		Referrer:  "https://ref.example",
+		IP:        "203.0.113.0",
+	}, recorded)
+}
+
+func (ts *TestSuite) TestVisit_Untrusted() {
+	now := time.Now()
+	ts.mockNow = &now
+
+	ts.repo.GetFunc = func(ctx context.Context, shortCode string) (*domain.ShortURL, error) {
+		return &domain.ShortURL{
+			ShortCode:   shortCode,
+			OriginalURL: "https://example.com",
+			ExpireTime:  uint64(ts.mockNow.Add(time.Hour).Unix()),
+			CreatedTime: uint64(ts.mockNow.Unix()),
+			Untrusted:   true,
+		}, nil
+	}
+	recorded := 0
+	ts.clicks.RecordFunc = func(click *domain.Click) {
+		recorded++
+	}
+
+	// nothing is recorded until the visitor confirms
+	_, err := ts.impl.Visit(context.Background(), &domain.Click{ShortCode: "abc123"})
+	ts.Require().ErrorIs(err, domain.ErrShortURLUntrusted)
+	ts.Require().Equal(0, recorded)
+
+	result, err := ts.impl.Visit(context.Background(), &domain.Click{ShortCode: "abc123", Confirmed: true})
+	ts.Require().NoError(err)
+	ts.Require().Equal("https://example.com", result.OriginalURL)
+	ts.Require().Equal(1, recorded)
+}
+
+func (ts *TestSuite) TestVisit_NotFound() {
+	ts.repo.GetFunc = func(ctx context.Context, shortCode string) (*domain.ShortURL, error) {
+		return nil, domain.ErrShortURLNotFound
+	}
+	ts.clicks.RecordFunc = func(click *domain.Click) {
+		ts.Fail("click of a missing short url recorded")
+	}
+
+	_, err := ts.impl.Visit(context.Background(), &domain.Click{ShortCode: "notfound"})
+	ts.Require().ErrorIs(err, domain.ErrShortURLNotFound)
+}
+
+func (ts *TestSuite) TestStats() {
+	now := time.Now()
+	ts.mockNow = &now
+
+	ts.repo.GetFunc = func(ctx context.Context, shortCode string) (*domain.ShortURL, error) {
+		return &domain.ShortURL{ShortCode: shortCode}, nil
+	}
+	var got *domain.LinkStatsQuery
+	ts.stats.StatsFunc = func(ctx context.Context, shortCode string, query *domain.LinkStatsQuery) (*domain.LinkStats, error) {
+		got = query
+		return &domain.LinkStats{
+			ShortCode:   shortCode,
+			TotalClicks: 3,
+			Daily:       []domain.StatsBucket{{Time: 86400, Clicks: 2}, {Time: 2 * 86400, Clicks: 1}},
+		}, nil
+	}
+	ts.repo.CountVisitorsFunc = func(ctx context.Context, shortCode string, days []uint64) (uint64, []uint64, error) {
+		ts.Require().Equal([]uint64{86400, 2 * 86400}, days)
+		return 2, []uint64{2, 1}, nil
+	}
+
+	result, err := ts.impl.Stats(context.Background(), "abc123", nil)
+	ts.Require().NoError(err)
+	ts.Require().Equal(uint64(3), result.TotalClicks)
+	ts.Require().Equal(uint64(2), result.UniqueVisitors)
+	ts.Require().Equal([]domain.StatsBucket{{Time: 86400, Clicks: 2, Visitors: 2}, {Time: 2 * 86400, Clicks: 1, Visitors: 1}}, result.Daily)
+	// defaults to the last week and the top 10
+	ts.Require().Equal(&domain.LinkStatsQuery{
+		From: uint64(ts.mockNow.Unix()) - 7*24*60*60,
+		To:   uint64(ts.mockNow.Unix()),
+		Top:  10,
+	}, got)
+
+	_, err = ts.impl.Stats(context.Background(), "abc123", &domain.LinkStatsQuery{From: 100, To: 200, Top: 1000})
+	ts.Require().NoError(err)
+	ts.Require().Equal(&domain.LinkStatsQuery{From: 100, To: 200, Top: 100}, got)
+}
+
+func (ts *TestSuite) TestStats_Invalid() {
+	_, err := ts.impl.Stats(context.Background(), "abc123", &domain.LinkStatsQuery{From: 200, To: 100})
+	ts.Require().ErrorIs(err, domain.ErrStatsQueryInvalid)
+}
+
+func (ts *TestSuite) TestStats_NotFound() {
+	ts.repo.GetFunc = func(ctx context.Context, shortCode string) (*domain.ShortURL, error) {
+		return nil, domain.ErrShortURLNotFound
+	}
+
+	_, err := ts.impl.Stats(context.Background(), "notfound", nil)
+	ts.Require().ErrorIs(err, domain.ErrShortURLNotFound)
+}
+
+func (ts *TestSuite) TestTop() {
+	now := time.Now()
+	ts.mockNow = &now
+	expireTime := uint64(ts.mockNow.Add(time.Hour).Unix())
+
+	ts.repo.TopClicksFunc = func(ctx context.Context, window string, limit int) ([]domain.StatsCount, error) {
+		ts.Require().Equal(domain.TopWindowDay, window)
+		ts.Require().Equal(4, limit)
+		return []domain.StatsCount{{Name: "a", Clicks: 5}, {Name: "gone", Clicks: 4}, {Name: "b", Clicks: 3}, {Name: "c", Clicks: 1}}, nil
+	}
+	calls := 0
+	ts.repo.GetManyFunc = func(ctx context.Context, shortCodes []string) ([]*domain.ShortURL, error) {
+		calls++
+		ts.Require().Equal([]string{"a", "gone", "b", "c"}, shortCodes)
+		var shorts []*domain.ShortURL
+		for _, shortCode := range shortCodes {
+			if shortCode == "gone" {
+				continue
+			}
+			shorts = append(shorts, &domain.ShortURL{
+				ShortCode:   shortCode,
+				OriginalURL: "https://example.com",
+				ExpireTime:  expireTime,
+				CreatedTime: uint64(ts.mockNow.Unix()),
+			})
+		}
+		return shorts, nil
+	}
+
+	// the candidates are fetched at once and short urls which no longer redirect are skipped
+	top, err := ts.impl.Top(context.Background(), domain.TopWindowDay, 2)
+	ts.Require().NoError(err)
+	ts.Require().Len(top, 2)
+	ts.Require().Equal("a", top[0].ShortCode)
+	ts.Require().Equal(uint64(5), top[0].Clicks)
+	ts.Require().Equal("b", top[1].ShortCode)
+	ts.Require().Equal(mockHost+"/b", top[1].ShortURL.ShortURL)
+	ts.Require().Equal(1, calls)
+}
+
+func (ts *TestSuite) TestTop_Invalid() {
+	_, err := ts.impl.Top(context.Background(), domain.TopWindowHour, -1)
+	ts.Require().ErrorIs(err, domain.ErrTopQueryInvalid)
+}
+
+func (ts *TestSuite) TestSubscribe() {
+	ts.repo.GetFunc = func(ctx context.Context, shortCode string) (*domain.ShortURL, error) {
+		if shortCode == "notfound" {
+			return nil, domain.ErrShortURLNotFound
+		}
+		return &domain.ShortURL{ShortCode: shortCode}, nil
+	}
+	events := make(chan *domain.Click)
+	ts.repo.SubscribeClicksFunc = func(ctx context.Context, shortCode string) <-chan *domain.Click {
+		return events
+	}
+
+	clicks, err := ts.impl.Subscribe(context.Background(), "abc123")
+	ts.Require().NoError(err)
+	ts.Require().Equal((<-chan *domain.Click)(events), clicks)
+
+	_, err = ts.impl.Subscribe(context.Background(), "notfound")
+	ts.Require().ErrorIs(err, domain.ErrShortURLNotFound)
+}
+
+func (ts *TestSuite) TestExportClicks() {
+	now := time.Now()
+	ts.mockNow = &now
+
+	ts.repo.GetFunc = func(ctx context.Context, shortCode string) (*domain.ShortURL, error) {
+		if shortCode == "notfound" {
+			return nil, domain.ErrShortURLNotFound
+		}
+		return &domain.ShortURL{ShortCode: shortCode}, nil
+	}
+	var got *domain.ClickExportQuery
+	ts.stats.ScanClicksFunc = func(ctx context.Context, shortCode string, query *domain.ClickExportQuery, fn func(click *domain.Click) error) error {
+		got = query
+		return fn(&domain.Click{ShortCode: shortCode, Time: 100})
+	}
+
+	var clicks []*domain.Click
+	err := ts.impl.ExportClicks(context.Background(), "abc123", nil, func(click *domain.Click) error {
+		clicks = append(clicks, click)
+		return nil
+	})
+	ts.Require().NoError(err)
+	ts.Require().Equal([]*domain.Click{{ShortCode: "abc123", Time: 100}}, clicks)
+	// defaults to every click up to now
+	ts.Require().Equal(&domain.ClickExportQuery{To: uint64(ts.mockNow.Unix())}, got)
+
+	err = ts.impl.ExportClicks(context.Background(), "notfound", nil, func(click *domain.Click) error { return nil })
+	ts.Require().ErrorIs(err, domain.ErrShortURLNotFound)
+}
+
+func (ts *TestSuite) TestExportDaily() {
+	ts.repo.GetFunc = func(ctx context.Context, shortCode string) (*domain.ShortURL, error) {
+		return &domain.ShortURL{ShortCode: shortCode}, nil
+	}
+	ts.stats.ScanDailyFunc = func(ctx context.Context, shortCode string, query *domain.ClickExportQuery, fn func(bucket *domain.StatsBucket) error) error {
+		ts.Require().Equal(&domain.ClickExportQuery{From: 100, To: 200, ExcludeBots: true}, query)
+		return fn(&domain.StatsBucket{Time: 86400, Clicks: 2})
+	}
+
+	var buckets []*domain.StatsBucket
+	err := ts.impl.ExportDaily(context.Background(), "abc123", &domain.ClickExportQuery{From: 100, To: 200, ExcludeBots: true}, func(bucket *domain.StatsBucket) error {
+		buckets = append(buckets, bucket)
+		return nil
+	})
+	ts.Require().NoError(err)
+	ts.Require().Equal([]*domain.StatsBucket{{Time: 86400, Clicks: 2}}, buckets)
+
+	err = ts.impl.ExportDaily(context.Background(), "abc123", &domain.ClickExportQuery{From: 200, To: 100}, func(bucket *domain.StatsBucket) error { return nil })
+	ts.Require().ErrorIs(err, domain.ErrExportQueryInvalid)
+}
+
+func (ts *TestSuite) TestUpdate() {
+	now := time.Now()
+	ts.mockNow = &now
+	expireTime := uint64(ts.mockNow.Add(time.Hour).Unix())
+	newExpireTime := uint64(ts.mockNow.Add(2 * time.Hour).Unix())
+	newURL := "https://fixed.com"
+
+	// the update is applied to the row the repository locked
+	ts.repo.UpdateFunc = func(ctx context.Context, shortCode string, apply func(short *domain.ShortURL) error) (*domain.ShortURL, error) {
+		short := &domain.ShortURL{
+			ShortCode:   shortCode,
+			OriginalURL: "https://typo.com",
+			ExpireTime:  expireTime,
+			CreatedTime: uint64(ts.mockNow.Unix()),
+			Untrusted:   true,
+		}
+		if err := apply(short); err != nil {
+			return nil, err
+		}
+		return short, nil
+	}
+
+	permanent := 308
+	result, err := ts.impl.Update(context.Background(), "abc123", &domain.ShortURLUpdate{OriginalURL: &newURL, ExpireTime: &newExpireTime, RedirectStatus: &permanent})
+
+	ts.Require().NoError(err)
+	ts.Require().Equal(newURL, result.OriginalURL)
+	ts.Require().Equal(newExpireTime, result.ExpireTime)
+	ts.Require().Equal(permanent, result.RedirectStatus)
+	ts.Require().True(result.Untrusted, "fields left out are kept")
+	ts.Require().Equal(sha256Hex(newURL+"/"), result.URLHash)
+	ts.Require().Equal(mockHost+"/abc123", result.ShortURL)
+}
+
+func (ts *TestSuite) TestUpdate_Invalid() {
+	now := time.Now()
+	ts.mockNow = &now
+	pastExpireTime := uint64(ts.mockNow.Add(-time.Hour).Unix())
+
+	ts.repo.UpdateFunc = func(ctx context.Context, shortCode string, apply func(short *domain.ShortURL) error) (*domain.ShortURL, error) {
+		short := &domain.ShortURL{
+			ShortCode:   shortCode,
+			OriginalURL: "https://example.com",
+			ExpireTime:  uint64(ts.mockNow.Add(time.Hour).Unix()),
+			CreatedTime: uint64(ts.mockNow.Add(-2 * time.Hour).Unix()),
+		}
+		if err := apply(short); err != nil {
+			return nil, err
+		}
+		return short, nil
+	}
+
+	_, err := ts.impl.Update(context.Background(), "abc123", &domain.ShortURLUpdate{ExpireTime: &pastExpireTime})
+
+	ts.Require().ErrorIs(err, domain.ErrShortURLInvalid)
+
+	ok := 200
+	_, err = ts.impl.Update(context.Background(), "abc123", &domain.ShortURLUpdate{RedirectStatus: &ok})
+
+	ts.Require().ErrorIs(err, domain.ErrShortURLInvalid)
+}
+
+func (ts *TestSuite) TestDelete() {
+	ts.repo.DeleteFunc = func(ctx context.Context, shortCode string) error {
+		return domain.ErrShortURLNotFound
+	}
+
+	err := ts.impl.Delete(context.Background(), "notfound")
+
+	ts.Require().ErrorIs(err, domain.ErrShortURLNotFound)
+}
+
+func (ts *TestSuite) TestDisable() {
+	ts.repo.DisableFunc = func(ctx context.Context, shortCode string) error {
+		return nil
+	}
+
+	err := ts.impl.Disable(context.Background(), "abc123")
+
+	ts.Require().NoError(err)
+}
@@ -0,0 +1,66 @@
+package transport
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/labstack/echo"
+)
+
+// ParseTrustedProxies parses the CIDRs of the proxies whose forwarding headers are believed
+func ParseTrustedProxies(cidrs []string) ([]netip.Prefix, error) {
+	proxies := make([]netip.Prefix, len(cidrs))
+	for i, cidr := range cidrs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, err
+		}
+		proxies[i] = prefix.Masked()
+	}
+	return proxies, nil
+}
+
+// clientIP returns the address a request came from. Forwarding headers are only believed when it came through a trusted proxy,
+// the client is then the rightmost X-Forwarded-For hop which is no trusted proxy, anything left of it may be made up.
+func (h HTTP) clientIP(req *http.Request) string {
+	ip, err := netip.ParseAddrPort(req.RemoteAddr)
+	if err != nil {
+		host, _, _ := net.SplitHostPort(req.RemoteAddr)
+		return host
+	}
+	addr := ip.Addr().Unmap()
+	if !h.trustedProxy(addr) {
+		return addr.String()
+	}
+
+	forwarded := req.Header.Get(echo.HeaderXForwardedFor)
+	if forwarded == "" {
+		if realIP, err := netip.ParseAddr(req.Header.Get(echo.HeaderXRealIP)); err == nil {
+			return realIP.Unmap().String()
+		}
+		return addr.String()
+	}
+	hops := strings.Split(forwarded, ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		addr = hop.Unmap()
+		if !h.trustedProxy(addr) {
+			break
+		}
+	}
+	return addr.String()
+}
+
+func (h HTTP) trustedProxy(addr netip.Addr) bool {
+	for _, proxy := range h.trustedProxies {
+		if proxy.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+package transport
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"strings"
+)
+
+// confirmToken signs the short code with the expiry of the token, the interstitial of an untrusted short url links
+// to the short url with it. A shared link can only skip the interstitial until the token expires.
+func (h HTTP) confirmToken(shortCode string) string {
+	expiry := strconv.FormatInt(h.now().Add(h.confirmTTL).Unix(), 10)
+	return expiry + "." + h.confirmSignature(shortCode, expiry)
+}
+
+// confirmed reports whether the request carries a confirm token of the short code which did not expire
+func (h HTTP) confirmed(shortCode, token string) bool {
+	expiry, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+	expireUnix, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || h.now().Unix() > expireUnix {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(h.confirmSignature(shortCode, expiry)))
+}
+
+func (h HTTP) confirmSignature(shortCode, expiry string) string {
+	mac := hmac.New(sha256.New, h.confirmSecret)
+	mac.Write([]byte(shortCode + "\n" + expiry))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// randomSecret is the confirm secret of a server without one, tokens it signs are only accepted by itself
+func randomSecret() []byte {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(err)
+	}
+	return secret
+}
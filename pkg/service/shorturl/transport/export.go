@@ -0,0 +1,146 @@
+package transport
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sappy5678/dcard/pkg/domain"
+
+	"github.com/labstack/echo"
+)
+
+// export formats
+const (
+	exportCSV    = "csv"
+	exportNDJSON = "ndjson"
+)
+
+const (
+	// exportFlushRows is how many rows are written between flushes to the client
+	exportFlushRows = 500
+	// exportWriteTimeout bounds every flush, so a slow client cannot hold the export forever
+	exportWriteTimeout = 30 * time.Second
+)
+
+// exportWriter streams rows to the client as they are read, the response is
+// only committed on the first row so errors before it still get a status
+type exportWriter struct {
+	c        echo.Context
+	rc       *http.ResponseController
+	format   string
+	filename string
+	header   []string
+
+	csv     *csv.Writer
+	json    *json.Encoder
+	started bool
+	rows    int
+}
+
+func newExportWriter(c echo.Context, format, filename string, header []string) *exportWriter {
+	return &exportWriter{
+		c:        c,
+		rc:       http.NewResponseController(c.Response().Writer),
+		format:   format,
+		filename: filename,
+		header:   header,
+	}
+}
+
+func (w *exportWriter) start() error {
+	w.started = true
+	res := w.c.Response()
+	if err := w.extendDeadline(); err != nil {
+		return err
+	}
+	if w.format == exportNDJSON {
+		res.Header().Set(echo.HeaderContentType, "application/x-ndjson")
+		res.Header().Set(echo.HeaderContentDisposition, `attachment; filename="`+w.filename+`.ndjson"`)
+		res.WriteHeader(http.StatusOK)
+		w.json = json.NewEncoder(res)
+		return nil
+	}
+	res.Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+	res.Header().Set(echo.HeaderContentDisposition, `attachment; filename="`+w.filename+`.csv"`)
+	res.WriteHeader(http.StatusOK)
+	w.csv = csv.NewWriter(res)
+	return w.csv.Write(w.header)
+}
+
+// write writes a row, value as a json line or record as a csv line
+func (w *exportWriter) write(value interface{}, record []string) error {
+	if !w.started {
+		if err := w.start(); err != nil {
+			return err
+		}
+	}
+	var err error
+	if w.json != nil {
+		err = w.json.Encode(value)
+	} else {
+		err = w.csv.Write(escapeFormulas(record))
+	}
+	if err != nil {
+		return err
+	}
+	w.rows++
+	if w.rows%exportFlushRows == 0 {
+		return w.flush()
+	}
+	return nil
+}
+
+// escapeFormulas prefixes cells a spreadsheet would run as a formula with a quote, referrers and user agents come from clients
+func escapeFormulas(record []string) []string {
+	for i, cell := range record {
+		if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+			record[i] = "'" + cell
+		}
+	}
+	return record
+}
+
+func (w *exportWriter) flush() error {
+	if w.csv != nil {
+		w.csv.Flush()
+		if err := w.csv.Error(); err != nil {
+			return err
+		}
+	}
+	w.c.Response().Flush()
+	return w.extendDeadline()
+}
+
+// extendDeadline pushes the server write timeout, which would otherwise cut long exports
+func (w *exportWriter) extendDeadline() error {
+	if err := w.rc.SetWriteDeadline(time.Now().Add(exportWriteTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	return nil
+}
+
+// finish ends the export, an error before the first row is answered with its
+// status, after it the stream is already committed and just ends early
+func (w *exportWriter) finish(err error) error {
+	if err == nil && !w.started {
+		err = w.start()
+	}
+	if err == nil {
+		err = w.flush()
+	}
+	if err == nil {
+		return nil
+	}
+	if w.started {
+		// returned so the error is logged, nothing more is written to the client
+		return err
+	}
+	if errors.Is(err, domain.ErrExportQueryInvalid) {
+		return exportQueryError(w.c)
+	}
+	return notFoundError(w.c, err)
+}
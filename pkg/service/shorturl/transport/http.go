@@ -1,7 +1,13 @@
 package transport
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/sappy5678/dcard/pkg/domain"
@@ -10,28 +16,154 @@ import (
 )
 
 type HTTP struct {
-	Service domain.ShortURLService
+	Service        domain.ShortURLService
+	shutdown       <-chan struct{}
+	heartbeat      time.Duration
+	redirectStatus int
+	redirectMaxAge time.Duration
+	pages          *Pages
+	maxBatchSize   int
+	trustedProxies []netip.Prefix
+	confirmSecret  []byte
+	confirmTTL     time.Duration
+	now            func() time.Time
 }
 
-func NewHTTP(svc domain.ShortURLService, r *echo.Group) {
-	h := HTTP{Service: svc}
+// Config represents transport specific config
+type Config struct {
+	// Shutdown is closed when the server shuts down, event streams end on it
+	Shutdown <-chan struct{}
+	// Heartbeat is how often an idle event stream is written to, so proxies keep it open
+	Heartbeat time.Duration
+	// RedirectStatus is the status of short urls which did not choose one, 301, 302, 307 or 308
+	RedirectStatus int
+	// RedirectMaxAge caps how long browsers and CDNs cache a permanent redirect, changes to the short url are not seen before
+	RedirectMaxAge time.Duration
+	// Pages are shown to browsers when a short url does not redirect, the built in page is used without them
+	Pages *Pages
+	// MaxBatchSize caps how many short urls one batch creates
+	MaxBatchSize int
+	// TrustedProxies are the proxies whose X-Forwarded-For and X-Real-IP are believed, without them clicks are recorded
+	// with the address of the connection
+	TrustedProxies []netip.Prefix
+	// ConfirmSecret signs the continue links of interstitials, servers sharing links need the same one.
+	// A random secret is used without it.
+	ConfirmSecret []byte
+	// ConfirmTTL is how long the continue link of an interstitial skips it
+	ConfirmTTL time.Duration
+}
+
+const (
+	defaultHeartbeat      = 15 * time.Second
+	defaultRedirectStatus = http.StatusTemporaryRedirect
+	defaultRedirectMaxAge = 24 * time.Hour
+	defaultMaxBatchSize   = 1000
+	defaultConfirmTTL     = 10 * time.Minute
+	// maxBatchItemBytes is the body a batch may take per short url, a larger body is refused before it is decoded
+	maxBatchItemBytes = 8 << 10
+)
+
+func NewHTTP(svc domain.ShortURLService, r *echo.Group, cfg *Config) {
+	h := HTTP{
+		Service:        svc,
+		heartbeat:      defaultHeartbeat,
+		redirectStatus: defaultRedirectStatus,
+		redirectMaxAge: defaultRedirectMaxAge,
+		maxBatchSize:   defaultMaxBatchSize,
+		confirmTTL:     defaultConfirmTTL,
+		now:            time.Now,
+	}
+	if cfg != nil {
+		h.shutdown = cfg.Shutdown
+		if cfg.Heartbeat > 0 {
+			h.heartbeat = cfg.Heartbeat
+		}
+		if cfg.RedirectStatus != 0 {
+			h.redirectStatus = cfg.RedirectStatus
+		}
+		if cfg.RedirectMaxAge > 0 {
+			h.redirectMaxAge = cfg.RedirectMaxAge
+		}
+		h.pages = cfg.Pages
+		if cfg.MaxBatchSize > 0 {
+			h.maxBatchSize = cfg.MaxBatchSize
+		}
+		h.trustedProxies = cfg.TrustedProxies
+		h.confirmSecret = cfg.ConfirmSecret
+		if cfg.ConfirmTTL > 0 {
+			h.confirmTTL = cfg.ConfirmTTL
+		}
+	}
+	if len(h.confirmSecret) == 0 {
+		h.confirmSecret = randomSecret()
+	}
 
-	// Get short URL
+	// Get short URL, a trailing + or ?preview=1 shows where it goes instead
 	// GET /{shortCode}
 	r.GET("/:shortCode", h.get)
 
+	// Location of a short URL without recording a click
+	// HEAD /{shortCode}
+	r.HEAD("/:shortCode", h.head)
+
 	ur := r.Group("/api/v1")
 
 	// Create short url
 	// POST /api/v1/urls/
 	ur.POST("/urls", h.create)
+
+	// Create many short urls, every one gets a result of its own
+	// POST /api/v1/urls:batch
+	ur.POST("/urls:action", h.action)
+
+	// Update destination or expiry of a short url
+	// PATCH /api/v1/urls/{id}
+	ur.PATCH("/urls/:id", h.update)
+
+	// Short url with its status, whether or not it redirects
+	// GET /api/v1/urls/{id}
+	ur.GET("/urls/:id", h.lookup)
+
+	// Most clicked short urls of the last hour, day or week
+	// GET /api/v1/urls/top?window=1h&limit=50
+	ur.GET("/urls/top", h.top)
+
+	// Click statistics of a short url
+	// GET /api/v1/urls/{id}/stats?from=&to=&top=&excludeBots=
+	ur.GET("/urls/:id/stats", h.stats)
+
+	// Live clicks of a short url as Server-Sent Events
+	// GET /api/v1/urls/{id}/events
+	ur.GET("/urls/:id/events", h.events)
+
+	// Click events or daily clicks of a short url as CSV or NDJSON
+	// GET /api/v1/urls/{id}/clicks/export?format=csv&kind=events&from=&to=&excludeBots=
+	ur.GET("/urls/:id/clicks/export", h.export)
+
+	// Delete short url
+	// DELETE /api/v1/urls/{id}
+	ur.DELETE("/urls/:id", h.delete)
+
+	// Disable short url, it stays reserved but no longer redirects
+	// POST /api/v1/urls/{id}/disable
+	ur.POST("/urls/:id/disable", h.disable)
 }
 
 type createReq struct {
-	OriginalURL string `json:"url"`
-	ExpireTime  string `json:"expireAt"`
+	OriginalURL    string `json:"url"`
+	ExpireTime     string `json:"expireAt"`
+	Alias          string `json:"alias,omitempty"`
+	RedirectStatus int    `json:"redirectStatus,omitempty"`
+	Untrusted      bool   `json:"untrusted,omitempty"`
+	// Dedupe returns an existing short url of the destination, only the single create honors it
+	Dedupe bool `json:"dedupe,omitempty"`
 }
 
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+	maxIdempotencyKeyLen = 255
+)
+
 type createResp struct {
 	ShortCode string `json:"id"`
 	ShortURL  string `json:"shortUrl"`
@@ -49,11 +181,22 @@ func (h HTTP) create(c echo.Context) error {
 		err := c.JSON(http.StatusBadRequest, domain.ErrorRespond{Error: domain.ErrShortURLInvalid.Error()})
 		return err
 	}
+	idempotencyKey := c.Request().Header.Get(idempotencyKeyHeader)
+	if len(idempotencyKey) > maxIdempotencyKeyLen {
+		return c.JSON(http.StatusBadRequest, domain.ErrorRespond{Error: domain.ErrIdempotencyKeyInvalid.Error()})
+	}
 
-	short, err := h.Service.Create(c.Request().Context(), req.OriginalURL, uint64(expireTime.Unix()))
+	short, err := h.Service.Create(c.Request().Context(), &domain.ShortURLCreate{
+		OriginalURL:    req.OriginalURL,
+		ExpireTime:     uint64(expireTime.Unix()),
+		Alias:          req.Alias,
+		RedirectStatus: req.RedirectStatus,
+		Untrusted:      req.Untrusted,
+		IdempotencyKey: idempotencyKey,
+		Dedupe:         req.Dedupe,
+	})
 	if err != nil {
-		err := c.JSON(http.StatusBadRequest, domain.ErrorRespond{Error: domain.ErrShortURLInvalid.Error()})
-		return err
+		return createError(c, err)
 	}
 
 	resp := createResp{
@@ -63,13 +206,469 @@ func (h HTTP) create(c echo.Context) error {
 	return c.JSON(http.StatusOK, resp)
 }
 
+// createError responds with the status of a Create error
+func createError(c echo.Context, err error) error {
+	status, message := createErrorStatus(err)
+	return c.JSON(status, domain.ErrorRespond{Error: message})
+}
+
+// createErrorStatus returns the status and message of a Create error, unknown errors are reported as an invalid short url
+func createErrorStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, domain.ErrShortURLUnavailable):
+		return http.StatusServiceUnavailable, domain.ErrShortURLUnavailable.Error()
+	case errors.Is(err, domain.ErrShortURLConflict):
+		return http.StatusConflict, domain.ErrShortURLConflict.Error()
+	case errors.Is(err, domain.ErrAliasInvalid):
+		return http.StatusBadRequest, err.Error()
+	case errors.Is(err, domain.ErrIdempotencyKeyReused):
+		return http.StatusUnprocessableEntity, domain.ErrIdempotencyKeyReused.Error()
+	case errors.Is(err, domain.ErrIdempotencyInProgress):
+		return http.StatusConflict, domain.ErrIdempotencyInProgress.Error()
+	default:
+		return http.StatusBadRequest, domain.ErrShortURLInvalid.Error()
+	}
+}
+
+// action dispatches the custom methods of /urls, echo reads the colon of /urls:batch as a param
+func (h HTTP) action(c echo.Context) error {
+	switch c.Param("action") {
+	case ":batch":
+		return h.createBatch(c)
+	default:
+		return echo.ErrNotFound
+	}
+}
+
+// batchItemResp is the result of one short url of a batch, either the short url or its error
+type batchItemResp struct {
+	ShortCode string `json:"id,omitempty"`
+	ShortURL  string `json:"shortUrl,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+type batchResp struct {
+	Results []batchItemResp `json:"results"`
+}
+
+func (h HTTP) createBatch(c echo.Context) error {
+	body := http.MaxBytesReader(c.Response().Writer, c.Request().Body, int64(h.maxBatchSize)*maxBatchItemBytes)
+	c.Request().Body = body
+	var reqs []createReq
+	if err := c.Bind(&reqs); err != nil {
+		// the binder reports every decode error as a bad request, the reader keeps returning the limit it hit
+		var tooLarge *http.MaxBytesError
+		if _, readErr := body.Read(nil); errors.As(readErr, &tooLarge) {
+			return c.JSON(http.StatusRequestEntityTooLarge, domain.ErrorRespond{Error: domain.ErrBatchTooLarge.Error()})
+		}
+		return c.JSON(http.StatusBadRequest, domain.ErrorRespond{Error: err.Error()})
+	}
+	if len(reqs) == 0 {
+		return c.JSON(http.StatusBadRequest, domain.ErrorRespond{Error: domain.ErrShortURLInvalid.Error()})
+	}
+	if len(reqs) > h.maxBatchSize {
+		return c.JSON(http.StatusRequestEntityTooLarge, domain.ErrorRespond{Error: domain.ErrBatchTooLarge.Error()})
+	}
+
+	results := make([]batchItemResp, len(reqs))
+	creates := make([]*domain.ShortURLCreate, 0, len(reqs))
+	// index in reqs of every create
+	indexes := make([]int, 0, len(reqs))
+	for i, req := range reqs {
+		expireTime, err := time.Parse(time.RFC3339, req.ExpireTime)
+		if err != nil || expireTime.IsZero() {
+			results[i].Error = domain.ErrShortURLInvalid.Error()
+			continue
+		}
+		creates = append(creates, &domain.ShortURLCreate{
+			OriginalURL:    req.OriginalURL,
+			ExpireTime:     uint64(expireTime.Unix()),
+			Alias:          req.Alias,
+			RedirectStatus: req.RedirectStatus,
+			Untrusted:      req.Untrusted,
+		})
+		indexes = append(indexes, i)
+	}
+
+	if len(creates) > 0 {
+		created, err := h.Service.CreateBatch(c.Request().Context(), creates)
+		if err != nil {
+			return createError(c, err)
+		}
+		for j, i := range indexes {
+			if created[j].Err != nil {
+				_, results[i].Error = createErrorStatus(created[j].Err)
+				continue
+			}
+			results[i].ShortCode = created[j].ShortURL.ShortCode
+			results[i].ShortURL = created[j].ShortURL.ShortURL
+		}
+	}
+	return c.JSON(http.StatusOK, batchResp{Results: results})
+}
+
+// query params of GET /{shortCode}
+const (
+	previewParam = "preview"
+	confirmParam = "confirm"
+)
+
 func (h HTTP) get(c echo.Context) error {
+	req := c.Request()
+	shortCode := c.Param("shortCode")
+	if code, ok := strings.CutSuffix(shortCode, "+"); ok || queryFlag(c, previewParam) {
+		return h.preview(c, code)
+	}
+
+	short, err := h.Service.Visit(req.Context(), &domain.Click{
+		ShortCode: shortCode,
+		Referrer:  req.Referer(),
+		UserAgent: req.UserAgent(),
+		IP:        h.clientIP(req),
+
+		AcceptLanguage: req.Header.Get("Accept-Language"),
+		Purpose:        purpose(req),
+		Confirmed:      h.confirmed(shortCode, c.QueryParam(confirmParam)),
+	})
+	if errors.Is(err, domain.ErrShortURLUntrusted) {
+		// the interstitial, its continue link carries a confirm token of the short code
+		return h.preview(c, shortCode)
+	}
+	if err != nil {
+		return h.visitError(c, err)
+	}
+	return h.redirect(c, short)
+}
+
+// head answers like get, but looks the short url up without recording a click
+func (h HTTP) head(c echo.Context) error {
 	shortCode := c.Param("shortCode")
+	if code, ok := strings.CutSuffix(shortCode, "+"); ok || queryFlag(c, previewParam) {
+		return h.preview(c, code)
+	}
+
 	short, err := h.Service.Get(c.Request().Context(), shortCode)
 	if err != nil {
-		err := c.JSON(http.StatusNotFound, domain.ErrorRespond{Error: domain.ErrShortURLNotFound.Error()})
+		return h.visitError(c, err)
+	}
+	if short.Untrusted && !h.confirmed(shortCode, c.QueryParam(confirmParam)) {
+		return h.previewPage(c, short)
+	}
+	return h.redirect(c, short)
+}
+
+// visitError responds 410 to an expired short url and 404 otherwise
+func (h HTTP) visitError(c echo.Context, err error) error {
+	if errors.Is(err, domain.ErrShortURLExpired) {
+		return h.errorPage(c, http.StatusGone, domain.ErrShortURLExpired)
+	}
+	return h.errorPage(c, http.StatusNotFound, domain.ErrShortURLNotFound)
+}
+
+func (h HTTP) redirect(c echo.Context, short *domain.ShortURL) error {
+	status := short.RedirectStatus
+	if status == 0 {
+		status = h.redirectStatus
+	}
+	c.Response().Header().Set("Cache-Control", h.cacheControl(status, short.ExpireTime))
+	return c.Redirect(status, short.OriginalURL)
+}
+
+func (h HTTP) preview(c echo.Context, shortCode string) error {
+	short, err := h.Service.Get(c.Request().Context(), shortCode)
+	if err != nil {
+		return h.visitError(c, err)
+	}
+	return h.previewPage(c, short)
+}
+
+// queryFlag reports whether a boolean query param is set, like ?preview=1
+func queryFlag(c echo.Context, name string) bool {
+	value, err := strconv.ParseBool(c.QueryParam(name))
+	return err == nil && value
+}
+
+// cacheControl lets browsers and CDNs keep a permanent redirect until the short url expires, at most redirectMaxAge.
+// Temporary redirects are not stored, so every visit reaches the server and its click is recorded.
+func (h HTTP) cacheControl(status int, expireTime uint64) string {
+	if status != http.StatusMovedPermanently && status != http.StatusPermanentRedirect {
+		return "no-store"
+	}
+	maxAge := int64(expireTime) - h.now().Unix()
+	if limit := int64(h.redirectMaxAge / time.Second); maxAge > limit {
+		maxAge = limit
+	}
+	if maxAge <= 0 {
+		return "no-store"
+	}
+	return "public, max-age=" + strconv.FormatInt(maxAge, 10)
+}
+
+// purpose returns the prefetch hint of a request, browsers send Sec-Purpose and older ones Purpose
+func purpose(req *http.Request) string {
+	if p := req.Header.Get("Sec-Purpose"); p != "" {
+		return p
+	}
+	return req.Header.Get("Purpose")
+}
+
+type updateReq struct {
+	OriginalURL    *string `json:"url"`
+	ExpireTime     *string `json:"expireAt"`
+	RedirectStatus *int    `json:"redirectStatus"`
+	Untrusted      *bool   `json:"untrusted"`
+}
+
+func (h HTTP) update(c echo.Context) error {
+	req := updateReq{}
+	if err := c.Bind(&req); err != nil {
+		err := c.JSON(http.StatusBadRequest, domain.ErrorRespond{Error: err.Error()})
+		return err
+	}
+
+	update := &domain.ShortURLUpdate{OriginalURL: req.OriginalURL, RedirectStatus: req.RedirectStatus, Untrusted: req.Untrusted}
+	if req.ExpireTime != nil {
+		expireTime, err := time.Parse(time.RFC3339, *req.ExpireTime)
+		if err != nil || expireTime.IsZero() {
+			err := c.JSON(http.StatusBadRequest, domain.ErrorRespond{Error: domain.ErrShortURLInvalid.Error()})
+			return err
+		}
+		expireUnix := uint64(expireTime.Unix())
+		update.ExpireTime = &expireUnix
+	}
+
+	short, err := h.Service.Update(c.Request().Context(), c.Param("id"), update)
+	if errors.Is(err, domain.ErrShortURLInvalid) {
+		err := c.JSON(http.StatusBadRequest, domain.ErrorRespond{Error: domain.ErrShortURLInvalid.Error()})
 		return err
 	}
+	if err != nil {
+		return notFoundError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, short)
+}
+
+func (h HTTP) lookup(c echo.Context) error {
+	short, err := h.Service.Lookup(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return notFoundError(c, err)
+	}
+	return c.JSON(http.StatusOK, short)
+}
+
+func (h HTTP) stats(c echo.Context) error {
+	query := &domain.LinkStatsQuery{}
+	var err error
+	if query.From, err = parseTimeParam(c, "from"); err != nil {
+		return statsQueryError(c)
+	}
+	if query.To, err = parseTimeParam(c, "to"); err != nil {
+		return statsQueryError(c)
+	}
+	if top := c.QueryParam("top"); top != "" {
+		if query.Top, err = strconv.Atoi(top); err != nil {
+			return statsQueryError(c)
+		}
+	}
+	if excludeBots := c.QueryParam("excludeBots"); excludeBots != "" {
+		if query.ExcludeBots, err = strconv.ParseBool(excludeBots); err != nil {
+			return statsQueryError(c)
+		}
+	}
+
+	stats, err := h.Service.Stats(c.Request().Context(), c.Param("id"), query)
+	if errors.Is(err, domain.ErrStatsQueryInvalid) {
+		return statsQueryError(c)
+	}
+	if err != nil {
+		return notFoundError(c, err)
+	}
+	return c.JSON(http.StatusOK, stats)
+}
+
+// parseTimeParam returns the unix time of an RFC3339 query param, 0 when it is absent
+func parseTimeParam(c echo.Context, name string) (uint64, error) {
+	value := c.QueryParam(name)
+	if value == "" {
+		return 0, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil || t.Unix() <= 0 {
+		return 0, domain.ErrStatsQueryInvalid
+	}
+	return uint64(t.Unix()), nil
+}
+
+func statsQueryError(c echo.Context) error {
+	return c.JSON(http.StatusBadRequest, domain.ErrorRespond{Error: domain.ErrStatsQueryInvalid.Error()})
+}
+
+type topResp struct {
+	Window string                `json:"window"`
+	URLs   []*domain.TopShortURL `json:"urls"`
+}
 
-	return c.Redirect(http.StatusTemporaryRedirect, short.OriginalURL)
+func (h HTTP) top(c echo.Context) error {
+	window := c.QueryParam("window")
+	if window == "" {
+		window = domain.TopWindowHour
+	}
+	limit := 0
+	if value := c.QueryParam("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil {
+			return c.JSON(http.StatusBadRequest, domain.ErrorRespond{Error: domain.ErrTopQueryInvalid.Error()})
+		}
+	}
+
+	top, err := h.Service.Top(c.Request().Context(), window, limit)
+	if errors.Is(err, domain.ErrTopQueryInvalid) {
+		return c.JSON(http.StatusBadRequest, domain.ErrorRespond{Error: domain.ErrTopQueryInvalid.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, domain.ErrorRespond{Error: http.StatusText(http.StatusInternalServerError)})
+	}
+	return c.JSON(http.StatusOK, topResp{Window: window, URLs: top})
+}
+
+func (h HTTP) events(c echo.Context) error {
+	ctx, cancel := context.WithCancel(c.Request().Context())
+	defer cancel()
+
+	clicks, err := h.Service.Subscribe(ctx, c.Param("id"))
+	if err != nil {
+		return notFoundError(c, err)
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	// stops nginx from buffering the stream
+	res.Header().Set("X-Accel-Buffering", "no")
+	rc := http.NewResponseController(res.Writer)
+	write := func(event string) error {
+		// the server write timeout would cut the stream, so every write pushes the deadline
+		if err := rc.SetWriteDeadline(time.Now().Add(2 * h.heartbeat)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+		if _, err := res.Write([]byte(event)); err != nil {
+			return err
+		}
+		res.Flush()
+		return nil
+	}
+	res.WriteHeader(http.StatusOK)
+	if err := write(": connected\n\n"); err != nil {
+		return nil
+	}
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+	for {
+		var event string
+		select {
+		case <-ctx.Done():
+			// the client went away
+			return nil
+		case <-h.shutdown:
+			return nil
+		case click, ok := <-clicks:
+			if !ok {
+				return nil
+			}
+			data, err := json.Marshal(click)
+			if err != nil {
+				return nil
+			}
+			event = "event: click\ndata: " + string(data) + "\n\n"
+		case <-heartbeat.C:
+			event = ": heartbeat\n\n"
+		}
+		if err := write(event); err != nil {
+			return nil
+		}
+	}
+}
+
+func (h HTTP) export(c echo.Context) error {
+	query := &domain.ClickExportQuery{}
+	var err error
+	if query.From, err = parseTimeParam(c, "from"); err != nil {
+		return exportQueryError(c)
+	}
+	if query.To, err = parseTimeParam(c, "to"); err != nil {
+		return exportQueryError(c)
+	}
+	if excludeBots := c.QueryParam("excludeBots"); excludeBots != "" {
+		if query.ExcludeBots, err = strconv.ParseBool(excludeBots); err != nil {
+			return exportQueryError(c)
+		}
+	}
+	format := c.QueryParam("format")
+	if format == "" {
+		format = exportCSV
+	}
+	if format != exportCSV && format != exportNDJSON {
+		return exportQueryError(c)
+	}
+	kind := c.QueryParam("kind")
+	if kind == "" {
+		kind = domain.ClickExportEvents
+	}
+
+	shortCode := c.Param("id")
+	ctx := c.Request().Context()
+	switch kind {
+	case domain.ClickExportEvents:
+		w := newExportWriter(c, format, shortCode+"-clicks", []string{"time", "referrer", "user_agent", "ip", "bot"})
+		err = h.Service.ExportClicks(ctx, shortCode, query, func(click *domain.Click) error {
+			return w.write(click, []string{
+				formatTime(click.Time), click.Referrer, click.UserAgent, click.IP, strconv.FormatBool(click.Bot),
+			})
+		})
+		return w.finish(err)
+	case domain.ClickExportDaily:
+		w := newExportWriter(c, format, shortCode+"-daily", []string{"day", "clicks"})
+		err = h.Service.ExportDaily(ctx, shortCode, query, func(bucket *domain.StatsBucket) error {
+			return w.write(bucket, []string{
+				time.Unix(int64(bucket.Time), 0).UTC().Format(time.DateOnly), strconv.FormatUint(bucket.Clicks, 10),
+			})
+		})
+		return w.finish(err)
+	default:
+		return exportQueryError(c)
+	}
+}
+
+func exportQueryError(c echo.Context) error {
+	return c.JSON(http.StatusBadRequest, domain.ErrorRespond{Error: domain.ErrExportQueryInvalid.Error()})
+}
+
+func formatTime(unix uint64) string {
+	return time.Unix(int64(unix), 0).UTC().Format(time.RFC3339)
+}
+
+func (h HTTP) delete(c echo.Context) error {
+	err := h.Service.Delete(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return notFoundError(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h HTTP) disable(c echo.Context) error {
+	err := h.Service.Disable(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return notFoundError(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// notFoundError responds 404 for a missing short url and 500 for anything else
+func notFoundError(c echo.Context, err error) error {
+	if errors.Is(err, domain.ErrShortURLNotFound) {
+		return c.JSON(http.StatusNotFound, domain.ErrorRespond{Error: domain.ErrShortURLNotFound.Error()})
+	}
+	return c.JSON(http.StatusInternalServerError, domain.ErrorRespond{Error: http.StatusText(http.StatusInternalServerError)})
 }
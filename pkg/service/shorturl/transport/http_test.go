@@ -1,12 +1,15 @@
 package transport
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
+	"strings"
 	"testing"
 	"time"
 
@@ -33,28 +36,145 @@ var (
 		ExpireTime:  uint64(mockExpireTime.Unix()),
 		CreatedTime: uint64(mockCreatedTime.Unix()),
 	}
-	mockError = errors.New("error")
+	mockError         = errors.New("error")
+	mockConflictAlias = "taken"
+	mockReferrer      = "https://referrer.example"
+	mockClientIP      = "203.0.113.7"
+	mockClick         = &domain.Click{ShortCode: mockShortCode, Time: uint64(mockCreatedTime.Unix()), Referrer: mockReferrer}
+	mockStats         = &domain.LinkStats{
+		ShortCode:      mockShortCode,
+		TotalClicks:    3,
+		UniqueVisitors: 2,
+		Hourly:         []domain.StatsBucket{{Time: uint64(mockCreatedTime.Unix()), Clicks: 3}},
+		Daily:          []domain.StatsBucket{{Time: uint64(mockCreatedTime.Unix()), Clicks: 3}},
+		TopReferrers:   []domain.StatsCount{{Name: "(direct)", Clicks: 3}},
+		TopUserAgents:  []domain.StatsCount{{Name: "Chrome", Clicks: 3}},
+	}
+	mockHumanStats = &domain.LinkStats{ShortCode: mockShortCode, TotalClicks: 1, UniqueVisitors: 1}
 )
 
 var mockShortURLService = &shorturl.MockShortURLService{
-	CreateFunc: func(ctx context.Context, originalURL string, expireTime uint64) (*domain.ShortURL, error) {
-		if originalURL != mockShort.OriginalURL || expireTime != mockShort.ExpireTime {
+	CreateFunc: func(ctx context.Context, req *domain.ShortURLCreate) (*domain.ShortURL, error) {
+		if req.OriginalURL != mockShort.OriginalURL || req.ExpireTime != mockShort.ExpireTime {
 			return nil, mockError
 		}
+		if req.Alias == mockConflictAlias {
+			return nil, domain.ErrShortURLConflict
+		}
 		return mockShort, nil
 	},
 	GetFunc: func(ctx context.Context, shortCode string) (*domain.ShortURL, error) {
 		return mockShort, nil
 	},
+	LookupFunc: func(ctx context.Context, shortCode string) (*domain.ShortURL, error) {
+		if shortCode != mockShortCode {
+			return nil, domain.ErrShortURLNotFound
+		}
+		short := *mockShort
+		short.Status = domain.ShortURLStatusExpired
+		return &short, nil
+	},
+	VisitFunc: func(ctx context.Context, click *domain.Click) (*domain.ShortURL, error) {
+		if click.ShortCode != mockShortCode || click.Referrer != mockReferrer || click.IP != mockClientIP {
+			return nil, mockError
+		}
+		return mockShort, nil
+	},
+	UpdateFunc: func(ctx context.Context, shortCode string, update *domain.ShortURLUpdate) (*domain.ShortURL, error) {
+		if shortCode != mockShortCode {
+			return nil, domain.ErrShortURLNotFound
+		}
+		if update.OriginalURL != nil && *update.OriginalURL == "" {
+			return nil, domain.ErrShortURLInvalid
+		}
+		return mockShort, nil
+	},
+	StatsFunc: func(ctx context.Context, shortCode string, query *domain.LinkStatsQuery) (*domain.LinkStats, error) {
+		if shortCode != mockShortCode {
+			return nil, domain.ErrShortURLNotFound
+		}
+		if query.From > query.To && query.To != 0 {
+			return nil, domain.ErrStatsQueryInvalid
+		}
+		if query.ExcludeBots {
+			return mockHumanStats, nil
+		}
+		return mockStats, nil
+	},
+	TopFunc: func(ctx context.Context, window string, limit int) ([]*domain.TopShortURL, error) {
+		if window != domain.TopWindowHour && window != domain.TopWindowDay {
+			return nil, domain.ErrTopQueryInvalid
+		}
+		return []*domain.TopShortURL{{ShortURL: *mockShort, Clicks: uint64(limit)}}, nil
+	},
+	SubscribeFunc: func(ctx context.Context, shortCode string) (<-chan *domain.Click, error) {
+		if shortCode != mockShortCode {
+			return nil, domain.ErrShortURLNotFound
+		}
+		clicks := make(chan *domain.Click, 1)
+		clicks <- mockClick
+		// the stream stays open until the client or the server goes away
+		go func() {
+			<-ctx.Done()
+			close(clicks)
+		}()
+		return clicks, nil
+	},
+	ExportClicksFunc: func(ctx context.Context, shortCode string, query *domain.ClickExportQuery, fn func(click *domain.Click) error) error {
+		if shortCode != mockShortCode {
+			return domain.ErrShortURLNotFound
+		}
+		if query.From > query.To && query.To != 0 {
+			return domain.ErrExportQueryInvalid
+		}
+		if err := fn(mockClick); err != nil {
+			return err
+		}
+		return fn(&domain.Click{ShortCode: mockShortCode, Time: uint64(mockExpireTime.Unix()), Referrer: "=HYPERLINK(\"https://evil.example\")", UserAgent: "bot, \"quoted\"", Bot: true})
+	},
+	ExportDailyFunc: func(ctx context.Context, shortCode string, query *domain.ClickExportQuery, fn func(bucket *domain.StatsBucket) error) error {
+		if shortCode != mockShortCode {
+			return domain.ErrShortURLNotFound
+		}
+		if query.ExcludeBots {
+			// no clicks still exports the header
+			return nil
+		}
+		return fn(&domain.StatsBucket{Time: uint64(mockCreatedTime.Unix()), Clicks: 3})
+	},
+	DeleteFunc: func(ctx context.Context, shortCode string) error {
+		if shortCode != mockShortCode {
+			return domain.ErrShortURLNotFound
+		}
+		return nil
+	},
+	DisableFunc: func(ctx context.Context, shortCode string) error {
+		if shortCode != mockShortCode {
+			return domain.ErrShortURLNotFound
+		}
+		return nil
+	},
 }
 
 var mockErrShortURLService = &shorturl.MockShortURLService{
-	CreateFunc: func(ctx context.Context, originalURL string, expireTime uint64) (*domain.ShortURL, error) {
+	CreateFunc: func(ctx context.Context, req *domain.ShortURLCreate) (*domain.ShortURL, error) {
 		return nil, mockError
 	},
 	GetFunc: func(ctx context.Context, shortCode string) (*domain.ShortURL, error) {
 		return nil, mockError
 	},
+	VisitFunc: func(ctx context.Context, click *domain.Click) (*domain.ShortURL, error) {
+		return nil, mockError
+	},
+	TopFunc: func(ctx context.Context, window string, limit int) ([]*domain.TopShortURL, error) {
+		return nil, mockError
+	},
+	DeleteFunc: func(ctx context.Context, shortCode string) error {
+		return mockError
+	},
+	DisableFunc: func(ctx context.Context, shortCode string) error {
+		return mockError
+	},
 }
 
 func TestGet(t *testing.T) {
@@ -97,7 +217,8 @@ func TestGet(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			r := server.New()
 			rg := r.Group("")
-			NewHTTP(tt.svc, rg)
+			// the test client connects from loopback, like a proxy setting X-Real-IP
+			NewHTTP(tt.svc, rg, &Config{TrustedProxies: []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")}})
 			ts := httptest.NewServer(r)
 			defer ts.Close()
 
@@ -106,6 +227,8 @@ func TestGet(t *testing.T) {
 			if err != nil {
 				t.Fatal(err)
 			}
+			req.Header.Set("Referer", mockReferrer)
+			req.Header.Set(echo.HeaderXRealIP, mockClientIP)
 
 			client := &http.Client{
 				CheckRedirect: func(req *http.Request, via []*http.Request) error {
@@ -133,14 +256,219 @@ func TestGet(t *testing.T) {
 	}
 }
 
-func TestCreate(t *testing.T) {
+func TestGet_RedirectStatus(t *testing.T) {
+	expireTime := uint64(time.Now().Add(48 * time.Hour).Unix())
+	tests := []struct {
+		name             string
+		redirectStatus   int
+		cfg              *Config
+		wantStatus       int
+		wantCacheControl string
+	}{
+		{
+			name:             "default",
+			wantStatus:       http.StatusTemporaryRedirect,
+			wantCacheControl: "no-store",
+		},
+		{
+			name:             "configured default",
+			cfg:              &Config{RedirectStatus: http.StatusFound},
+			wantStatus:       http.StatusFound,
+			wantCacheControl: "no-store",
+		},
+		{
+			name:             "permanent",
+			redirectStatus:   http.StatusPermanentRedirect,
+			wantStatus:       http.StatusPermanentRedirect,
+			wantCacheControl: "public, max-age=86400",
+		},
+		{
+			name:             "permanent with max age",
+			redirectStatus:   http.StatusMovedPermanently,
+			cfg:              &Config{RedirectStatus: http.StatusFound, RedirectMaxAge: time.Hour},
+			wantStatus:       http.StatusMovedPermanently,
+			wantCacheControl: "public, max-age=3600",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &shorturl.MockShortURLService{
+				VisitFunc: func(ctx context.Context, click *domain.Click) (*domain.ShortURL, error) {
+					return &domain.ShortURL{ShortCode: click.ShortCode, OriginalURL: mockOriginalURL, ExpireTime: expireTime, RedirectStatus: tt.redirectStatus}, nil
+				},
+			}
+			r := server.New()
+			NewHTTP(svc, r.Group(""), tt.cfg)
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+
+			client := &http.Client{
+				CheckRedirect: func(req *http.Request, via []*http.Request) error {
+					return http.ErrUseLastResponse // disable redirect
+				},
+			}
+			res, err := client.Get(ts.URL + "/" + mockShortCode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, res.StatusCode)
+			assert.Equal(t, mockOriginalURL, res.Header.Get(echo.HeaderLocation))
+			assert.Equal(t, tt.wantCacheControl, res.Header.Get("Cache-Control"))
+		})
+	}
+}
+
+func TestCacheControl(t *testing.T) {
+	now := time.Unix(1000, 0)
+	h := HTTP{redirectMaxAge: time.Hour, now: func() time.Time { return now }}
+
+	// bounded by the expiry of the short url
+	assert.Equal(t, "public, max-age=60", h.cacheControl(http.StatusPermanentRedirect, 1060))
+	assert.Equal(t, "public, max-age=3600", h.cacheControl(http.StatusMovedPermanently, 100000))
+	assert.Equal(t, "no-store", h.cacheControl(http.StatusPermanentRedirect, 1000))
+	assert.Equal(t, "no-store", h.cacheControl(http.StatusTemporaryRedirect, 100000))
+}
+
+func TestHead(t *testing.T) {
+	visits := 0
+	svc := &shorturl.MockShortURLService{
+		GetFunc: func(ctx context.Context, shortCode string) (*domain.ShortURL, error) {
+			switch shortCode {
+			case "expired":
+				return nil, domain.ErrShortURLExpired
+			case "missing":
+				return nil, domain.ErrShortURLNotFound
+			}
+			return &domain.ShortURL{ShortCode: shortCode, OriginalURL: mockOriginalURL, RedirectStatus: http.StatusMovedPermanently}, nil
+		},
+		VisitFunc: func(ctx context.Context, click *domain.Click) (*domain.ShortURL, error) {
+			visits++
+			return nil, mockError
+		},
+	}
+	tests := []struct {
+		name         string
+		shortCode    string
+		wantStatus   int
+		wantLocation string
+	}{
+		{
+			name:         "redirect",
+			shortCode:    mockShortCode,
+			wantStatus:   http.StatusMovedPermanently,
+			wantLocation: mockOriginalURL,
+		},
+		{
+			name:       "expired",
+			shortCode:  "expired",
+			wantStatus: http.StatusGone,
+		},
+		{
+			name:       "not found",
+			shortCode:  "missing",
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := server.New()
+			NewHTTP(svc, r.Group(""), nil)
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+
+			client := &http.Client{
+				CheckRedirect: func(req *http.Request, via []*http.Request) error {
+					return http.ErrUseLastResponse // disable redirect
+				},
+			}
+			res, err := client.Head(ts.URL + "/" + tt.shortCode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, res.StatusCode)
+			assert.Equal(t, tt.wantLocation, res.Header.Get(echo.HeaderLocation))
+		})
+	}
+	// no click is recorded
+	assert.Equal(t, 0, visits)
+}
+
+func TestLookup(t *testing.T) {
 	tests := []struct {
 		name        string
-		req         createReq
+		id          string
 		wantStatus  int
-		wantResp    *createResp
+		wantResp    *domain.ShortURL
 		wantErrResp *domain.ErrorRespond
-		svc         domain.ShortURLService
+	}{
+		{
+			name:       "expired short url",
+			id:         mockShortCode,
+			wantStatus: http.StatusOK,
+			wantResp: &domain.ShortURL{
+				ShortCode:   mockShortCode,
+				OriginalURL: mockOriginalURL,
+				ShortURL:    mockShortURL,
+				ExpireTime:  uint64(mockExpireTime.Unix()),
+				CreatedTime: uint64(mockCreatedTime.Unix()),
+				Status:      domain.ShortURLStatusExpired,
+			},
+		},
+		{
+			name:        "not found",
+			id:          "not-exist",
+			wantStatus:  http.StatusNotFound,
+			wantErrResp: &domain.ErrorRespond{Error: domain.ErrShortURLNotFound.Error()},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := server.New()
+			NewHTTP(mockShortURLService, r.Group(""), nil)
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+
+			res, err := http.Get(ts.URL + "/api/v1/urls/" + tt.id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, res.StatusCode)
+			if tt.wantResp != nil {
+				response := new(domain.ShortURL)
+				if err := json.NewDecoder(res.Body).Decode(response); err != nil {
+					t.Fatal(err)
+				}
+				assert.Equal(t, tt.wantResp, response)
+			}
+			if tt.wantErrResp != nil {
+				response := new(domain.ErrorRespond)
+				if err := json.NewDecoder(res.Body).Decode(response); err != nil {
+					t.Fatal(err)
+				}
+				assert.Equal(t, tt.wantErrResp, response)
+			}
+		})
+	}
+}
+
+func TestCreate(t *testing.T) {
+	tests := []struct {
+		name           string
+		req            createReq
+		idempotencyKey string
+		wantStatus     int
+		wantResp       *createResp
+		wantErrResp    *domain.ErrorRespond
+		svc            domain.ShortURLService
 	}{
 		{
 			name: "normal",
@@ -179,13 +507,145 @@ func TestCreate(t *testing.T) {
 			},
 			svc: mockErrShortURLService,
 		},
+		{
+			name: "alias",
+			req: createReq{
+				OriginalURL: mockOriginalURL,
+				ExpireTime:  mockExpireTimeString,
+				Alias:       "spring-sale",
+			},
+			wantStatus: http.StatusOK,
+			wantResp: &createResp{
+				ShortCode: mockShortCode,
+				ShortURL:  mockShortURL,
+			},
+			svc: mockShortURLService,
+		},
+		{
+			name: "alias conflict",
+			req: createReq{
+				OriginalURL: mockOriginalURL,
+				ExpireTime:  mockExpireTimeString,
+				Alias:       mockConflictAlias,
+			},
+			wantStatus: http.StatusConflict,
+			wantErrResp: &domain.ErrorRespond{
+				Error: domain.ErrShortURLConflict.Error(),
+			},
+			svc: mockShortURLService,
+		},
+		{
+			name: "machine id unavailable",
+			req: createReq{
+				OriginalURL: mockOriginalURL,
+				ExpireTime:  mockExpireTimeString,
+			},
+			wantStatus: http.StatusServiceUnavailable,
+			wantErrResp: &domain.ErrorRespond{
+				Error: domain.ErrShortURLUnavailable.Error(),
+			},
+			svc: &shorturl.MockShortURLService{
+				CreateFunc: func(ctx context.Context, req *domain.ShortURLCreate) (*domain.ShortURL, error) {
+					return nil, domain.ErrShortURLUnavailable
+				},
+			},
+		},
+		{
+			name: "idempotency key",
+			req: createReq{
+				OriginalURL: mockOriginalURL,
+				ExpireTime:  mockExpireTimeString,
+			},
+			idempotencyKey: "retry-1",
+			wantStatus:     http.StatusOK,
+			wantResp: &createResp{
+				ShortCode: mockShortCode,
+				ShortURL:  mockShortURL,
+			},
+			svc: &shorturl.MockShortURLService{
+				CreateFunc: func(ctx context.Context, req *domain.ShortURLCreate) (*domain.ShortURL, error) {
+					if req.IdempotencyKey != "retry-1" {
+						return nil, mockError
+					}
+					return mockShort, nil
+				},
+			},
+		},
+		{
+			name: "dedupe",
+			req: createReq{
+				OriginalURL: mockOriginalURL,
+				ExpireTime:  mockExpireTimeString,
+				Dedupe:      true,
+			},
+			wantStatus: http.StatusOK,
+			wantResp: &createResp{
+				ShortCode: mockShortCode,
+				ShortURL:  mockShortURL,
+			},
+			svc: &shorturl.MockShortURLService{
+				CreateFunc: func(ctx context.Context, req *domain.ShortURLCreate) (*domain.ShortURL, error) {
+					if !req.Dedupe {
+						return nil, mockError
+					}
+					return mockShort, nil
+				},
+			},
+		},
+		{
+			name: "idempotency key reused",
+			req: createReq{
+				OriginalURL: mockOriginalURL,
+				ExpireTime:  mockExpireTimeString,
+			},
+			idempotencyKey: "retry-1",
+			wantStatus:     http.StatusUnprocessableEntity,
+			wantErrResp: &domain.ErrorRespond{
+				Error: domain.ErrIdempotencyKeyReused.Error(),
+			},
+			svc: &shorturl.MockShortURLService{
+				CreateFunc: func(ctx context.Context, req *domain.ShortURLCreate) (*domain.ShortURL, error) {
+					return nil, domain.ErrIdempotencyKeyReused
+				},
+			},
+		},
+		{
+			name: "idempotency key in progress",
+			req: createReq{
+				OriginalURL: mockOriginalURL,
+				ExpireTime:  mockExpireTimeString,
+			},
+			idempotencyKey: "retry-1",
+			wantStatus:     http.StatusConflict,
+			wantErrResp: &domain.ErrorRespond{
+				Error: domain.ErrIdempotencyInProgress.Error(),
+			},
+			svc: &shorturl.MockShortURLService{
+				CreateFunc: func(ctx context.Context, req *domain.ShortURLCreate) (*domain.ShortURL, error) {
+					return nil, domain.ErrIdempotencyInProgress
+				},
+			},
+		},
+		{
+			name: "idempotency key too long",
+			req: createReq{
+				OriginalURL: mockOriginalURL,
+				ExpireTime:  mockExpireTimeString,
+			},
+			idempotencyKey: strings.Repeat("k", 256),
+			wantStatus:     http.StatusBadRequest,
+			wantErrResp: &domain.ErrorRespond{
+				Error: domain.ErrIdempotencyKeyInvalid.Error(),
+			},
+			svc: mockShortURLService,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			r := server.New()
 			rg := r.Group("")
-			NewHTTP(tt.svc, rg)
+			NewHTTP(tt.svc, rg, nil)
 			ts := httptest.NewServer(r)
 			defer ts.Close()
 			path := ts.URL + "/api/v1/urls"
@@ -198,6 +658,9 @@ func TestCreate(t *testing.T) {
 				t.Fatal(err)
 			}
 			req.Header.Set("Content-Type", "application/json")
+			if tt.idempotencyKey != "" {
+				req.Header.Set("Idempotency-Key", tt.idempotencyKey)
+			}
 			res, err := http.DefaultClient.Do(req)
 			if err != nil {
 				t.Fatal(err)
@@ -221,3 +684,726 @@ func TestCreate(t *testing.T) {
 		})
 	}
 }
+
+func TestCreateBatch(t *testing.T) {
+	svc := &shorturl.MockShortURLService{
+		CreateBatchFunc: func(ctx context.Context, reqs []*domain.ShortURLCreate) ([]*domain.ShortURLBatchResult, error) {
+			results := make([]*domain.ShortURLBatchResult, len(reqs))
+			for i, req := range reqs {
+				switch {
+				case req.OriginalURL == "fail":
+					return nil, mockError
+				case req.Alias == mockConflictAlias:
+					results[i] = &domain.ShortURLBatchResult{Err: domain.ErrShortURLConflict}
+				default:
+					results[i] = &domain.ShortURLBatchResult{ShortURL: mockShort}
+				}
+			}
+			return results, nil
+		},
+	}
+	tests := []struct {
+		name        string
+		body        string
+		wantStatus  int
+		wantResp    *batchResp
+		wantErrResp *domain.ErrorRespond
+	}{
+		{
+			name: "per item results",
+			body: `[{"url": "` + mockOriginalURL + `", "expireAt": "` + mockExpireTimeString + `"},` +
+				`{"url": "` + mockOriginalURL + `", "expireAt": "tomorrow"},` +
+				`{"url": "` + mockOriginalURL + `", "expireAt": "` + mockExpireTimeString + `", "alias": "` + mockConflictAlias + `"}]`,
+			wantStatus: http.StatusOK,
+			wantResp: &batchResp{Results: []batchItemResp{
+				{ShortCode: mockShortCode, ShortURL: mockShortURL},
+				{Error: domain.ErrShortURLInvalid.Error()},
+				{Error: domain.ErrShortURLConflict.Error()},
+			}},
+		},
+		{
+			name:       "nothing valid",
+			body:       `[{"url": "` + mockOriginalURL + `"}]`,
+			wantStatus: http.StatusOK,
+			wantResp:   &batchResp{Results: []batchItemResp{{Error: domain.ErrShortURLInvalid.Error()}}},
+		},
+		{
+			name:        "empty",
+			body:        `[]`,
+			wantStatus:  http.StatusBadRequest,
+			wantErrResp: &domain.ErrorRespond{Error: domain.ErrShortURLInvalid.Error()},
+		},
+		{
+			name:        "too large",
+			body:        `[{}, {}, {}, {}]`,
+			wantStatus:  http.StatusRequestEntityTooLarge,
+			wantErrResp: &domain.ErrorRespond{Error: domain.ErrBatchTooLarge.Error()},
+		},
+		{
+			name:        "body too large",
+			body:        `[{"url": "` + strings.Repeat("a", 3*maxBatchItemBytes) + `"}]`,
+			wantStatus:  http.StatusRequestEntityTooLarge,
+			wantErrResp: &domain.ErrorRespond{Error: domain.ErrBatchTooLarge.Error()},
+		},
+		{
+			name:        "batch failure",
+			body:        `[{"url": "fail", "expireAt": "` + mockExpireTimeString + `"}]`,
+			wantStatus:  http.StatusBadRequest,
+			wantErrResp: &domain.ErrorRespond{Error: domain.ErrShortURLInvalid.Error()},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := server.New()
+			NewHTTP(svc, r.Group(""), &Config{MaxBatchSize: 3})
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+
+			res, err := http.Post(ts.URL+"/api/v1/urls:batch", echo.MIMEApplicationJSON, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, res.StatusCode)
+			if tt.wantResp != nil {
+				response := new(batchResp)
+				if err := json.NewDecoder(res.Body).Decode(response); err != nil {
+					t.Fatal(err)
+				}
+				assert.Equal(t, tt.wantResp, response)
+			}
+			if tt.wantErrResp != nil {
+				response := new(domain.ErrorRespond)
+				if err := json.NewDecoder(res.Body).Decode(response); err != nil {
+					t.Fatal(err)
+				}
+				assert.Equal(t, tt.wantErrResp, response)
+			}
+		})
+	}
+}
+
+func TestAction_NotFound(t *testing.T) {
+	r := server.New()
+	NewHTTP(mockShortURLService, r.Group(""), nil)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	res, err := http.Post(ts.URL+"/api/v1/urls:unknown", echo.MIMEApplicationJSON, strings.NewReader(`[]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+}
+
+func TestDeleteAndDisable(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		wantStatus  int
+		wantErrResp *domain.ErrorRespond
+		svc         domain.ShortURLService
+	}{
+		{
+			name:       "delete",
+			method:     http.MethodDelete,
+			path:       "/api/v1/urls/" + mockShortCode,
+			wantStatus: http.StatusNoContent,
+			svc:        mockShortURLService,
+		},
+		{
+			name:       "delete not found",
+			method:     http.MethodDelete,
+			path:       "/api/v1/urls/not-exist",
+			wantStatus: http.StatusNotFound,
+			wantErrResp: &domain.ErrorRespond{
+				Error: domain.ErrShortURLNotFound.Error(),
+			},
+			svc: mockShortURLService,
+		},
+		{
+			name:       "delete repo error",
+			method:     http.MethodDelete,
+			path:       "/api/v1/urls/" + mockShortCode,
+			wantStatus: http.StatusInternalServerError,
+			wantErrResp: &domain.ErrorRespond{
+				Error: http.StatusText(http.StatusInternalServerError),
+			},
+			svc: mockErrShortURLService,
+		},
+		{
+			name:       "disable",
+			method:     http.MethodPost,
+			path:       "/api/v1/urls/" + mockShortCode + "/disable",
+			wantStatus: http.StatusNoContent,
+			svc:        mockShortURLService,
+		},
+		{
+			name:       "disable not found",
+			method:     http.MethodPost,
+			path:       "/api/v1/urls/not-exist/disable",
+			wantStatus: http.StatusNotFound,
+			wantErrResp: &domain.ErrorRespond{
+				Error: domain.ErrShortURLNotFound.Error(),
+			},
+			svc: mockShortURLService,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := server.New()
+			rg := r.Group("")
+			NewHTTP(tt.svc, rg, nil)
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+
+			req, err := http.NewRequest(tt.method, ts.URL+tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, res.StatusCode)
+			if tt.wantErrResp != nil {
+				response := new(domain.ErrorRespond)
+				if err := json.NewDecoder(res.Body).Decode(response); err != nil {
+					t.Fatal(err)
+				}
+				assert.Equal(t, tt.wantErrResp, response)
+			}
+		})
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        string
+		body        string
+		wantStatus  int
+		wantResp    *domain.ShortURL
+		wantErrResp *domain.ErrorRespond
+		svc         domain.ShortURLService
+	}{
+		{
+			name:       "normal",
+			path:       "/api/v1/urls/" + mockShortCode,
+			body:       `{"url": "https://example.com", "expireAt": "` + mockExpireTimeString + `"}`,
+			wantStatus: http.StatusOK,
+			wantResp:   mockShort,
+			svc:        mockShortURLService,
+		},
+		{
+			name:       "invalid time",
+			path:       "/api/v1/urls/" + mockShortCode,
+			body:       `{"expireAt": "invalid time"}`,
+			wantStatus: http.StatusBadRequest,
+			wantErrResp: &domain.ErrorRespond{
+				Error: domain.ErrShortURLInvalid.Error(),
+			},
+			svc: mockShortURLService,
+		},
+		{
+			name:       "invalid url",
+			path:       "/api/v1/urls/" + mockShortCode,
+			body:       `{"url": ""}`,
+			wantStatus: http.StatusBadRequest,
+			wantErrResp: &domain.ErrorRespond{
+				Error: domain.ErrShortURLInvalid.Error(),
+			},
+			svc: mockShortURLService,
+		},
+		{
+			name:       "not found",
+			path:       "/api/v1/urls/not-exist",
+			body:       `{"url": "https://example.com"}`,
+			wantStatus: http.StatusNotFound,
+			wantErrResp: &domain.ErrorRespond{
+				Error: domain.ErrShortURLNotFound.Error(),
+			},
+			svc: mockShortURLService,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := server.New()
+			rg := r.Group("")
+			NewHTTP(tt.svc, rg, nil)
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+
+			req, err := http.NewRequest(http.MethodPatch, ts.URL+tt.path, bytes.NewBufferString(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, res.StatusCode)
+			if tt.wantResp != nil {
+				response := new(domain.ShortURL)
+				if err := json.NewDecoder(res.Body).Decode(response); err != nil {
+					t.Fatal(err)
+				}
+				assert.Equal(t, tt.wantResp, response)
+			}
+			if tt.wantErrResp != nil {
+				response := new(domain.ErrorRespond)
+				if err := json.NewDecoder(res.Body).Decode(response); err != nil {
+					t.Fatal(err)
+				}
+				assert.Equal(t, tt.wantErrResp, response)
+			}
+		})
+	}
+}
+
+func TestStats(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        string
+		wantStatus  int
+		wantResp    *domain.LinkStats
+		wantErrResp *domain.ErrorRespond
+	}{
+		{
+			name:       "normal",
+			path:       "/api/v1/urls/" + mockShortCode + "/stats",
+			wantStatus: http.StatusOK,
+			wantResp:   mockStats,
+		},
+		{
+			name:       "with range",
+			path:       "/api/v1/urls/" + mockShortCode + "/stats?from=" + mockCreatedTimeString + "&to=" + mockExpireTimeString + "&top=5",
+			wantStatus: http.StatusOK,
+			wantResp:   mockStats,
+		},
+		{
+			name:       "exclude bots",
+			path:       "/api/v1/urls/" + mockShortCode + "/stats?excludeBots=true",
+			wantStatus: http.StatusOK,
+			wantResp:   mockHumanStats,
+		},
+		{
+			name:       "invalid exclude bots",
+			path:       "/api/v1/urls/" + mockShortCode + "/stats?excludeBots=maybe",
+			wantStatus: http.StatusBadRequest,
+			wantErrResp: &domain.ErrorRespond{
+				Error: domain.ErrStatsQueryInvalid.Error(),
+			},
+		},
+		{
+			name:       "invalid time",
+			path:       "/api/v1/urls/" + mockShortCode + "/stats?from=yesterday",
+			wantStatus: http.StatusBadRequest,
+			wantErrResp: &domain.ErrorRespond{
+				Error: domain.ErrStatsQueryInvalid.Error(),
+			},
+		},
+		{
+			name:       "invalid top",
+			path:       "/api/v1/urls/" + mockShortCode + "/stats?top=many",
+			wantStatus: http.StatusBadRequest,
+			wantErrResp: &domain.ErrorRespond{
+				Error: domain.ErrStatsQueryInvalid.Error(),
+			},
+		},
+		{
+			name:       "reversed range",
+			path:       "/api/v1/urls/" + mockShortCode + "/stats?from=" + mockExpireTimeString + "&to=" + mockCreatedTimeString,
+			wantStatus: http.StatusBadRequest,
+			wantErrResp: &domain.ErrorRespond{
+				Error: domain.ErrStatsQueryInvalid.Error(),
+			},
+		},
+		{
+			name:       "not found",
+			path:       "/api/v1/urls/not-exist/stats",
+			wantStatus: http.StatusNotFound,
+			wantErrResp: &domain.ErrorRespond{
+				Error: domain.ErrShortURLNotFound.Error(),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := server.New()
+			rg := r.Group("")
+			NewHTTP(mockShortURLService, rg, nil)
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+
+			res, err := http.Get(ts.URL + tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, res.StatusCode)
+			if tt.wantResp != nil {
+				response := new(domain.LinkStats)
+				if err := json.NewDecoder(res.Body).Decode(response); err != nil {
+					t.Fatal(err)
+				}
+				assert.Equal(t, tt.wantResp, response)
+			}
+			if tt.wantErrResp != nil {
+				response := new(domain.ErrorRespond)
+				if err := json.NewDecoder(res.Body).Decode(response); err != nil {
+					t.Fatal(err)
+				}
+				assert.Equal(t, tt.wantErrResp, response)
+			}
+		})
+	}
+}
+
+func TestExport(t *testing.T) {
+	tests := []struct {
+		name            string
+		query           string
+		id              string
+		wantStatus      int
+		wantContentType string
+		wantBody        string
+		wantErrResp     *domain.ErrorRespond
+	}{
+		{
+			name:            "csv events",
+			query:           "",
+			wantStatus:      http.StatusOK,
+			wantContentType: "text/csv; charset=utf-8",
+			wantBody: "time,referrer,user_agent,ip,bot\n" +
+				mockCreatedTimeString + "," + mockReferrer + ",,,false\n" +
+				mockExpireTimeString + `,"'=HYPERLINK(""https://evil.example"")","bot, ""quoted""",,true` + "\n",
+		},
+		{
+			name:            "ndjson events",
+			query:           "?format=ndjson&from=" + mockCreatedTimeString + "&to=" + mockExpireTimeString,
+			wantStatus:      http.StatusOK,
+			wantContentType: "application/x-ndjson",
+			wantBody: `{"shortCode":"test-short-code","time":1735689600,"referrer":"https://referrer.example","userAgent":"","ip":"","bot":false}` + "\n" +
+				`{"shortCode":"test-short-code","time":1735693200,"referrer":"=HYPERLINK(\"https://evil.example\")","userAgent":"bot, \"quoted\"","ip":"","bot":true}` + "\n",
+		},
+		{
+			name:            "csv daily",
+			query:           "?kind=daily",
+			wantStatus:      http.StatusOK,
+			wantContentType: "text/csv; charset=utf-8",
+			wantBody:        "day,clicks\n2025-01-01,3\n",
+		},
+		{
+			name:            "empty daily",
+			query:           "?kind=daily&excludeBots=true",
+			wantStatus:      http.StatusOK,
+			wantContentType: "text/csv; charset=utf-8",
+			wantBody:        "day,clicks\n",
+		},
+		{
+			name:            "ndjson daily",
+			query:           "?kind=daily&format=ndjson",
+			wantStatus:      http.StatusOK,
+			wantContentType: "application/x-ndjson",
+			wantBody:        `{"time":1735689600,"clicks":3}` + "\n",
+		},
+		{
+			name:        "invalid format",
+			query:       "?format=xlsx",
+			wantStatus:  http.StatusBadRequest,
+			wantErrResp: &domain.ErrorRespond{Error: domain.ErrExportQueryInvalid.Error()},
+		},
+		{
+			name:        "invalid kind",
+			query:       "?kind=hourly",
+			wantStatus:  http.StatusBadRequest,
+			wantErrResp: &domain.ErrorRespond{Error: domain.ErrExportQueryInvalid.Error()},
+		},
+		{
+			name:        "reversed range",
+			query:       "?from=" + mockExpireTimeString + "&to=" + mockCreatedTimeString,
+			wantStatus:  http.StatusBadRequest,
+			wantErrResp: &domain.ErrorRespond{Error: domain.ErrExportQueryInvalid.Error()},
+		},
+		{
+			name:        "not found",
+			id:          "not-exist",
+			wantStatus:  http.StatusNotFound,
+			wantErrResp: &domain.ErrorRespond{Error: domain.ErrShortURLNotFound.Error()},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := server.New()
+			rg := r.Group("")
+			NewHTTP(mockShortURLService, rg, nil)
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+
+			id := tt.id
+			if id == "" {
+				id = mockShortCode
+			}
+			res, err := http.Get(ts.URL + "/api/v1/urls/" + id + "/clicks/export" + tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, res.StatusCode)
+			if tt.wantErrResp != nil {
+				response := new(domain.ErrorRespond)
+				if err := json.NewDecoder(res.Body).Decode(response); err != nil {
+					t.Fatal(err)
+				}
+				assert.Equal(t, tt.wantErrResp, response)
+				return
+			}
+			assert.Equal(t, tt.wantContentType, res.Header.Get(echo.HeaderContentType))
+			assert.Contains(t, res.Header.Get(echo.HeaderContentDisposition), "attachment")
+			body := new(bytes.Buffer)
+			if _, err := body.ReadFrom(res.Body); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tt.wantBody, body.String())
+		})
+	}
+}
+
+func TestTop(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		wantStatus  int
+		wantResp    *topResp
+		wantErrResp *domain.ErrorRespond
+		svc         domain.ShortURLService
+	}{
+		{
+			name:       "default window",
+			query:      "",
+			wantStatus: http.StatusOK,
+			wantResp:   &topResp{Window: domain.TopWindowHour, URLs: []*domain.TopShortURL{{ShortURL: *mockShort, Clicks: 0}}},
+			svc:        mockShortURLService,
+		},
+		{
+			name:       "window and limit",
+			query:      "?window=1d&limit=50",
+			wantStatus: http.StatusOK,
+			wantResp:   &topResp{Window: domain.TopWindowDay, URLs: []*domain.TopShortURL{{ShortURL: *mockShort, Clicks: 50}}},
+			svc:        mockShortURLService,
+		},
+		{
+			name:       "invalid window",
+			query:      "?window=1y",
+			wantStatus: http.StatusBadRequest,
+			wantErrResp: &domain.ErrorRespond{
+				Error: domain.ErrTopQueryInvalid.Error(),
+			},
+			svc: mockShortURLService,
+		},
+		{
+			name:       "invalid limit",
+			query:      "?limit=all",
+			wantStatus: http.StatusBadRequest,
+			wantErrResp: &domain.ErrorRespond{
+				Error: domain.ErrTopQueryInvalid.Error(),
+			},
+			svc: mockShortURLService,
+		},
+		{
+			name:       "service error",
+			wantStatus: http.StatusInternalServerError,
+			wantErrResp: &domain.ErrorRespond{
+				Error: http.StatusText(http.StatusInternalServerError),
+			},
+			svc: mockErrShortURLService,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := server.New()
+			rg := r.Group("")
+			NewHTTP(tt.svc, rg, nil)
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+
+			res, err := http.Get(ts.URL + "/api/v1/urls/top" + tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, res.StatusCode)
+			if tt.wantResp != nil {
+				response := new(topResp)
+				if err := json.NewDecoder(res.Body).Decode(response); err != nil {
+					t.Fatal(err)
+				}
+				assert.Equal(t, tt.wantResp, response)
+			}
+			if tt.wantErrResp != nil {
+				response := new(domain.ErrorRespond)
+				if err := json.NewDecoder(res.Body).Decode(response); err != nil {
+					t.Fatal(err)
+				}
+				assert.Equal(t, tt.wantErrResp, response)
+			}
+		})
+	}
+}
+
+func TestEvents(t *testing.T) {
+	r := server.New()
+	rg := r.Group("")
+	shutdown := make(chan struct{})
+	NewHTTP(mockShortURLService, rg, &Config{Shutdown: shutdown, Heartbeat: 10 * time.Millisecond})
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/api/v1/urls/" + mockShortCode + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "text/event-stream", res.Header.Get(echo.HeaderContentType))
+
+	data, err := json.Marshal(mockClick)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := bufio.NewReader(res.Body)
+	lines := []string{}
+	for len(lines) < 6 {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, strings.TrimSuffix(line, "\n"))
+	}
+	assert.Equal(t, []string{": connected", "", "event: click", "data: " + string(data), "", ": heartbeat"}, lines)
+
+	// the stream ends when the server shuts down
+	close(shutdown)
+	done := make(chan struct{})
+	go func() {
+		for {
+			if _, err := reader.ReadString('\n'); err != nil {
+				close(done)
+				return
+			}
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("event stream kept open after shutdown")
+	}
+}
+
+func TestEvents_NotFound(t *testing.T) {
+	r := server.New()
+	rg := r.Group("")
+	NewHTTP(mockShortURLService, rg, nil)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/api/v1/urls/not-exist/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+}
+
+func TestClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.0/8", "2001:db8::/32"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ParseTrustedProxies([]string{"10.0.0.1"})
+	assert.Error(t, err)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		realIP     string
+		want       string
+	}{
+		{
+			name:       "direct client",
+			remoteAddr: "203.0.113.7:1234",
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "headers of an untrusted client are ignored",
+			remoteAddr: "203.0.113.7:1234",
+			forwarded:  "198.51.100.1",
+			realIP:     "198.51.100.2",
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "through a trusted proxy",
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  "198.51.100.1",
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "hops left of the client are made up",
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  "192.0.2.1, 198.51.100.1, 10.0.0.2",
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "only proxies",
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  "10.0.0.3, 10.0.0.2",
+			want:       "10.0.0.3",
+		},
+		{
+			name:       "garbage stops the walk",
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  "198.51.100.1, unknown",
+			want:       "10.0.0.1",
+		},
+		{
+			name:       "real ip of a trusted proxy",
+			remoteAddr: "[2001:db8::1]:1234",
+			realIP:     "198.51.100.2",
+			want:       "198.51.100.2",
+		},
+	}
+
+	h := HTTP{trustedProxies: proxies}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				req.Header.Set(echo.HeaderXForwardedFor, tt.forwarded)
+			}
+			if tt.realIP != "" {
+				req.Header.Set(echo.HeaderXRealIP, tt.realIP)
+			}
+			assert.Equal(t, tt.want, h.clientIP(req))
+		})
+	}
+}
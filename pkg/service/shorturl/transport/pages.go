@@ -0,0 +1,164 @@
+package transport
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+
+	"github.com/sappy5678/dcard/pkg/domain"
+)
+
+//go:embed pages/*.html
+var pageFiles embed.FS
+
+var (
+	// defaultPage is rendered for every status without a page of its own
+	defaultPage        = template.Must(template.ParseFS(pageFiles, "pages/error.html"))
+	defaultPreviewPage = template.Must(template.ParseFS(pageFiles, "pages/preview.html"))
+)
+
+// Pages renders the HTML pages browsers get instead of JSON errors, and the preview of short urls
+type Pages struct {
+	byStatus map[int]*template.Template
+	preview  *template.Template
+}
+
+// pageData is what a page template is executed with
+type pageData struct {
+	Status    int
+	Title     string
+	Message   string
+	ShortCode string
+}
+
+// previewData is what the preview template is executed with
+type previewData struct {
+	ShortCode   string
+	ShortURL    string
+	OriginalURL string
+	CreatedTime time.Time
+	ExpireTime  time.Time
+	Untrusted   bool
+	// ContinueURL follows the short url, with a confirm token skipping the interstitial of an untrusted one
+	ContinueURL string
+}
+
+// LoadPages parses a html/template file for each status, other statuses get the built in page.
+// The preview page is built in too unless previewFile is set.
+func LoadPages(files map[int]string, previewFile string) (*Pages, error) {
+	p := &Pages{byStatus: make(map[int]*template.Template, len(files)), preview: defaultPreviewPage}
+	for status, file := range files {
+		tmpl, err := template.ParseFiles(file)
+		if err != nil {
+			return nil, err
+		}
+		p.byStatus[status] = tmpl
+	}
+	if previewFile != "" {
+		tmpl, err := template.ParseFiles(previewFile)
+		if err != nil {
+			return nil, err
+		}
+		p.preview = tmpl
+	}
+	return p, nil
+}
+
+func (p *Pages) render(status int, data pageData) ([]byte, error) {
+	tmpl := defaultPage
+	if p != nil && p.byStatus[status] != nil {
+		tmpl = p.byStatus[status]
+	}
+	return execute(tmpl, data)
+}
+
+func (p *Pages) renderPreview(data previewData) ([]byte, error) {
+	tmpl := defaultPreviewPage
+	if p != nil && p.preview != nil {
+		tmpl = p.preview
+	}
+	return execute(tmpl, data)
+}
+
+func execute(tmpl *template.Template, data any) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if err := tmpl.Execute(buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// previewPage shows where a short url goes instead of redirecting, it records no click
+func (h HTTP) previewPage(c echo.Context, short *domain.ShortURL) error {
+	continueURL := "/" + short.ShortCode
+	if short.Untrusted {
+		continueURL += "?" + confirmParam + "=" + url.QueryEscape(h.confirmToken(short.ShortCode))
+	}
+	page, err := h.pages.renderPreview(previewData{
+		ShortCode:   short.ShortCode,
+		ShortURL:    short.ShortURL,
+		OriginalURL: short.OriginalURL,
+		CreatedTime: time.Unix(int64(short.CreatedTime), 0).UTC(),
+		ExpireTime:  time.Unix(int64(short.ExpireTime), 0).UTC(),
+		Untrusted:   short.Untrusted,
+		ContinueURL: continueURL,
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, domain.ErrorRespond{Error: http.StatusText(http.StatusInternalServerError)})
+	}
+	// the destination or the flag may change, so the page must not outlive them
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.HTMLBlob(http.StatusOK, page)
+}
+
+// errorPage responds with the page of status to browsers and with domain.ErrorRespond to API clients
+func (h HTTP) errorPage(c echo.Context, status int, err error) error {
+	// the body depends on Accept, so shared caches must not answer browsers with JSON or API clients with HTML
+	c.Response().Header().Add(echo.HeaderVary, echo.HeaderAccept)
+	if !acceptsHTML(c.Request()) {
+		return c.JSON(status, domain.ErrorRespond{Error: err.Error()})
+	}
+	page, renderErr := h.pages.render(status, pageData{
+		Status:    status,
+		Title:     http.StatusText(status),
+		Message:   err.Error(),
+		ShortCode: c.Param("shortCode"),
+	})
+	if renderErr != nil {
+		return c.JSON(status, domain.ErrorRespond{Error: err.Error()})
+	}
+	return c.HTMLBlob(status, page)
+}
+
+// acceptsHTML reports whether a request prefers HTML over JSON. Only an explicit text/html counts,
+// so API clients sending */* or nothing keep getting JSON.
+func acceptsHTML(req *http.Request) bool {
+	var htmlQ, jsonQ float64
+	for _, part := range strings.Split(req.Header.Get(echo.HeaderAccept), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+		switch mediaType {
+		case echo.MIMETextHTML, "application/xhtml+xml":
+			htmlQ = max(htmlQ, q)
+		case echo.MIMEApplicationJSON:
+			jsonQ = max(jsonQ, q)
+		}
+	}
+	return htmlQ > 0 && htmlQ >= jsonQ
+}
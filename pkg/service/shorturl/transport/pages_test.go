@@ -0,0 +1,358 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"html"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sappy5678/dcard/pkg/domain"
+	"github.com/sappy5678/dcard/pkg/service/shorturl"
+	"github.com/sappy5678/dcard/pkg/utl/server"
+)
+
+const browserAccept = "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+
+func TestGet_ErrorPages(t *testing.T) {
+	dir := t.TempDir()
+	gonePage := filepath.Join(dir, "410.html")
+	if err := os.WriteFile(gonePage, []byte("<p>{{.ShortCode}} is gone</p>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	pages, err := LoadPages(map[int]string{http.StatusGone: gonePage}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := &shorturl.MockShortURLService{
+		VisitFunc: func(ctx context.Context, click *domain.Click) (*domain.ShortURL, error) {
+			if click.ShortCode == "expired" {
+				return nil, domain.ErrShortURLExpired
+			}
+			return nil, domain.ErrShortURLNotFound
+		},
+	}
+
+	tests := []struct {
+		name        string
+		shortCode   string
+		accept      string
+		wantStatus  int
+		wantBody    string
+		wantErrResp *domain.ErrorRespond
+	}{
+		{
+			name:        "expired api client",
+			shortCode:   "expired",
+			wantStatus:  http.StatusGone,
+			wantErrResp: &domain.ErrorRespond{Error: domain.ErrShortURLExpired.Error()},
+		},
+		{
+			name:       "expired browser",
+			shortCode:  "expired",
+			accept:     browserAccept,
+			wantStatus: http.StatusGone,
+			wantBody:   "<p>expired is gone</p>",
+		},
+		{
+			name:        "not found json preferred",
+			shortCode:   "missing",
+			accept:      "application/json, text/html;q=0.5",
+			wantStatus:  http.StatusNotFound,
+			wantErrResp: &domain.ErrorRespond{Error: domain.ErrShortURLNotFound.Error()},
+		},
+		{
+			name:       "not found browser",
+			shortCode:  "missing",
+			accept:     browserAccept,
+			wantStatus: http.StatusNotFound,
+			wantBody:   "<h1>Not Found</h1>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := server.New()
+			NewHTTP(svc, r.Group(""), &Config{Pages: pages})
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+
+			req, err := http.NewRequest(http.MethodGet, ts.URL+"/"+tt.shortCode, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.accept != "" {
+				req.Header.Set(echo.HeaderAccept, tt.accept)
+			}
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, res.StatusCode)
+			assert.Contains(t, res.Header.Values(echo.HeaderVary), echo.HeaderAccept)
+			if tt.wantErrResp != nil {
+				response := new(domain.ErrorRespond)
+				if err := json.NewDecoder(res.Body).Decode(response); err != nil {
+					t.Fatal(err)
+				}
+				assert.Equal(t, tt.wantErrResp, response)
+				return
+			}
+			assert.Equal(t, echo.MIMETextHTMLCharsetUTF8, res.Header.Get(echo.HeaderContentType))
+			body, err := io.ReadAll(res.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Contains(t, string(body), tt.wantBody)
+		})
+	}
+}
+
+func TestPreview(t *testing.T) {
+	created := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	recorded := 0
+	svc := &shorturl.MockShortURLService{
+		GetFunc: func(ctx context.Context, shortCode string) (*domain.ShortURL, error) {
+			switch shortCode {
+			case "expired":
+				return nil, domain.ErrShortURLExpired
+			case "missing":
+				return nil, domain.ErrShortURLNotFound
+			}
+			return &domain.ShortURL{
+				ShortCode:   shortCode,
+				ShortURL:    "http://localhost:8080/" + shortCode,
+				OriginalURL: "https://example.com/<landing>",
+				CreatedTime: uint64(created.Unix()),
+				ExpireTime:  uint64(created.Add(24 * time.Hour).Unix()),
+				Untrusted:   shortCode == "untrusted",
+			}, nil
+		},
+		VisitFunc: func(ctx context.Context, click *domain.Click) (*domain.ShortURL, error) {
+			if click.ShortCode == "untrusted" && !click.Confirmed {
+				return nil, domain.ErrShortURLUntrusted
+			}
+			recorded++
+			return &domain.ShortURL{ShortCode: click.ShortCode, OriginalURL: "https://example.com"}, nil
+		},
+	}
+
+	tests := []struct {
+		name         string
+		path         string
+		wantStatus   int
+		wantContains []string
+	}{
+		{
+			name:       "trailing plus",
+			path:       "/abc123+",
+			wantStatus: http.StatusOK,
+			wantContains: []string{
+				"Link preview",
+				"https://example.com/&lt;landing&gt;",
+				"2025-01-01 00:00 UTC",
+				"2025-01-02 00:00 UTC",
+				`href="/abc123"`,
+			},
+		},
+		{
+			name:         "preview param",
+			path:         "/abc123?preview=1",
+			wantStatus:   http.StatusOK,
+			wantContains: []string{"Link preview"},
+		},
+		{
+			name:         "untrusted interstitial",
+			path:         "/untrusted",
+			wantStatus:   http.StatusOK,
+			wantContains: []string{"Before you continue", `href="/untrusted?confirm=`},
+		},
+		{
+			name:         "untrusted with hand-added confirm",
+			path:         "/untrusted?confirm=1",
+			wantStatus:   http.StatusOK,
+			wantContains: []string{"Before you continue"},
+		},
+		{
+			name:         "untrusted with forged token",
+			path:         "/untrusted?confirm=9999999999.forged",
+			wantStatus:   http.StatusOK,
+			wantContains: []string{"Before you continue"},
+		},
+		{
+			name:         "expired",
+			path:         "/expired+",
+			wantStatus:   http.StatusGone,
+			wantContains: []string{"Gone"},
+		},
+		{
+			name:         "not found",
+			path:         "/missing?preview=true",
+			wantStatus:   http.StatusNotFound,
+			wantContains: []string{"Not Found"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := server.New()
+			NewHTTP(svc, r.Group(""), nil)
+			ts := httptest.NewServer(r)
+			defer ts.Close()
+
+			req, err := http.NewRequest(http.MethodGet, ts.URL+tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set(echo.HeaderAccept, browserAccept)
+			client := &http.Client{
+				CheckRedirect: func(req *http.Request, via []*http.Request) error {
+					return http.ErrUseLastResponse // disable redirect
+				},
+			}
+			res, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, res.StatusCode)
+			body, err := io.ReadAll(res.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.wantContains {
+				assert.Contains(t, string(body), want)
+			}
+		})
+	}
+	// previews and interstitials record no click
+	assert.Equal(t, 0, recorded)
+}
+
+func TestPreview_Continue(t *testing.T) {
+	recorded := 0
+	svc := &shorturl.MockShortURLService{
+		GetFunc: func(ctx context.Context, shortCode string) (*domain.ShortURL, error) {
+			return &domain.ShortURL{ShortCode: shortCode, OriginalURL: "https://example.com", Untrusted: true}, nil
+		},
+		VisitFunc: func(ctx context.Context, click *domain.Click) (*domain.ShortURL, error) {
+			if !click.Confirmed {
+				return nil, domain.ErrShortURLUntrusted
+			}
+			recorded++
+			return &domain.ShortURL{ShortCode: click.ShortCode, OriginalURL: "https://example.com"}, nil
+		},
+	}
+	r := server.New()
+	NewHTTP(svc, r.Group(""), &Config{ConfirmSecret: []byte("secret")})
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse // disable redirect
+		},
+	}
+	get := func(path string) (*http.Response, string) {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set(echo.HeaderAccept, browserAccept)
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res, string(body)
+	}
+
+	res, body := get("/untrusted")
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	match := regexp.MustCompile(`href="(/untrusted\?confirm=[^"]+)"`).FindStringSubmatch(body)
+	if match == nil {
+		t.Fatalf("no continue link in %s", body)
+	}
+	continueURL := html.UnescapeString(match[1])
+
+	// the continue link of the interstitial redirects
+	res, _ = get(continueURL)
+	assert.Equal(t, http.StatusTemporaryRedirect, res.StatusCode)
+	assert.Equal(t, "https://example.com", res.Header.Get(echo.HeaderLocation))
+	assert.Equal(t, 1, recorded)
+
+	// the token only confirms the short code it was issued for
+	res, body = get(strings.Replace(continueURL, "/untrusted", "/other", 1))
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Contains(t, body, "Before you continue")
+	assert.Equal(t, 1, recorded)
+}
+
+func TestConfirmToken(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	h := HTTP{confirmSecret: []byte("secret"), confirmTTL: time.Minute, now: func() time.Time { return now }}
+	token := h.confirmToken("abc123")
+
+	assert.True(t, h.confirmed("abc123", token))
+	assert.False(t, h.confirmed("abc124", token))
+	assert.False(t, h.confirmed("abc123", ""))
+	assert.False(t, h.confirmed("abc123", "1"))
+
+	// another secret, as a server not sharing it has
+	other := h
+	other.confirmSecret = []byte("other")
+	assert.False(t, other.confirmed("abc123", token))
+
+	// a token outlives its ttl by no more than its second
+	now = now.Add(time.Minute)
+	assert.True(t, h.confirmed("abc123", token))
+	now = now.Add(time.Second)
+	assert.False(t, h.confirmed("abc123", token))
+}
+
+func TestLoadPages_Missing(t *testing.T) {
+	_, err := LoadPages(map[int]string{http.StatusGone: filepath.Join(t.TempDir(), "missing.html")}, "")
+	assert.Error(t, err)
+
+	_, err = LoadPages(nil, filepath.Join(t.TempDir(), "missing.html"))
+	assert.Error(t, err)
+}
+
+func TestAcceptsHTML(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   bool
+	}{
+		{accept: "", want: false},
+		{accept: "*/*", want: false},
+		{accept: "application/json", want: false},
+		{accept: browserAccept, want: true},
+		{accept: "application/json;q=0.9, text/html", want: true},
+		{accept: "text/html;q=0", want: false},
+		{accept: "text/html;q=oops", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(echo.HeaderAccept, tt.accept)
+			assert.Equal(t, tt.want, acceptsHTML(req))
+		})
+	}
+}
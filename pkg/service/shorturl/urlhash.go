@@ -0,0 +1,44 @@
+package shorturl
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"strings"
+)
+
+// defaultPorts are dropped from the host, they point at the same destination
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// normalizeURL returns the form in which urls to the same destination are equal: scheme and host lowercased,
+// the default port dropped and an empty path written as /. Paths, queries and fragments are kept as they are,
+// servers may tell them apart. A url which does not parse is returned unchanged.
+func normalizeURL(rawURL string) string {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	host, port := strings.ToLower(u.Hostname()), u.Port()
+	if strings.Contains(host, ":") {
+		// an ipv6 address
+		host = "[" + host + "]"
+	}
+	if port != "" && port != defaultPorts[u.Scheme] {
+		host += ":" + port
+	}
+	u.Host = host
+	if u.Path == "" && u.RawPath == "" {
+		u.Path = "/"
+	}
+	return u.String()
+}
+
+// urlHash returns the hash duplicate short urls are looked up by
+func urlHash(originalURL string) string {
+	sum := sha256.Sum256([]byte(normalizeURL(originalURL)))
+	return hex.EncodeToString(sum[:])
+}
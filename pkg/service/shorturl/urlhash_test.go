@@ -0,0 +1,37 @@
+package shorturl
+
+import "testing"
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{name: "lowercases scheme and host", url: "HTTPS://Example.COM/Path", want: "https://example.com/Path"},
+		{name: "drops default port", url: "https://example.com:443/a?b=1", want: "https://example.com/a?b=1"},
+		{name: "keeps other port", url: "http://example.com:8080/a", want: "http://example.com:8080/a"},
+		{name: "adds root path", url: "https://example.com", want: "https://example.com/"},
+		{name: "keeps query and fragment", url: "https://example.com/a?B=2&a=1#Top", want: "https://example.com/a?B=2&a=1#Top"},
+		{name: "ipv6 host", url: "http://[::1]:80/a", want: "http://[::1]/a"},
+		{name: "trims spaces", url: " https://example.com/a ", want: "https://example.com/a"},
+		{name: "not a url", url: "not a url", want: "not a url"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeURL(tt.url); got != tt.want {
+				t.Errorf("normalizeURL(%q) = %q, want %q", tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestURLHash(t *testing.T) {
+	if urlHash("HTTPS://example.com:443") != urlHash("https://example.com/") {
+		t.Error("urlHash differs for the same destination")
+	}
+	if urlHash("https://example.com/a") == urlHash("https://example.com/b") {
+		t.Error("urlHash equal for different destinations")
+	}
+}
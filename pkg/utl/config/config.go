@@ -23,7 +23,14 @@ func Load(path string) (*Configuration, error) {
 
 // Configuration holds data necessary for configuring application
 type Configuration struct {
-	Server *Server `yaml:"server,omitempty"`
+	Server    *Server    `yaml:"server,omitempty"`
+	MachineID *MachineID `yaml:"machine_id,omitempty"`
+	Cache     *Cache     `yaml:"cache,omitempty"`
+	Redis     *Redis     `yaml:"redis,omitempty"`
+	Click     *Click     `yaml:"click,omitempty"`
+	Redirect  *Redirect  `yaml:"redirect,omitempty"`
+	API       *API       `yaml:"api,omitempty"`
+	Import    *Import    `yaml:"import,omitempty"`
 }
 
 // Server holds data necessary for server configuration
@@ -32,4 +39,92 @@ type Server struct {
 	Debug        bool   `yaml:"debug,omitempty"`
 	ReadTimeout  int    `yaml:"read_timeout_seconds,omitempty"`
 	WriteTimeout int    `yaml:"write_timeout_seconds,omitempty"`
+	// DebugPort is the address of the listener serving /debug/vars, it should only be reachable internally. Not served when empty.
+	DebugPort string `yaml:"debug_port,omitempty"`
+	// TrustedProxies are the CIDRs of the proxies whose X-Forwarded-For is believed, the connection address is used otherwise
+	TrustedProxies []string `yaml:"trusted_proxies,omitempty"`
+}
+
+// MachineID holds data necessary for leasing the machine id of short codes
+type MachineID struct {
+	KeyPrefix string `yaml:"key_prefix,omitempty"`
+	MaxID     uint64 `yaml:"max_id,omitempty"`
+	LeaseTTL  int    `yaml:"lease_ttl_seconds,omitempty"`
+}
+
+// Cache holds data necessary for caching short urls in Redis
+type Cache struct {
+	MaxTTL      int `yaml:"max_ttl_seconds,omitempty"`
+	TTLJitter   int `yaml:"ttl_jitter_seconds,omitempty"`
+	NegativeTTL int `yaml:"negative_ttl_seconds,omitempty"`
+	LocalTTL    int `yaml:"local_ttl_seconds,omitempty"`
+	LocalSizeMB int `yaml:"local_size_mb,omitempty"`
+}
+
+// Redis holds the connection settings of every redis store, a store without addresses connects to REDIS_URL
+type Redis struct {
+	Bloom  *RedisStore `yaml:"bloom,omitempty"`
+	Cache  *RedisStore `yaml:"cache,omitempty"`
+	Locker *RedisStore `yaml:"locker,omitempty"`
+}
+
+// RedisStore holds data necessary for connecting to a redis
+type RedisStore struct {
+	Addresses []string `yaml:"addresses,omitempty"`
+	Username  string   `yaml:"username,omitempty"`
+	Password  string   `yaml:"password,omitempty"`
+	TLS       bool     `yaml:"tls,omitempty"`
+	DB        int      `yaml:"db,omitempty"`
+	KeyPrefix string   `yaml:"key_prefix,omitempty"`
+}
+
+// Click holds data necessary for recording redirects
+type Click struct {
+	// Sink is either postgres or stream, clicks are written to the click_event table by default
+	Sink            string `yaml:"sink,omitempty"`
+	BufferSize      int    `yaml:"buffer_size,omitempty"`
+	BatchSize       int    `yaml:"batch_size,omitempty"`
+	FlushIntervalMs int    `yaml:"flush_interval_ms,omitempty"`
+	StreamKey       string `yaml:"stream_key,omitempty"`
+	StreamMaxLen    int64  `yaml:"stream_max_len,omitempty"`
+	// BotPatternsFile lists user agent patterns of bots, one regular expression per line, it is reloaded when it changes.
+	// The built in patterns are used without it.
+	BotPatternsFile  string `yaml:"bot_patterns_file,omitempty"`
+	BotReloadSeconds int    `yaml:"bot_reload_seconds,omitempty"`
+}
+
+// Redirect holds data necessary for redirecting visits of short urls
+type Redirect struct {
+	// Status is used by short urls which did not choose one, 301, 302, 307 or 308
+	Status int `yaml:"status,omitempty"`
+	// MaxAge caps how long browsers and CDNs cache a permanent redirect
+	MaxAge int `yaml:"max_age_seconds,omitempty"`
+	// ErrorPages maps a status to the html/template file browsers get instead of the built in page
+	ErrorPages map[int]string `yaml:"error_pages,omitempty"`
+	// PreviewPage is the html/template file of link previews and interstitials, a built in page is used without it
+	PreviewPage string `yaml:"preview_page,omitempty"`
+	// ConfirmSecret signs the continue links of interstitials, every server needs the same one. A random secret is used without it.
+	ConfirmSecret string `yaml:"confirm_secret,omitempty"`
+	// ConfirmTTL is how long the continue link of an interstitial skips it
+	ConfirmTTL int `yaml:"confirm_ttl_seconds,omitempty"`
+}
+
+// API holds the limits of the short url API
+type API struct {
+	// MaxBatchSize caps how many short urls one batch creates
+	MaxBatchSize int `yaml:"max_batch_size,omitempty"`
+	// IdempotencyWindow is how long a retry with the same Idempotency-Key gets the short url of the first request
+	IdempotencyWindow int `yaml:"idempotency_window_seconds,omitempty"`
+}
+
+// Import holds data necessary for bulk import jobs
+type Import struct {
+	// MaxFileMB caps the size of an uploaded file
+	MaxFileMB      int `yaml:"max_file_mb,omitempty"`
+	PollIntervalMs int `yaml:"poll_interval_ms,omitempty"`
+	// LeaseTTL is how long a job of a worker which stopped waits before another worker resumes it
+	LeaseTTL  int `yaml:"lease_ttl_seconds,omitempty"`
+	ChunkSize int `yaml:"chunk_size,omitempty"`
+	// MaxAttempts is how many times a job is resumed without progress before it fails
+	MaxAttempts int `yaml:"max_attempts,omitempty"`
 }
@@ -32,10 +32,72 @@ func TestLoad(t *testing.T) {
 			path: "testdata/config.testdata.yaml",
 			wantData: &config.Configuration{
 				Server: &config.Server{
-					Port:         ":8080",
-					Debug:        true,
-					ReadTimeout:  15,
-					WriteTimeout: 20,
+					Port:           ":8080",
+					Debug:          true,
+					ReadTimeout:    15,
+					WriteTimeout:   20,
+					DebugPort:      "127.0.0.1:6060",
+					TrustedProxies: []string{"10.0.0.0/8"},
+				},
+				MachineID: &config.MachineID{
+					KeyPrefix: "machineid:",
+					MaxID:     64,
+					LeaseTTL:  30,
+				},
+				Cache: &config.Cache{
+					MaxTTL:      86400,
+					TTLJitter:   3600,
+					NegativeTTL: 60,
+					LocalTTL:    60,
+					LocalSizeMB: 64,
+				},
+				Redis: &config.Redis{
+					Bloom: &config.RedisStore{
+						Addresses: []string{"bloom-0:6379", "bloom-1:6379"},
+						Password:  "secret",
+						TLS:       true,
+						KeyPrefix: "dcard:",
+					},
+					Cache: &config.RedisStore{
+						Addresses: []string{"cache:6379"},
+						DB:        1,
+					},
+					Locker: &config.RedisStore{
+						Username: "locker",
+					},
+				},
+				Click: &config.Click{
+					Sink:            "stream",
+					BufferSize:      2000,
+					BatchSize:       100,
+					FlushIntervalMs: 500,
+					StreamKey:       "clicks",
+					StreamMaxLen:    100000,
+
+					BotPatternsFile:  "./bot_patterns.txt",
+					BotReloadSeconds: 30,
+				},
+				Redirect: &config.Redirect{
+					Status: 308,
+					MaxAge: 3600,
+					ErrorPages: map[int]string{
+						404: "./pages/404.html",
+						410: "./pages/410.html",
+					},
+					PreviewPage:   "./pages/preview.html",
+					ConfirmSecret: "interstitial",
+					ConfirmTTL:    300,
+				},
+				API: &config.API{
+					MaxBatchSize:      500,
+					IdempotencyWindow: 3600,
+				},
+				Import: &config.Import{
+					MaxFileMB:      16,
+					PollIntervalMs: 500,
+					LeaseTTL:       120,
+					ChunkSize:      250,
+					MaxAttempts:    3,
 				},
 			},
 		},
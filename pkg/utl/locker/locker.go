@@ -1,14 +1,21 @@
 package locker
 
 import (
-	"github.com/redis/rueidis"
 	"github.com/redis/rueidis/rueidislock"
+
+	"github.com/sappy5678/dcard/pkg/utl/redis"
 )
 
 func New(connectString string) (rueidislock.Locker, error) {
+	return NewWithConfig(&redis.Config{Addresses: []string{connectString}})
+}
+
+// NewWithConfig creates a locker on the configured redis, lock keys are prefixed with cfg.KeyPrefix when set
+func NewWithConfig(cfg *redis.Config) (rueidislock.Locker, error) {
 	client, err := rueidislock.NewLocker(
 		rueidislock.LockerOption{
-			ClientOption:   rueidis.ClientOption{InitAddress: []string{connectString}},
+			ClientOption:   cfg.ClientOption(),
+			KeyPrefix:      cfg.KeyPrefix,
 			KeyMajority:    1, // let it configable
 			NoLoopTracking: true,
 		},
@@ -0,0 +1,174 @@
+package machineid
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/rueidis"
+)
+
+var (
+	ErrNoFreeID  = errors.New("no free machine id")
+	ErrLeaseLost = errors.New("machine id lease lost")
+)
+
+const (
+	defaultKeyPrefix = "machineid:"
+	defaultMaxID     = 1024
+	defaultTTL       = 30 * time.Second
+)
+
+// only touch the key while it still holds our token, so an expired lease never steals a new owner's id
+var (
+	renewScript   = rueidis.NewLuaScript(`if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("PEXPIRE", KEYS[1], ARGV[2]) else return 0 end`)
+	releaseScript = rueidis.NewLuaScript(`if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) else return 0 end`)
+)
+
+// Config represents machine id lease specific config
+type Config struct {
+	KeyPrefix string
+	MaxID     uint64
+	TTL       time.Duration
+}
+
+// Static is a fixed machine id, for single node deployments and tests
+type Static uint64
+
+// MachineID returns the fixed machine id
+func (s Static) MachineID() (uint64, error) {
+	return uint64(s), nil
+}
+
+// Lease is a machine id held in Redis and renewed by a heartbeat until Close
+type Lease struct {
+	redis rueidis.Client
+	key   string
+	token string
+	id    uint64
+	maxID uint64
+	ttl   time.Duration
+
+	mu       sync.RWMutex
+	expireAt time.Time
+	lost     bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Acquire leases the lowest free machine id and starts renewing it
+func Acquire(ctx context.Context, client rueidis.Client, cfg *Config) (*Lease, error) {
+	prefix, maxID, ttl := defaultKeyPrefix, uint64(defaultMaxID), defaultTTL
+	if cfg != nil {
+		if cfg.KeyPrefix != "" {
+			prefix = cfg.KeyPrefix
+		}
+		if cfg.MaxID > 0 {
+			maxID = cfg.MaxID
+		}
+		if cfg.TTL > 0 {
+			ttl = cfg.TTL
+		}
+	}
+
+	token := uuid.NewString()
+	for id := uint64(1); id <= maxID; id++ {
+		key := prefix + strconv.FormatUint(id, 10)
+		begin := time.Now()
+		cmd := client.B().Set().Key(key).Value(token).Nx().Px(ttl).Build()
+		err := client.Do(ctx, cmd).Error()
+		if rueidis.IsRedisNil(err) {
+			// held by another node
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		l := &Lease{
+			redis:    client,
+			key:      key,
+			token:    token,
+			id:       id,
+			maxID:    maxID,
+			ttl:      ttl,
+			expireAt: begin.Add(ttl),
+			stop:     make(chan struct{}),
+			done:     make(chan struct{}),
+		}
+		go l.heartbeat()
+		return l, nil
+	}
+
+	return nil, ErrNoFreeID
+}
+
+// MachineID returns the leased id, or ErrLeaseLost once the lease was taken over or could not be renewed in time
+func (l *Lease) MachineID() (uint64, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.lost || time.Now().After(l.expireAt) {
+		return 0, ErrLeaseLost
+	}
+	return l.id, nil
+}
+
+// MaxID returns the highest id any node may lease
+func (l *Lease) MaxID() uint64 {
+	return l.maxID
+}
+
+// Close stops the heartbeat and releases the id for other nodes
+func (l *Lease) Close(ctx context.Context) error {
+	close(l.stop)
+	<-l.done
+
+	l.mu.Lock()
+	l.lost = true
+	l.mu.Unlock()
+
+	return releaseScript.Exec(ctx, l.redis, []string{l.key}, []string{l.token}).Error()
+}
+
+func (l *Lease) heartbeat() {
+	defer close(l.done)
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			if lost := l.renew(); lost {
+				return
+			}
+		}
+	}
+}
+
+// renew extends the lease, a failed request is retried on the next tick until the lease expires locally
+func (l *Lease) renew() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), l.ttl/3)
+	defer cancel()
+
+	begin := time.Now()
+	ttl := strconv.FormatInt(l.ttl.Milliseconds(), 10)
+	renewed, err := renewScript.Exec(ctx, l.redis, []string{l.key}, []string{l.token, ttl}).AsInt64()
+	if err != nil {
+		return false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if renewed == 0 {
+		l.lost = true
+		return true
+	}
+	l.expireAt = begin.Add(l.ttl)
+	return false
+}
@@ -0,0 +1,85 @@
+package machineid_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/redis/rueidis"
+	"github.com/stretchr/testify/assert"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+
+	"github.com/sappy5678/dcard/pkg/utl/machineid"
+)
+
+func TestAcquire(t *testing.T) {
+	ctx := context.Background()
+	req := testcontainers.ContainerRequest{
+		Image:        "redis/redis-stack:7.4.0-v3",
+		ExposedPorts: []string{"6379/tcp"},
+		WaitingFor:   wait.ForAll(wait.ForLog("Ready to accept connections"), wait.ForListeningPort("6379")),
+	}
+	redisC, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: req,
+		Started:          true,
+	})
+	assert.NoError(t, err)
+
+	endpoint, err := redisC.Endpoint(ctx, "")
+	assert.NoError(t, err)
+
+	defer testcontainers.CleanupContainer(t, redisC)
+
+	client, err := rueidis.NewClient(rueidis.ClientOption{InitAddress: []string{endpoint}})
+	if err != nil {
+		t.Fatalf("Error establishing connection %v", err)
+	}
+	defer client.Close()
+
+	cfg := &machineid.Config{MaxID: 2, TTL: 300 * time.Millisecond}
+
+	first, err := machineid.Acquire(ctx, client, cfg)
+	assert.NoError(t, err)
+	second, err := machineid.Acquire(ctx, client, cfg)
+	assert.NoError(t, err)
+
+	firstID, err := first.MachineID()
+	assert.NoError(t, err)
+	secondID, err := second.MachineID()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), first.MaxID())
+	assert.NotEqual(t, firstID, secondID)
+
+	_, err = machineid.Acquire(ctx, client, cfg)
+	assert.ErrorIs(t, err, machineid.ErrNoFreeID)
+
+	// the heartbeat keeps the lease beyond its ttl
+	time.Sleep(time.Second)
+	_, err = first.MachineID()
+	assert.NoError(t, err)
+
+	// a released id can be leased again
+	assert.NoError(t, second.Close(ctx))
+	_, err = second.MachineID()
+	assert.ErrorIs(t, err, machineid.ErrLeaseLost)
+	third, err := machineid.Acquire(ctx, client, cfg)
+	assert.NoError(t, err)
+	thirdID, err := third.MachineID()
+	assert.NoError(t, err)
+	assert.Equal(t, secondID, thirdID)
+
+	// a lease taken over by another node is lost
+	assert.NoError(t, client.Do(ctx, client.B().Set().Key("machineid:1").Value("other").Build()).Error())
+	time.Sleep(time.Second)
+	_, err = first.MachineID()
+	assert.ErrorIs(t, err, machineid.ErrLeaseLost)
+
+	assert.NoError(t, third.Close(ctx))
+}
+
+func TestStatic(t *testing.T) {
+	id, err := machineid.Static(7).MachineID()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(7), id)
+}
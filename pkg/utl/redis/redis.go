@@ -2,21 +2,52 @@ package redis
 
 import (
 	"context"
+	"crypto/tls"
 
 	"github.com/redis/rueidis"
 )
 
+// Config represents redis client specific config
+type Config struct {
+	Addresses []string
+	Username  string
+	Password  string
+	TLS       bool
+	DB        int
+	// KeyPrefix is prepended to every key written through this client by its users
+	KeyPrefix string
+	// CacheSizeEachConn is the client side cache size in bytes of each connection, 0 uses the rueidis default
+	CacheSizeEachConn int
+}
+
+// ClientOption returns the rueidis options connecting to the configured redis
+func (cfg *Config) ClientOption() rueidis.ClientOption {
+	opt := rueidis.ClientOption{
+		InitAddress:       cfg.Addresses,
+		Username:          cfg.Username,
+		Password:          cfg.Password,
+		SelectDB:          cfg.DB,
+		CacheSizeEachConn: cfg.CacheSizeEachConn,
+	}
+	if cfg.TLS {
+		opt.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	return opt
+}
+
 func New(connectString string) (rueidis.Client, error) {
-	client, err := rueidis.NewClient(
-		rueidis.ClientOption{
-			InitAddress: []string{connectString},
-		},
-	)
+	return NewWithConfig(&Config{Addresses: []string{connectString}})
+}
+
+// NewWithConfig creates a client with client side caching bounded by cfg.CacheSizeEachConn
+func NewWithConfig(cfg *Config) (rueidis.Client, error) {
+	client, err := rueidis.NewClient(cfg.ClientOption())
 	if err != nil {
 		return nil, err
 	}
 
-	if client.Do(context.Background(), client.B().Ping().Build()).Error() != nil {
+	if err := client.Do(context.Background(), client.B().Ping().Build()).Error(); err != nil {
+		client.Close()
 		return nil, err
 	}
 
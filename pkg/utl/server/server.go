@@ -2,6 +2,8 @@ package server
 
 import (
 	"context"
+	"expvar"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -37,12 +39,28 @@ func healthCheck(c echo.Context) error {
 	return c.JSON(http.StatusOK, "OK")
 }
 
+// StartDebug serves the expvar runtime stats on /debug/vars of addr in the background.
+// They include the command line and memory stats, so addr should only be reachable internally.
+func StartDebug(addr string) (*http.Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+	s := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go s.Serve(ln)
+	return s, nil
+}
+
 // Config represents server specific config
 type Config struct {
 	Port                string
 	ReadTimeoutSeconds  int
 	WriteTimeoutSeconds int
 	Debug               bool
+	// OnShutdown is called when the server starts shutting down, long lived handlers should return then
+	OnShutdown func()
 }
 
 // Start starts echo server
@@ -53,6 +71,9 @@ func Start(e *echo.Echo, cfg *Config) {
 		WriteTimeout: time.Duration(cfg.WriteTimeoutSeconds) * time.Second,
 	}
 	e.Debug = cfg.Debug
+	if cfg.OnShutdown != nil {
+		s.RegisterOnShutdown(cfg.OnShutdown)
+	}
 
 	// Start server
 	go func() {
@@ -69,7 +90,8 @@ func Start(e *echo.Echo, cfg *Config) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	if err := e.Shutdown(ctx); err != nil {
+	// e.Shutdown only stops the servers echo created itself
+	if err := s.Shutdown(ctx); err != nil {
 		e.Logger.Fatal(err)
 	}
 }
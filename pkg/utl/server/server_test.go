@@ -13,3 +13,14 @@ func TestNew(t *testing.T) {
 		t.Errorf("Server should not be nil")
 	}
 }
+
+func TestStartDebug(t *testing.T) {
+	s, err := server.StartDebug("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, err := server.StartDebug("not an address"); err == nil {
+		t.Errorf("Expected error")
+	}
+}